@@ -0,0 +1,350 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/codec"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/gorilla/websocket"
+)
+
+const DefaultRetryInterval = 30 * time.Second
+
+// EventHandler 在本地缓存应用事件之后被调用
+type EventHandler func(event *resource.ResourceEvent)
+
+// PodFilter 返回true的Pod会被ListPods返回
+type PodFilter func(pod *cache.Pod) bool
+
+// Client 从MetaSource的/fetch接口获取资源, 并在本地维护同步的缓存
+type Client struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	fetchURL url.URL
+	resTypes []resource.ResType
+	// 不为空时只获取该集群的资源
+	clusterID string
+
+	HandlerTemplateMap map[resource.ResType]resource.HandlerTemplate
+	RetryInterval      time.Duration
+	// 期望MetaSource推送的编码和压缩方式, 默认为不压缩的JSON; 服务端不支持时回退为JSON
+	Codec codec.Codec
+	// 连接wss地址或需要客户端证书时配置
+	TLSConfig *tls.Config
+	// MetaSource开启认证时携带的Bearer Token
+	BearerToken string
+
+	cacheMap *cache.ClusterCacheMap
+	querier  *cache.Query
+
+	// clusterID -> *cache.HandlerMap
+	clusters sync.Map
+	// 不为nil时事件直接交给这些handler处理, 不维护Client自身的缓存
+	forward map[resource.ResType][]resource.ResHandler
+
+	handlerMux    sync.RWMutex
+	eventHandlers []EventHandler
+
+	syncOnce sync.Once
+	synced   chan struct{}
+	// 已处理的事件序号, 重连时用于续传
+	progress resource.FetchProgress
+
+	connMux sync.Mutex
+	conn    *websocket.Conn
+	// Start启动的goroutine退出后关闭
+	done chan struct{}
+}
+
+// NewClient address为MetaSource的地址, 如 "meta-server:8080" 或 "http://meta-server:8080/metadata"
+// resTypes为空时获取全部资源类型
+func NewClient(address string, resTypes ...resource.ResType) *Client {
+	cacheMap := cache.NewClusterCacheList()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		ctx:      ctx,
+		cancel:   cancel,
+		fetchURL: FetchURL(address),
+		resTypes: resTypes,
+		HandlerTemplateMap: map[resource.ResType]resource.HandlerTemplate{
+			resource.PodType:       cache.NewPodList,
+			resource.ServiceType:   cache.NewServiceList,
+			resource.NodeType:      cache.NewNodeList,
+			resource.NamespaceType: cache.NewNamespaceList,
+		},
+		RetryInterval: DefaultRetryInterval,
+		cacheMap:      cacheMap,
+		querier:       &cache.Query{CacheMap: cacheMap},
+		synced:        make(chan struct{}),
+	}
+	for _, resType := range resource.WorkloadTypes {
+		c.HandlerTemplateMap[resType] = cache.NewWorkloadList
+	}
+	return c
+}
+
+// FetchURL 将MetaSource地址转换为/fetch的websocket地址
+func FetchURL(address string) url.URL {
+	scheme := "ws"
+	if strings.HasPrefix(address, "https://") {
+		scheme = "wss"
+	}
+	address = strings.TrimPrefix(address, "http://")
+	address = strings.TrimPrefix(address, "https://")
+	// 移除末尾的/
+	address = strings.TrimSuffix(address, "/")
+	pathIdx := strings.IndexByte(address, '/')
+	if pathIdx < 0 {
+		return url.URL{Scheme: scheme, Host: address, Path: "/fetch"}
+	}
+	return url.URL{Scheme: scheme, Host: address[:pathIdx], Path: address[pathIdx:] + "/fetch"}
+}
+
+// ForwardTo 将全部集群的事件交给handlers处理, 需要在Start之前调用
+// 用于将上游的资源合并到本地已有的缓存中, 此后Client自身不再缓存资源, 查询接口不返回结果
+func (c *Client) ForwardTo(handlers map[resource.ResType][]resource.ResHandler) *Client {
+	c.forward = handlers
+	return c
+}
+
+// WithClusterID 只获取clusterID的资源, 需要在Start之前调用
+// 服务端不支持按集群过滤时, Client同样会丢弃其他集群的事件
+func (c *Client) WithClusterID(clusterID string) *Client {
+	c.clusterID = clusterID
+	return c
+}
+
+// ResTypes 获取的资源类型, 为空时获取全部资源类型
+func (c *Client) ResTypes() []resource.ResType {
+	return c.resTypes
+}
+
+// OnEvent 注册事件回调, 需要在Start之前调用
+func (c *Client) OnEvent(handler EventHandler) *Client {
+	c.handlerMux.Lock()
+	defer c.handlerMux.Unlock()
+	c.eventHandlers = append(c.eventHandlers, handler)
+	return c
+}
+
+// Start 在后台连接MetaSource并保持同步, 连接断开后按RetryInterval重连
+func (c *Client) Start() {
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		for {
+			err := c.fetch()
+			select {
+			case <-c.ctx.Done():
+				return
+			default:
+			}
+			log.Printf("failed to fetch from source[%s], retry after %s, err: %v", c.fetchURL.String(), c.RetryInterval, err)
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(c.RetryInterval):
+			}
+		}
+	}()
+}
+
+// WaitForSync 等待首次收到MetaSource的全量数据
+func (c *Client) WaitForSync(ctx context.Context) bool {
+	select {
+	case <-c.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Stop 断开与MetaSource的连接, 后台goroutine退出后返回
+func (c *Client) Stop() {
+	c.cancel()
+	c.connMux.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connMux.Unlock()
+	if c.done != nil {
+		<-c.done
+	}
+}
+
+func (c *Client) fetch() error {
+	var fetchHeader = http.Header{"X-Data-Flow": {"meta-fetch"}}
+	c.Codec.SetAcceptHeaders(fetchHeader)
+	server.SetBearerToken(fetchHeader, c.BearerToken)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = c.TLSConfig
+	conn, resp, err := dialer.DialContext(c.ctx, c.fetchURL.String(), fetchHeader)
+	if err != nil {
+		return err
+	}
+	fetchCodec, err := codec.FromContentHeaders(resp.Header)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer conn.Close()
+	c.connMux.Lock()
+	c.conn = conn
+	c.connMux.Unlock()
+	if c.ctx.Err() != nil {
+		// 连接建立期间已经Stop
+		return c.ctx.Err()
+	}
+
+	request := c.progress.Request(c.resTypes)
+	request.ClusterID = c.clusterID
+	err = conn.WriteJSON(request)
+	if err != nil {
+		return err
+	}
+
+	for {
+		_, received, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var syncReq resource.SyncRequest
+		err = fetchCodec.Unmarshal(received, &syncReq)
+		if err != nil {
+			return err
+		}
+
+		if c.progress.Accept(&syncReq) {
+			for _, event := range syncReq.Events {
+				c.handleEvent(event)
+			}
+		}
+		c.syncOnce.Do(func() { close(c.synced) })
+	}
+}
+
+func (c *Client) handleEvent(event *resource.ResourceEvent) {
+	if event.Malformed() {
+		log.Printf("skip malformed event from %s", c.fetchURL.Host)
+		return
+	}
+	if len(c.clusterID) > 0 && event.ClusterID != c.clusterID {
+		return
+	}
+	if c.forward != nil {
+		for _, handler := range c.forward[event.ResourceType] {
+			applyEvent(handler, event)
+		}
+	} else {
+		handlerMap := c.clusterHandlerMap(event.ClusterID)
+		handler, find := handlerMap.GetHandler(event.ResourceType)
+		if !find {
+			handler = resource.NewResources(event.ResourceType, []*resource.Resource{})
+			handler.SetClusterID(event.ClusterID)
+			handler.SetExporter(export.NonExporter)
+			handlerMap.AddHandler(event.ResourceType, handler)
+		}
+		applyEvent(handler, event)
+	}
+
+	c.handlerMux.RLock()
+	defer c.handlerMux.RUnlock()
+	for _, eventHandler := range c.eventHandlers {
+		eventHandler(event)
+	}
+}
+
+func applyEvent(handler resource.ResHandler, event *resource.ResourceEvent) {
+	switch event.Operation {
+	case resource.AddOP:
+		handler.AddResource(event.Res[0])
+	case resource.UpdateOP:
+		handler.UpdateResource(event.Res[0])
+	case resource.DeleteOP:
+		handler.DeleteResource(event.Res[0])
+	case resource.ResetOP:
+		handler.Reset(event.Res)
+	}
+}
+
+func (c *Client) clusterHandlerMap(clusterID string) *cache.HandlerMap {
+	if handlerMap, find := c.clusters.Load(clusterID); find {
+		return handlerMap.(*cache.HandlerMap)
+	}
+
+	handlerMap := &cache.HandlerMap{
+		Handlers: map[resource.ResType]resource.ResHandler{},
+	}
+	for resType, temp := range c.HandlerTemplateMap {
+		handler := temp(resType, nil)
+		handler.SetClusterID(clusterID)
+		handler.SetExporter(export.NonExporter)
+		handlerMap.AddHandler(resType, handler)
+	}
+	c.clusters.Store(clusterID, handlerMap)
+	c.cacheMap.AddResHandlers(clusterID, handlerMap)
+	return handlerMap
+}
+
+// Query 返回基于本地缓存的查询接口, 用于按时间查询等高级用法
+func (c *Client) Query() *cache.Query {
+	return c.querier
+}
+
+func (c *Client) PodByIP(clusterID string, ip string) (*cache.Pod, bool) {
+	return c.querier.GetPodByIP(clusterID, ip)
+}
+
+func (c *Client) PodByContainerID(clusterID string, containerID string) (*cache.Pod, bool) {
+	return c.querier.GetPodByContainerId(clusterID, containerID)
+}
+
+// ContainerByID containerID为短ID或不含运行时前缀的完整ID, 返回的Container.Pod为所属的Pod
+func (c *Client) ContainerByID(clusterID string, containerID string) (*cache.Container, bool) {
+	return c.querier.GetContainerByID(clusterID, containerID)
+}
+
+func (c *Client) ServiceByIP(clusterID string, ip string) (*cache.Service, bool) {
+	return c.querier.GetServiceByIP(clusterID, ip)
+}
+
+func (c *Client) NodeByIP(clusterID string, ip string) (*cache.Node, bool) {
+	return c.querier.GetNodeByIP(clusterID, ip)
+}
+
+// ResolveEndpoint 解析ip:port访问的Pod, Service或Node, 返回匹配方式; port为0时只按IP匹配
+func (c *Client) ResolveEndpoint(clusterID string, ip string, port int, protocol string) (*cache.ResolvedEndpoint, bool) {
+	return c.querier.ResolveEndpoint(clusterID, ip, port, protocol)
+}
+
+// ListPods clusterID为空时返回全部集群的Pod, filter为nil时不过滤
+func (c *Client) ListPods(clusterID string, filter PodFilter) []*cache.Pod {
+	pods := c.querier.ListPod(clusterID)
+	if filter == nil {
+		return pods
+	}
+	var filtered []*cache.Pod
+	for _, pod := range pods {
+		if filter(pod) {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
+// ListPodsWithOptions 按标签选择器和字段条件查询Pod, 支持分页
+func (c *Client) ListPodsWithOptions(clusterID string, opts *cache.ListOptions) ([]*cache.Pod, string, error) {
+	return c.querier.ListPodWithOptions(clusterID, opts)
+}
@@ -0,0 +1,228 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/client"
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/codec"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPod(uid string, ip string, app string) *resource.Resource {
+	return &resource.Resource{
+		ResUID:    resource.ResUID(uid),
+		ResType:   resource.PodType,
+		Name:      uid,
+		Relations: []resource.Relation{},
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr:    "default",
+			resource.PodIP:            ip,
+			resource.ContainerIDsAttr: uid + "-012345",
+		},
+		Int64Attr: map[resource.AttrKey]int64{},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.PodLabelsAttr: {"app": app},
+		},
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	codecs := []codec.Codec{
+		codec.Default,
+		{Encoding: codec.JSON, Compression: codec.Gzip},
+		{Encoding: codec.Gob, Compression: codec.Zstd},
+	}
+	for _, fetchCodec := range codecs {
+		t.Run(string(fetchCodec.Encoding)+"/"+string(fetchCodec.Compression), func(t *testing.T) {
+			testClientSync(t, fetchCodec)
+		})
+	}
+}
+
+func testClientSync(t *testing.T, fetchCodec codec.Codec) {
+	fetchServer := export.NewFetcherServer()
+	srv := httptest.NewServer(http.HandlerFunc(fetchServer.FetchWithWS))
+	defer srv.Close()
+
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetClusterID("TEST_CLUSTER")
+	podList.SetExporter(fetchServer)
+	podList.AddResource(testPod("pod-1", "10.0.0.1", "web"))
+
+	events := make(chan *resource.ResourceEvent, 10)
+	c := client.NewClient(srv.URL, resource.PodType).
+		OnEvent(func(event *resource.ResourceEvent) { events <- event })
+	c.Codec = fetchCodec
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.True(t, c.WaitForSync(ctx))
+	assert.Equal(t, resource.ResetOP, (<-events).Operation)
+
+	pod, find := c.PodByIP("TEST_CLUSTER", "10.0.0.1")
+	assert.True(t, find)
+	assert.Equal(t, "pod-1", pod.Name)
+
+	podList.AddResource(testPod("pod-2", "10.0.0.2", "api"))
+	select {
+	case event := <-events:
+		assert.Equal(t, resource.AddOP, event.Operation)
+	case <-ctx.Done():
+		t.Fatal("add event not received")
+	}
+
+	pod, find = c.PodByContainerID("", "pod-2-012345")
+	assert.True(t, find)
+	assert.Equal(t, "pod-2", pod.Name)
+
+	apiPods := c.ListPods("", func(pod *cache.Pod) bool {
+		return pod.Labels()["app"] == "api"
+	})
+	assert.Len(t, apiPods, 1)
+	assert.Len(t, c.ListPods("TEST_CLUSTER", nil), 2)
+}
+
+func TestClientForwardTo(t *testing.T) {
+	fetchServer := export.NewFetcherServer()
+	srv := httptest.NewServer(http.HandlerFunc(fetchServer.FetchWithWS))
+	defer srv.Close()
+
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetClusterID("UPSTREAM")
+	podList.SetExporter(fetchServer)
+	podList.AddResource(testPod("pod-1", "10.0.0.1", "web"))
+
+	localList := cache.NewPodList(resource.PodType, nil).(*cache.PodList)
+	localList.SetClusterID("LOCAL")
+	localList.SetExporter(export.NonExporter)
+
+	events := make(chan *resource.ResourceEvent, 10)
+	c := client.NewClient(srv.URL, resource.PodType).
+		ForwardTo(map[resource.ResType][]resource.ResHandler{resource.PodType: {localList}}).
+		OnEvent(func(event *resource.ResourceEvent) { events <- event })
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.True(t, c.WaitForSync(ctx))
+	<-events
+
+	_, find := localList.Index().IP2PodMap.Load("10.0.0.1")
+	assert.True(t, find)
+	// 转发后Client自身不缓存资源
+	_, find = c.PodByIP("UPSTREAM", "10.0.0.1")
+	assert.False(t, find)
+
+	podList.DeleteResource(testPod("pod-1", "10.0.0.1", "web"))
+	select {
+	case event := <-events:
+		assert.Equal(t, resource.DeleteOP, event.Operation)
+	case <-ctx.Done():
+		t.Fatal("delete event not received")
+	}
+	assert.Empty(t, localList.ResList)
+}
+
+func TestClientWithClusterID(t *testing.T) {
+	fetchServer := export.NewFetcherServer()
+	srv := httptest.NewServer(http.HandlerFunc(fetchServer.FetchWithWS))
+	defer srv.Close()
+
+	for _, clusterID := range []string{"CLUSTER_A", "CLUSTER_B"} {
+		podList := resource.NewResources(resource.PodType, nil)
+		podList.SetClusterID(clusterID)
+		podList.SetExporter(fetchServer)
+	}
+
+	localList := cache.NewPodList(resource.PodType, nil).(*cache.PodList)
+	localList.SetClusterID("CLUSTER_A")
+	localList.SetExporter(export.NonExporter)
+
+	events := make(chan *resource.ResourceEvent, 10)
+	c := client.NewClient(srv.URL, resource.PodType).
+		WithClusterID("CLUSTER_A").
+		ForwardTo(map[resource.ResType][]resource.ResHandler{resource.PodType: {localList}}).
+		OnEvent(func(event *resource.ResourceEvent) { events <- event })
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.True(t, c.WaitForSync(ctx))
+	// 全量数据只包含CLUSTER_A
+	event := <-events
+	assert.Equal(t, "CLUSTER_A", event.ClusterID)
+
+	fetchServer.ExportResourceEvents(&resource.ResourceEvent{
+		ClusterID:    "CLUSTER_B",
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod("pod-2", "10.0.0.2", "db")},
+	})
+	fetchServer.ExportResourceEvents(&resource.ResourceEvent{
+		ClusterID:    "CLUSTER_A",
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod("pod-1", "10.0.0.1", "web")},
+	})
+	select {
+	case event = <-events:
+		assert.Equal(t, "CLUSTER_A", event.ClusterID)
+	case <-ctx.Done():
+		t.Fatal("add event not received")
+	}
+	_, find := localList.Index().IP2PodMap.Load("10.0.0.1")
+	assert.True(t, find)
+	_, find = localList.Index().IP2PodMap.Load("10.0.0.2")
+	assert.False(t, find)
+}
+
+func TestClientSkipMalformedEvent(t *testing.T) {
+	fetchServer := export.NewFetcherServer()
+	srv := httptest.NewServer(http.HandlerFunc(fetchServer.FetchWithWS))
+	defer srv.Close()
+
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(fetchServer)
+
+	events := make(chan *resource.ResourceEvent, 10)
+	c := client.NewClient(srv.URL, resource.PodType).
+		OnEvent(func(event *resource.ResourceEvent) { events <- event })
+	c.Start()
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.True(t, c.WaitForSync(ctx))
+	<-events
+
+	// 不包含资源的事件被跳过, 之后的事件正常处理
+	for _, op := range []resource.ResOperation{resource.AddOP, resource.UpdateOP, resource.DeleteOP} {
+		fetchServer.ExportResourceEvents(&resource.ResourceEvent{
+			ResourceType: resource.PodType,
+			Operation:    op,
+		})
+	}
+	fetchServer.ExportResourceEvents(&resource.ResourceEvent{
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod("pod-1", "10.0.0.1", "web")},
+	})
+	select {
+	case event := <-events:
+		assert.Equal(t, resource.AddOP, event.Operation)
+		assert.Len(t, event.Res, 1)
+	case <-ctx.Done():
+		t.Fatal("add event not received")
+	}
+}
@@ -2,6 +2,8 @@ package configs
 
 type MetaSourceConfig struct {
 	HttpServer *HTTPServerConfig `json:"http_server" mapstructure:"http_server"`
+	// 提供gRPC Sync/Fetch服务, 分别对应/push和/fetch
+	GRPCServer *GRPCServerConfig `json:"grpc_server" mapstructure:"grpc_server"`
 
 	FetchSource       *FetchSourceConfig       `json:"fetch_source" mapstructure:"fetch_source"`
 	AcceptEventSource *AcceptEventSourceConfig `json:"accept_event_source" mapstructure:"accept_event_source"`
@@ -9,14 +11,33 @@ type MetaSourceConfig struct {
 
 	Exporter *ExporterConfig `json:"exporter" mapstructure:"exporter"`
 	Querier  *QuerierConfig  `json:"querier" mapstructure:"querier"`
+
+	Snapshot *SnapshotConfig `json:"snapshot" mapstructure:"snapshot"`
+
+	// MetaSource就绪前需要接收到全量数据的集群, 为空时接收到任意集群的全量数据即就绪
+	ExpectedClusterIDs []string `json:"expected_cluster_ids" mapstructure:"expected_cluster_ids"`
 }
 
 type FetchSourceConfig struct {
 	// SourceConfig
 	SourceAddr   string `json:"source_addr" mapstructure:"source_addr"`
 	FetchedTypes string `json:"fetched_types" mapstructure:"fetched_types"`
+
+	// 期望上游推送的编码(json/gob)和压缩方式(gzip/zstd), 上游不支持时回退为不压缩的JSON
+	Encoding    string `json:"encoding" mapstructure:"encoding"`
+	Compression string `json:"compression" mapstructure:"compression"`
+	// 获取数据的协议, websocket(默认): 请求/fetch; grpc: SourceAddr为上游的gRPC地址
+	Transport string `json:"transport" mapstructure:"transport"`
+	// 连接上游使用的证书和Bearer Token
+	TLS         *TLSConfig `json:"tls" mapstructure:"tls"`
+	BearerToken string     `json:"bearer_token" mapstructure:"bearer_token"`
 }
 
+const (
+	TransportWebsocket = "websocket"
+	TransportGRPC      = "grpc"
+)
+
 type AcceptEventSourceConfig struct {
 	EnableAcceptServer bool `json:"enable_accept_server" mapstructure:"enable_accept_server"`
 
@@ -28,14 +49,74 @@ type KubeSourceConfig struct {
 	KubeAuthType   string `json:"kube_auth_type" mapstructure:"kube_auth_type"`
 	KubeAuthConfig string `json:"kube_auth_config" mapstructure:"kube_auth_config"`
 	ClusterID      string `json:"cluster_id" mapstructure:"cluster_id"`
+	// 监控kube_auth_config(kubeconfig文件或目录)中的每个context, ClusterID为context名称, 忽略cluster_id
+	AllContexts bool `json:"all_contexts" mapstructure:"all_contexts"`
 
 	IsEndpointsNeeded bool `json:"is_endpoints_needed" mapstructure:"is_endpoints_needed"`
+	// Endpoints的来源, selector(默认): 根据Service的Selector匹配Pod; endpointslice: 监控EndpointSlice
+	EndpointsSource string `json:"endpoints_source" mapstructure:"endpoints_source"`
+	// 监控ReplicaSet/Deployment/StatefulSet/DaemonSet/Job/CronJob, 用于解析Pod真实的工作负载
+	IsWorkloadNeeded bool `json:"is_workload_needed" mapstructure:"is_workload_needed"`
+	// 监控Namespace, 提供Namespace的标签/注解/状态
+	IsNamespaceNeeded bool `json:"is_namespace_needed" mapstructure:"is_namespace_needed"`
+
+	// 只监控这些Namespace下的资源, 为空时监控全部Namespace; Node, Namespace等集群级资源不受限制
+	Namespaces []string `json:"namespaces" mapstructure:"namespaces"`
+	// 按资源类型(pod, service, node等)过滤List/Watch的结果, 支持${ENV}引用环境变量
+	// 例如 pod: {field_selector: spec.nodeName=${NODE_NAME}} 只监控当前节点上的Pod
+	Selectors map[string]SelectorConfig `json:"selectors" mapstructure:"selectors"`
+
+	// 节点模式, 用于DaemonSet部署的Agent: 只监控本节点上的Pod, Service和Node从上游MetaSource获取
+	NodeLocal *NodeLocalConfig `json:"node_local" mapstructure:"node_local"`
+
+	// 定期对比缓存与Informer, 补发丢失的删除事件, 单位秒, 默认300
+	ReconcileInterval int `json:"reconcile_interval" mapstructure:"reconcile_interval"`
+	// 等待Informer首次同步的时间, 超时后在后台继续等待, 单位秒, 默认300
+	CacheSyncTimeout int `json:"cache_sync_timeout" mapstructure:"cache_sync_timeout"`
 }
 
+type NodeLocalConfig struct {
+	// 当前节点名称, 默认读取环境变量NODE_NAME
+	NodeName string `json:"node_name" mapstructure:"node_name"`
+	// 上游MetaSource地址, 从其/fetch获取集群全部的Service和Node; 为空时仍从APIServer获取
+	UpstreamAddr string `json:"upstream_addr" mapstructure:"upstream_addr"`
+	// 期望上游推送的编码(json/gob)和压缩方式(gzip/zstd)
+	Encoding    string `json:"encoding" mapstructure:"encoding"`
+	Compression string `json:"compression" mapstructure:"compression"`
+	// 连接上游使用的证书和Bearer Token
+	TLS         *TLSConfig `json:"tls" mapstructure:"tls"`
+	BearerToken string     `json:"bearer_token" mapstructure:"bearer_token"`
+}
+
+type SelectorConfig struct {
+	LabelSelector string `json:"label_selector" mapstructure:"label_selector"`
+	FieldSelector string `json:"field_selector" mapstructure:"field_selector"`
+}
+
+const (
+	EndpointsFromSelector      = "selector"
+	EndpointsFromEndpointSlice = "endpointslice"
+)
+
 type ExporterConfig struct {
 	// ExportConfig
-	RemoteWriteAddr   string `json:"remote_write_addr" mapstructure:"remote_write_addr"`
-	EnableFetchServer bool   `json:"enable_fetch_server" mapstructure:"enable_fetch_server"`
+	RemoteWriteAddr string `json:"remote_write_addr" mapstructure:"remote_write_addr"`
+	// 通过gRPC Sync流推送到该地址, 与RemoteWriteAddr可以同时配置
+	GRPCRemoteWriteAddr string `json:"grpc_remote_write_addr" mapstructure:"grpc_remote_write_addr"`
+	EnableFetchServer   bool   `json:"enable_fetch_server" mapstructure:"enable_fetch_server"`
+	// fetcher断线续传保留的事件数量, 默认10000, 小于0时不保留, fetcher重连后总是获取全量数据
+	FetchEventLogSize int `json:"fetch_event_log_size" mapstructure:"fetch_event_log_size"`
+
+	// 远端不可用时暂存增量事件的WAL文件路径, 为空时不暂存, 远端恢复后全量初始化
+	SpoolPath string `json:"spool_path" mapstructure:"spool_path"`
+	// WAL大小上限, 单位字节, 默认64MB, 超过后远端恢复时全量初始化
+	SpoolMaxBytes int64 `json:"spool_max_bytes" mapstructure:"spool_max_bytes"`
+	// 推送的编码(json/gob)和压缩方式(gzip/zstd), 默认为不压缩的JSON, 非默认值需要远端同样支持
+	PushEncoding    string `json:"push_encoding" mapstructure:"push_encoding"`
+	PushCompression string `json:"push_compression" mapstructure:"push_compression"`
+	// 连接远端使用的证书和Bearer Token, 同时用于HTTP和gRPC推送
+	TLS         *TLSConfig `json:"tls" mapstructure:"tls"`
+	BearerToken string     `json:"bearer_token" mapstructure:"bearer_token"`
 
 	// Deprecated use EnableFetchServer instead
 	FetchServerPort int `json:"fetch_server_port" mapstructure:"fetch_server_port"`
@@ -44,11 +125,76 @@ type ExporterConfig struct {
 type QuerierConfig struct {
 	EnableQueryServer bool `json:"enable_query_server" mapstructure:"enable_query_server"`
 	IsSingleCluster   bool `json:"is_single_cluster" mapstructure:"is_single_cluster"`
+	// 已删除的Pod/Service/Node保留的时长, 用于按时间查询延迟到达的数据, 单位秒, 0表示不保留
+	DeletedRetention int `json:"deleted_retention" mapstructure:"deleted_retention"`
+	// 提供/watch接口, 通过SSE推送按集群/Namespace/类型/标签过滤后的变更事件
+	EnableWatchServer bool `json:"enable_watch_server" mapstructure:"enable_watch_server"`
 
 	// Deprecated
 	QueryServerPort int `json:"query_server_port" mapstructure:"query_server_port"`
 }
 
+// SnapshotConfig MetaSource定期将接收到的资源和Agent同步进度保存到本地, 重启时恢复
+type SnapshotConfig struct {
+	// 快照文件路径, 为空时不保存快照
+	Path string `json:"path" mapstructure:"path"`
+	// 保存快照的间隔, 单位秒, 默认60
+	Interval int `json:"interval" mapstructure:"interval"`
+}
+
 type HTTPServerConfig struct {
 	Port int `json:"port" mapstructure:"port"`
+	// 开启HTTPS, 配置CAFile时要求调用方提供客户端证书(mTLS)
+	TLS *TLSConfig `json:"tls" mapstructure:"tls"`
+	// 调用方的凭证, 为空时不校验; 同时用于gRPC服务
+	Auth *AuthConfig `json:"auth" mapstructure:"auth"`
+	// 默认的数据访问范围和脱敏规则, 凭证未单独配置时使用
+	Policy *PolicyConfig `json:"policy" mapstructure:"policy"`
+	// 提供/admin/status, 展示连接的Fetcher, Agent同步进度, 集群资源数量和Exporter状态
+	EnableAdmin bool `json:"enable_admin" mapstructure:"enable_admin"`
+}
+
+type GRPCServerConfig struct {
+	Port int `json:"port" mapstructure:"port"`
+	// 开启TLS, 配置CAFile时要求调用方提供客户端证书(mTLS)
+	TLS *TLSConfig `json:"tls" mapstructure:"tls"`
+}
+
+// TLSConfig 证书配置, 服务端和调用方共用
+type TLSConfig struct {
+	CertFile string `json:"cert_file" mapstructure:"cert_file"`
+	KeyFile  string `json:"key_file" mapstructure:"key_file"`
+	// 服务端: 校验客户端证书的CA; 调用方: 校验服务端证书的CA, 为空时使用系统CA
+	CAFile string `json:"ca_file" mapstructure:"ca_file"`
+
+	// 仅调用方使用
+	ServerName         string `json:"server_name" mapstructure:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" mapstructure:"insecure_skip_verify"`
+}
+
+type AuthConfig struct {
+	Credentials []CredentialConfig `json:"credentials" mapstructure:"credentials"`
+}
+
+// CredentialConfig 调用方通过Token或客户端证书的CommonName识别
+type CredentialConfig struct {
+	Name       string `json:"name" mapstructure:"name"`
+	Token      string `json:"token" mapstructure:"token"`
+	CommonName string `json:"common_name" mapstructure:"common_name"`
+	// 允许访问的路由, 如/push, /fetch, 为空时不限制
+	Routes []string `json:"routes" mapstructure:"routes"`
+	// 允许推送的ClusterID, 为空时不限制
+	ClusterIDs []string `json:"cluster_ids" mapstructure:"cluster_ids"`
+	// 可以查询和获取的数据范围和脱敏规则, 为空时使用http_server.policy
+	Policy *PolicyConfig `json:"policy" mapstructure:"policy"`
+}
+
+// PolicyConfig 限制/query, /fetch, /watch返回的数据, 并在数据离开进程前脱敏
+type PolicyConfig struct {
+	// 可以访问的集群和Namespace, 为空时不限制
+	ClusterIDs []string `json:"cluster_ids" mapstructure:"cluster_ids"`
+	Namespaces []string `json:"namespaces" mapstructure:"namespaces"`
+	// 移除或哈希处理的label/annotation/selector key, 以*结尾时按前缀匹配
+	StripKeys []string `json:"strip_keys" mapstructure:"strip_keys"`
+	HashKeys  []string `json:"hash_keys" mapstructure:"hash_keys"`
 }
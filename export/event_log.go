@@ -0,0 +1,60 @@
+package export
+
+import "github.com/CloudDetail/metadata/model/resource"
+
+// DefaultEventLogSize FetcherServer默认保留的事件数量
+const DefaultEventLogSize = 10000
+
+type loggedEvent struct {
+	sequence uint64
+	event    *resource.ResourceEvent
+}
+
+// eventLog 固定大小的环形事件日志, 用于fetcher断线重连后补发遗漏的事件
+type eventLog struct {
+	entries []loggedEvent
+	start   int
+	count   int
+}
+
+func newEventLog(size int) *eventLog {
+	if size < 0 {
+		size = 0
+	}
+	return &eventLog{entries: make([]loggedEvent, size)}
+}
+
+func (l *eventLog) append(sequence uint64, event *resource.ResourceEvent) {
+	if len(l.entries) == 0 {
+		return
+	}
+	if l.count < len(l.entries) {
+		l.entries[(l.start+l.count)%len(l.entries)] = loggedEvent{sequence: sequence, event: event}
+		l.count++
+		return
+	}
+	l.entries[l.start] = loggedEvent{sequence: sequence, event: event}
+	l.start = (l.start + 1) % len(l.entries)
+}
+
+// since 返回序号大于sequence的全部事件, 日志已经不能覆盖时返回false
+// current为最新的事件序号
+func (l *eventLog) since(sequence uint64, current uint64) ([]*resource.ResourceEvent, bool) {
+	if sequence > current {
+		return nil, false
+	}
+	if sequence == current {
+		return []*resource.ResourceEvent{}, true
+	}
+	if l.count == 0 || l.entries[l.start].sequence > sequence+1 {
+		return nil, false
+	}
+	events := make([]*resource.ResourceEvent, 0, current-sequence)
+	for i := 0; i < l.count; i++ {
+		entry := l.entries[(l.start+i)%len(l.entries)]
+		if entry.sequence > sequence {
+			events = append(events, entry.event)
+		}
+	}
+	return events, true
+}
@@ -26,3 +26,17 @@ func (e *Exporter) SetupResourcesRef(resources *resource.Resources) {
 		exporter.SetupResourcesRef(resources)
 	}
 }
+
+// Stop 依次停止全部Exporter
+func (e *Exporter) Stop() {
+	for _, exporter := range e.Exporters {
+		StopExporter(exporter)
+	}
+}
+
+// StopExporter 停止实现了Stop的Exporter, 停止完成后返回
+func StopExporter(exporter resource.Exporter) {
+	if stopper, ok := exporter.(interface{ Stop() }); ok {
+		stopper.Stop()
+	}
+}
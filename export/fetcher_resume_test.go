@@ -0,0 +1,253 @@
+package export_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamFetcher struct {
+	cancel   context.CancelFunc
+	received chan *resource.SyncRequest
+	done     chan struct{}
+}
+
+func startStreamFetch(t *testing.T, srv *export.FetcherServer, request *resource.FetchRequest) *streamFetcher {
+	return startScopedFetch(t, srv, nil, request)
+}
+
+func startScopedFetch(t *testing.T, srv *export.FetcherServer, p *policy.Policy, request *resource.FetchRequest) *streamFetcher {
+	ctx, cancel := context.WithCancel(policy.WithPolicy(context.Background(), p))
+	f := &streamFetcher{
+		cancel:   cancel,
+		received: make(chan *resource.SyncRequest, 16),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(f.done)
+		srv.FetchWithStream(ctx, request, "test", func(data []byte) error {
+			var syncReq resource.SyncRequest
+			require.NoError(t, json.Unmarshal(data, &syncReq))
+			f.received <- &syncReq
+			return nil
+		})
+	}()
+	return f
+}
+
+func (f *streamFetcher) next(t *testing.T) *resource.SyncRequest {
+	select {
+	case syncReq := <-f.received:
+		return syncReq
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for fetched events")
+		return nil
+	}
+}
+
+func (f *streamFetcher) stop() {
+	f.cancel()
+	<-f.done
+}
+
+func podEvent(uid string) *resource.ResourceEvent {
+	return &resource.ResourceEvent{
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod(uid, "default", "demo")},
+	}
+}
+
+func TestFetchResume(t *testing.T) {
+	srv := export.NewFetcherServer().WithEventLogSize(3)
+	pods := resource.NewResources(resource.PodType, []*resource.Resource{})
+	srv.SetupResourcesRef(pods)
+
+	var progress resource.FetchProgress
+	fetcher := startStreamFetch(t, srv, progress.Request(nil))
+	initReq := fetcher.next(t)
+	require.True(t, progress.Accept(initReq))
+	assert.NotEmpty(t, initReq.Epoch)
+	assert.Equal(t, uint64(1), initReq.Sequence)
+	require.Len(t, initReq.Events, 1)
+	assert.Equal(t, resource.ResetOP, initReq.Events[0].Operation)
+
+	srv.ExportResourceEvents(podEvent("pod-1"))
+	syncReq := fetcher.next(t)
+	require.True(t, progress.Accept(syncReq))
+	assert.Equal(t, uint64(2), syncReq.Sequence)
+	fetcher.stop()
+
+	// 断线期间的事件仍在日志中, 重连后只推送遗漏的事件
+	srv.ExportResourceEvents(podEvent("pod-2"))
+	fetcher = startStreamFetch(t, srv, progress.Request(nil))
+	resumeReq := fetcher.next(t)
+	require.True(t, progress.Accept(resumeReq))
+	assert.Equal(t, uint64(3), resumeReq.Sequence)
+	require.Len(t, resumeReq.Events, 1)
+	assert.Equal(t, resource.AddOP, resumeReq.Events[0].Operation)
+	assert.Equal(t, "pod-2", resumeReq.Events[0].Res[0].Name)
+	fetcher.stop()
+
+	// 没有新事件时首条消息为空, 且不会被重复处理
+	fetcher = startStreamFetch(t, srv, progress.Request(nil))
+	emptyReq := fetcher.next(t)
+	assert.Empty(t, emptyReq.Events)
+	assert.False(t, progress.Accept(emptyReq))
+	fetcher.stop()
+
+	// 日志已经不能覆盖遗漏的事件, 回退为全量数据
+	for _, uid := range []string{"pod-3", "pod-4", "pod-5", "pod-6"} {
+		srv.ExportResourceEvents(podEvent(uid))
+	}
+	fetcher = startStreamFetch(t, srv, progress.Request(nil))
+	resetReq := fetcher.next(t)
+	require.True(t, progress.Accept(resetReq))
+	assert.Equal(t, uint64(7), resetReq.Sequence)
+	require.Len(t, resetReq.Events, 1)
+	assert.Equal(t, resource.ResetOP, resetReq.Events[0].Operation)
+	fetcher.stop()
+
+	// 服务端重启后epoch不同, 同样回退为全量数据
+	restarted := export.NewFetcherServer()
+	restarted.SetupResourcesRef(pods)
+	fetcher = startStreamFetch(t, restarted, progress.Request(nil))
+	resetReq = fetcher.next(t)
+	require.True(t, progress.Accept(resetReq))
+	require.Len(t, resetReq.Events, 1)
+	assert.Equal(t, resource.ResetOP, resetReq.Events[0].Operation)
+	fetcher.stop()
+}
+
+func TestFetchPolicy(t *testing.T) {
+	srv := export.NewFetcherServer()
+	pods := resource.NewResources(resource.PodType, []*resource.Resource{
+		testPod("pod-1", "team-a", "web"),
+		testPod("pod-2", "team-b", "web"),
+	})
+	srv.SetupResourcesRef(pods)
+
+	p := policy.New().WithNamespaces("team-a").WithHashKeys("app")
+	scoped := startScopedFetch(t, srv, p, &resource.FetchRequest{})
+	defer scoped.stop()
+	all := startStreamFetch(t, srv, &resource.FetchRequest{})
+	defer all.stop()
+
+	initReq := scoped.next(t)
+	require.Len(t, initReq.Events, 1)
+	require.Len(t, initReq.Events[0].Res, 1)
+	assert.Equal(t, "pod-1", initReq.Events[0].Res[0].Name)
+	assert.NotEqual(t, "web", initReq.Events[0].Res[0].Labels()["app"])
+	assert.Len(t, all.next(t).Events[0].Res, 2)
+
+	srv.ExportResourceEvents(&resource.ResourceEvent{
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod("pod-3", "team-b", "web")},
+	})
+	srv.ExportResourceEvents(&resource.ResourceEvent{
+		ResourceType: resource.PodType,
+		Operation:    resource.AddOP,
+		Res:          []*resource.Resource{testPod("pod-4", "team-a", "web")},
+	})
+	assert.Equal(t, "pod-3", all.next(t).Events[0].Res[0].Name)
+	assert.Equal(t, "pod-4", all.next(t).Events[0].Res[0].Name)
+	// team-b的事件不会推送给scoped
+	syncReq := scoped.next(t)
+	assert.Equal(t, "pod-4", syncReq.Events[0].Res[0].Name)
+	assert.Equal(t, uint64(3), syncReq.Sequence)
+}
+
+func TestFetchResumeLoggedReset(t *testing.T) {
+	srv := export.NewFetcherServer()
+	pods := resource.NewResources(resource.PodType, []*resource.Resource{
+		testPod("pod-1", "default", "web"),
+		testPod("pod-2", "default", "web"),
+		testPod("pod-3", "default", "web"),
+	})
+	pods.SetExporter(srv)
+
+	// 删除Pod会原地修改ResList, 日志中的Reset事件不受影响
+	pods.DeleteResource(testPod("pod-1", "default", "web"))
+
+	fetcher := startStreamFetch(t, srv, &resource.FetchRequest{})
+	initReq := fetcher.next(t)
+	fetcher.stop()
+
+	fetcher = startStreamFetch(t, srv, &resource.FetchRequest{Epoch: initReq.Epoch})
+	resumeReq := fetcher.next(t)
+	fetcher.stop()
+	require.Len(t, resumeReq.Events, 2)
+	assert.Equal(t, resource.ResetOP, resumeReq.Events[0].Operation)
+	var names []string
+	for _, res := range resumeReq.Events[0].Res {
+		names = append(names, string(res.ResUID))
+	}
+	assert.Equal(t, []string{"pod-1", "pod-2", "pod-3"}, names)
+	assert.Equal(t, resource.DeleteOP, resumeReq.Events[1].Operation)
+}
+
+func TestSetupResourcesRefConcurrently(t *testing.T) {
+	srv := export.NewFetcherServer()
+	// 多集群时各集群并行注册资源
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(clusterID string) {
+			defer wg.Done()
+			pods := resource.NewResources(resource.PodType, []*resource.Resource{})
+			pods.ClusterID = clusterID
+			srv.SetupResourcesRef(pods)
+		}(strconv.Itoa(i))
+		fetcher := startStreamFetch(t, srv, &resource.FetchRequest{})
+		fetcher.next(t)
+		fetcher.stop()
+	}
+	wg.Wait()
+
+	fetcher := startStreamFetch(t, srv, &resource.FetchRequest{})
+	defer fetcher.stop()
+	assert.Len(t, fetcher.next(t).Events, 8)
+}
+
+func TestSlowFetcherDoesNotBlockExport(t *testing.T) {
+	srv := export.NewFetcherServer()
+	srv.SetupResourcesRef(resource.NewResources(resource.PodType, []*resource.Resource{}))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	go func() {
+		var once sync.Once
+		fetchErr <- srv.FetchWithStream(context.Background(), &resource.FetchRequest{}, "slow", func(data []byte) error {
+			once.Do(func() { close(started) })
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// 不读取数据的fetcher不会阻塞事件的处理, 队列满后被断开
+	begin := time.Now()
+	for i := 0; i < 2000; i++ {
+		srv.ExportResourceEvents(podEvent("pod-" + strconv.Itoa(i)))
+	}
+	assert.Less(t, time.Since(begin), 5*time.Second)
+
+	close(release)
+	select {
+	case err := <-fetchErr:
+		assert.ErrorContains(t, err, "too slow")
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow fetcher is not disconnected")
+	}
+}
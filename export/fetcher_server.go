@@ -2,43 +2,73 @@ package export
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/codec"
+	"github.com/CloudDetail/metadata/model/policy"
 	"github.com/CloudDetail/metadata/model/resource"
 	"github.com/gorilla/websocket"
 )
 
+// fetcherQueueSize 每个fetcher待推送的事件数量上限, 队列已满时断开该fetcher, 重连后通过事件日志续传
+const fetcherQueueSize = 1024
+
 type FetcherServer struct {
-	ctx      context.Context
-	upgrader *websocket.Upgrader
+	// 停止时关闭全部fetcher
+	lifecycle *lifecycle
+	upgrader  *websocket.Upgrader
 
-	resources []*resource.Resources
+	// 多集群时各集群的Watchers并行注册
+	resourcesMux sync.RWMutex
+	resources    []*resource.Resources
 
 	registerFetcher   atomic.Int64
 	unRegisterFetcher atomic.Int64
 
 	fetchers sync.Map
+
+	// 事件日志和事件编号, 同时保证事件按编号顺序放入各fetcher的队列
+	logMux   sync.Mutex
+	epoch    string
+	sequence uint64
+	eventLog *eventLog
 }
 
 func NewFetcherServer() *FetcherServer {
 	srv := &FetcherServer{
-		ctx:       context.Background(),
+		lifecycle: newLifecycle(),
 		upgrader:  &websocket.Upgrader{},
 		resources: []*resource.Resources{},
+		// 进程重启后序号重新计数, 使用启动时间区分
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		eventLog: newEventLog(DefaultEventLogSize),
 	}
 	return srv
 }
 
+// WithEventLogSize 设置用于断线续传的事件日志大小, 为0时fetcher重连后总是获取全量数据
+func (s *FetcherServer) WithEventLogSize(size int) *FetcherServer {
+	s.logMux.Lock()
+	defer s.logMux.Unlock()
+	s.eventLog = newEventLog(size)
+	return s
+}
+
 func (s *FetcherServer) SetupResourcesRef(resources *resource.Resources) {
+	s.resourcesMux.Lock()
 	s.resources = append(s.resources, resources)
+	s.resourcesMux.Unlock()
+	// 事件日志保留的是副本, ResList之后会被原地修改
 	event := &resource.ResourceEvent{
 		ClusterID:    resources.ClusterID,
-		Res:          resources.ResList,
+		Res:          resources.Snapshot(),
 		ResourceType: resources.ResType,
 		Operation:    resource.ResetOP,
 	}
@@ -46,31 +76,55 @@ func (s *FetcherServer) SetupResourcesRef(resources *resource.Resources) {
 	s.ExportResourceEvents(event)
 }
 
+// ExportResourceEvents 放入fetcher的队列不阻塞, 较慢的fetcher不会影响事件的处理和其他fetcher
 func (s *FetcherServer) ExportResourceEvents(event *resource.ResourceEvent) {
-	syncReq := &resource.SyncRequest{
-		Events: []*resource.ResourceEvent{event},
-	}
+	s.logMux.Lock()
+	defer s.logMux.Unlock()
+	s.sequence++
+	sequence := s.sequence
+	s.eventLog.append(sequence, event)
 
-	data, err := json.Marshal(syncReq)
-	if err != nil {
-		return
+	// 每种编码格式和Policy只序列化一次
+	type encodeKey struct {
+		codec  codec.Codec
+		policy *policy.Policy
 	}
+	encoded := map[encodeKey][]byte{}
 
-	idleMax := 10 * time.Second
-	idleTimeout := time.NewTimer(idleMax)
-	defer idleTimeout.Stop()
 	s.fetchers.Range(func(_, value any) bool {
 		fetcher := value.(*Fetcher)
-		_, find := fetcher.FetchedTypes[event.ResourceType]
-		if len(fetcher.FetchedTypes) > 0 && !find {
+		if !fetcher.accept(event.ClusterID, event.ResourceType) {
 			return true
 		}
 
-		idleTimeout.Reset(idleMax)
+		key := encodeKey{codec: fetcher.codec, policy: fetcher.policy}
+		data, find := encoded[key]
+		if !find {
+			scoped := fetcher.policy.FilterEvent(event)
+			if scoped == nil {
+				// 事件不在该fetcher可以访问的范围内
+				return true
+			}
+			syncReq := &resource.SyncRequest{
+				Events:   []*resource.ResourceEvent{scoped},
+				Epoch:    s.epoch,
+				Sequence: sequence,
+			}
+			var err error
+			data, err = fetcher.codec.Marshal(syncReq)
+			if err != nil {
+				log.Printf("failed to encode event for fetcher [%d]: %v", fetcher.ID, err)
+				return true
+			}
+			encoded[key] = data
+		}
+
 		select {
 		case fetcher.sendChan <- data:
-		case <-idleTimeout.C:
-			// 放弃插入,该fetcher已经异常
+		default:
+			// 队列已满, 该fetcher处理过慢或已经异常
+			log.Printf("fetcher [%s] is too slow, disconnect it", fetcher.RemoteAddr)
+			metrics.FetcherSendTimeouts.Inc()
 			s.UnregisterFetcher(fetcher)
 		}
 		return true
@@ -78,7 +132,17 @@ func (s *FetcherServer) ExportResourceEvents(event *resource.ResourceEvent) {
 }
 
 func (s *FetcherServer) FetchWithWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if !s.lifecycle.add() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer s.lifecycle.done()
+
+	// 根据Accept和Accept-Encoding协商推送的数据格式, 并通过响应头告知fetcher
+	fetchCodec := codec.Negotiate(r.Header)
+	respHeader := http.Header{}
+	fetchCodec.SetContentHeaders(respHeader)
+	conn, err := s.upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
 		// TODO return with error
 		log.Printf("Upgrade error: %v\n", err)
@@ -86,65 +150,153 @@ func (s *FetcherServer) FetchWithWS(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 	log.Printf("receive fetch request from %s", conn.RemoteAddr())
-	fetcher, err := s.RegisterFetcher(conn)
+	fetcher, initRequest, err := s.RegisterFetcher(conn, fetchCodec, policy.FromContext(r.Context()))
+	if err != nil {
+		log.Printf("Upgrade error: %v\n", err)
+		return
+	}
 	defer s.UnregisterFetcher(fetcher)
 	log.Printf("add fetcher, fetcher list size: %d", s.registerFetcher.Load()-s.unRegisterFetcher.Load())
+
+	data, err := fetcher.codec.Marshal(initRequest)
 	if err != nil {
-		log.Printf("Upgrade error: %v\n", err)
 		return
 	}
 
-	var initRequest = resource.SyncRequest{
-		Events: []*resource.ResourceEvent{},
+	err = fetcher.PushInitEvent(data)
+	if err != nil {
+		return
+	}
+	fetcher.KeepPush()
+}
+
+// FetchWithStream 通过gRPC Fetch流推送数据, 数据始终使用JSON编码
+func (s *FetcherServer) FetchWithStream(ctx context.Context, request *resource.FetchRequest, remoteAddr string, send func(data []byte) error) error {
+	if !s.lifecycle.add() {
+		return errFetcherServerStopped
+	}
+	defer s.lifecycle.done()
+
+	log.Printf("receive grpc fetch request from %s", remoteAddr)
+	fetcher, initRequest := s.addFetcher(remoteAddr, codec.Default, policy.FromContext(ctx), request)
+	defer s.UnregisterFetcher(fetcher)
+
+	data, err := fetcher.codec.Marshal(initRequest)
+	if err != nil {
+		return err
 	}
-	for _, res := range s.resources {
-		if len(fetcher.FetchedTypes) > 0 {
-			if _, find := fetcher.FetchedTypes[res.ResType]; !find {
-				continue
+	if err = send(data); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fetcher.ctx.Done():
+			return nil
+		case <-fetcher.closed:
+			return errFetcherTooSlow
+		case data := <-fetcher.sendChan:
+			if err := send(data); err != nil {
+				return err
 			}
 		}
+	}
+}
+
+// initRequest 生成fetcher关注的全部资源的Reset事件
+func (s *FetcherServer) initRequest(fetcher *Fetcher) *resource.SyncRequest {
+	var initRequest = &resource.SyncRequest{
+		Events: []*resource.ResourceEvent{},
+	}
+	s.resourcesMux.RLock()
+	resources := s.resources
+	s.resourcesMux.RUnlock()
+	for _, res := range resources {
+		if !fetcher.accept(res.ClusterID, res.ResType) {
+			continue
+		}
 
-		res.ExportMux.RLock()
-		initRequest.Events = append(initRequest.Events, &resource.ResourceEvent{
+		event := fetcher.policy.FilterEvent(&resource.ResourceEvent{
 			ClusterID:    res.ClusterID,
-			Res:          res.ResList,
+			Res:          res.Snapshot(),
 			ResourceType: res.ResType,
 			Operation:    resource.ResetOP,
 		})
-		res.ExportMux.RUnlock()
+		if event != nil {
+			initRequest.Events = append(initRequest.Events, event)
+		}
 	}
+	return initRequest
+}
 
-	data, err := json.Marshal(initRequest)
-	if err != nil {
-		return
+// resumeRequest 生成fetcher断线期间遗漏的事件, 事件日志已经不能覆盖时返回false
+func (s *FetcherServer) resumeRequest(fetcher *Fetcher, request *resource.FetchRequest) (*resource.SyncRequest, bool) {
+	if len(request.Epoch) == 0 || request.Epoch != s.epoch {
+		return nil, false
 	}
-
-	err = fetcher.PushInitEvent(data)
-	if err != nil {
-		return
+	events, ok := s.eventLog.since(request.LastSequence, s.sequence)
+	if !ok {
+		return nil, false
 	}
-	fetcher.KeepPush()
+	var resumeRequest = &resource.SyncRequest{
+		Events: []*resource.ResourceEvent{},
+	}
+	for _, event := range events {
+		if !fetcher.accept(event.ClusterID, event.ResourceType) {
+			continue
+		}
+		if event = fetcher.policy.FilterEvent(event); event != nil {
+			resumeRequest.Events = append(resumeRequest.Events, event)
+		}
+	}
+	return resumeRequest, true
 }
 
 type FetchResponse struct {
 }
 
-func (s *FetcherServer) RegisterFetcher(conn *websocket.Conn) (*Fetcher, error) {
+// RegisterFetcher p为调用方的Policy, 为nil时不做限制
+func (s *FetcherServer) RegisterFetcher(conn *websocket.Conn, fetchCodec codec.Codec, p *policy.Policy) (*Fetcher, *resource.SyncRequest, error) {
 	var request resource.FetchRequest
 	err := conn.ReadJSON(&request)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	f, initRequest := s.addFetcher(conn.RemoteAddr().String(), fetchCodec, p, &request)
+	f.conn = conn
+	return f, initRequest, nil
+}
+
+// addFetcher 注册fetcher并生成首条推送的消息
+// 注册和生成首条消息在同一把锁内完成, 保证之后推送的事件与首条消息连续
+func (s *FetcherServer) addFetcher(remoteAddr string, fetchCodec codec.Codec, p *policy.Policy, request *resource.FetchRequest) (*Fetcher, *resource.SyncRequest) {
 	f := &Fetcher{
 		ID:           s.registerFetcher.Add(1),
-		ctx:          s.ctx,
+		ctx:          s.lifecycle.ctx,
 		FetchedTypes: fetchedTypesMap(request.ResourceTypes),
-		conn:         conn,
-		sendChan:     make(chan []byte),
+		ClusterID:    request.ClusterID,
+		RemoteAddr:   remoteAddr,
+		codec:        fetchCodec,
+		policy:       p,
+		sendChan:     make(chan []byte, fetcherQueueSize),
+		closed:       make(chan struct{}),
+	}
+
+	s.logMux.Lock()
+	defer s.logMux.Unlock()
+	initRequest, resumed := s.resumeRequest(f, request)
+	if resumed {
+		log.Printf("fetcher [%s] resume from sequence %d, %d events missed", remoteAddr, request.LastSequence, len(initRequest.Events))
+	} else {
+		initRequest = s.initRequest(f)
 	}
+	initRequest.Epoch = s.epoch
+	initRequest.Sequence = s.sequence
 	s.fetchers.Store(f.ID, f)
-	return f, nil
+	metrics.FetcherConnected.Inc()
+	return f, initRequest
 }
 
 func fetchedTypesMap(types []resource.ResType) map[resource.ResType]struct{} {
@@ -162,12 +314,20 @@ func (s *FetcherServer) UnregisterFetcher(f *Fetcher) {
 	if f.isClosed.Swap(true) {
 		return
 	}
+	close(f.closed)
 	s.fetchers.Delete(f.ID)
-	log.Printf("unregister fetcher [%s], fetcher list size: %d", f.conn.RemoteAddr().String(), s.registerFetcher.Load()-s.unRegisterFetcher.Add(1))
+	metrics.FetcherConnected.Dec()
+	log.Printf("unregister fetcher [%s], fetcher list size: %d", f.RemoteAddr, s.registerFetcher.Load()-s.unRegisterFetcher.Add(1))
 }
 
+var (
+	errFetcherServerStopped = errors.New("fetcher server is stopped")
+	errFetcherTooSlow       = errors.New("fetcher is too slow to receive events, reconnect to resume")
+)
+
+// Stop 关闭全部fetcher, 所有连接退出后返回
 func (s *FetcherServer) Stop() {
-	s.ctx.Done()
+	s.lifecycle.stop()
 }
 
 type Fetcher struct {
@@ -177,11 +337,32 @@ type Fetcher struct {
 
 	ctx          context.Context
 	FetchedTypes map[resource.ResType]struct{}
-	// Web Socket
+	// 不为空时只推送该集群的资源
+	ClusterID  string
+	RemoteAddr string
+	// Web Socket, 通过gRPC获取数据时为nil
 	conn *websocket.Conn
+	// 推送数据的编码和压缩方式
+	codec codec.Codec
+	// 限制推送的数据范围并脱敏, 为nil时不做限制
+	policy *policy.Policy
 
 	// Send
 	sendChan chan []byte
+	// 注销后关闭, 推送的goroutine随之退出
+	closed chan struct{}
+}
+
+// accept fetcher是否获取该集群的该类资源
+func (f *Fetcher) accept(clusterID string, resType resource.ResType) bool {
+	if len(f.ClusterID) > 0 && f.ClusterID != clusterID {
+		return false
+	}
+	if len(f.FetchedTypes) == 0 {
+		return true
+	}
+	_, find := f.FetchedTypes[resType]
+	return find
 }
 
 func (f *Fetcher) PushInitEvent(data []byte) error {
@@ -190,16 +371,24 @@ func (f *Fetcher) PushInitEvent(data []byte) error {
 
 func (f *Fetcher) KeepPush() {
 	heartBeatTicker := time.NewTicker(30 * time.Second)
+	defer heartBeatTicker.Stop()
 	for {
 		select {
 		case <-heartBeatTicker.C:
 			err := f.conn.WriteMessage(websocket.PingMessage, nil)
 			if err != nil {
 				// 心跳检查失败
-				log.Printf("fetcher [%s] failed at heart beat", f.conn.RemoteAddr().String())
+				log.Printf("fetcher [%s] failed at heart beat", f.RemoteAddr)
 				return
 			}
 		case <-f.ctx.Done():
+			// 通知fetcher服务端正常关闭
+			f.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is stopping"),
+				time.Now().Add(time.Second))
+			return
+		case <-f.closed:
+			// 已被注销, 断开连接后fetcher重连并续传
 			return
 		case data := <-f.sendChan:
 			err := f.conn.WriteMessage(websocket.BinaryMessage, data)
@@ -2,35 +2,48 @@ package export
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/codec"
 	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/rpc"
+	"github.com/CloudDetail/metadata/server"
+	"google.golang.org/grpc"
 )
 
 var _ resource.Exporter = &HTTPExporter{}
 
 const PushPath = "/push"
 
+// FlushTimeout 停止时推送剩余事件的超时时间
+const FlushTimeout = 5 * time.Second
+
 type HTTPExporter struct {
 	RemoteAddr string
 	// 服务端出现严重错误时
 	// 控制客户端停止发送
-	IsStopPush       bool
-	IsServerNotReady bool
+	// 由推送协程写入, 在Informer的协程中读取
+	IsStopPush       atomic.Bool
+	IsServerNotReady atomic.Bool
 
 	client *http.Client
 
 	messageCounter int
 	LastCheckPoint *resource.CheckPoint
 
-	// 初始化时统计全部资源
+	// 初始化时统计全部资源, 多集群时各集群的Watchers并行注册
+	resourcesMux sync.RWMutex
 	resourcesRef []*resource.Resources
 
 	eventChan chan *resource.ResourceEvent
@@ -40,25 +53,94 @@ type HTTPExporter struct {
 	AgentIndex int64
 
 	failedTime int
+
+	// 远端不可用时暂存增量事件, 为nil时丢弃事件并在远端恢复后全量初始化
+	spool *Spool
+	// canSpool的结果, 供Informer的协程读取
+	spoolable atomic.Bool
+	// 推送数据的编码和压缩方式
+	codec codec.Codec
+	// 替代/push的推送方式, 为nil时使用HTTP
+	pusher Pusher
+	// 通过/push推送时携带的Bearer Token
+	bearerToken string
+	// 通过gRPC推送时关闭连接
+	closeConn func() error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// KeepPushingEvent退出后关闭
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Pusher 将同步请求发送到远端并返回远端的回复, CheckPoint语义与/push相同
+type Pusher interface {
+	Push(syncReq *resource.SyncRequest) (*resource.SyncResponse, error)
+}
+
+type HTTPExporterOptions struct {
+	// 远端不可用期间的事件写入Spool, 远端恢复后增量重放
+	Spool *Spool
+	// 推送数据的编码和压缩方式, 默认为不压缩的JSON
+	// 非默认值需要远端同样支持, 响应的格式由远端根据Accept协商
+	Codec codec.Codec
+	// 替代/push的推送方式, 如gRPC Sync流, 设置后忽略Codec
+	Pusher Pusher
+
+	// 连接远端使用的TLS配置, 用于https地址和客户端证书(mTLS)
+	TLSConfig *tls.Config
+	// 通过/push推送时携带Authorization: Bearer <token>, gRPC推送通过WithBearerToken配置
+	BearerToken string
 }
 
 func NewHTTPExporter(remoteAddr string) *HTTPExporter {
-	if !strings.HasPrefix(remoteAddr, "http") {
-		remoteAddr = "http://" + remoteAddr
+	return NewHTTPExporterWithOptions(remoteAddr, HTTPExporterOptions{})
+}
+
+// NewHTTPExporterWithSpool 远端不可用期间的事件写入spool, 远端恢复后增量重放
+func NewHTTPExporterWithSpool(remoteAddr string, spool *Spool) *HTTPExporter {
+	return NewHTTPExporterWithOptions(remoteAddr, HTTPExporterOptions{Spool: spool})
+}
+
+// NewGRPCExporter 通过gRPC Sync流推送, 远端地址为MetaSource的gRPC地址
+func NewGRPCExporter(target string, opts HTTPExporterOptions, dialOpts ...grpc.DialOption) (*HTTPExporter, error) {
+	conn, err := rpc.Dial(target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	opts.Pusher = rpc.NewSyncPusher(conn)
+	exporter := NewHTTPExporterWithOptions(target, opts)
+	exporter.closeConn = conn.Close
+	return exporter, nil
+}
+
+func NewHTTPExporterWithOptions(remoteAddr string, opts HTTPExporterOptions) *HTTPExporter {
+	if opts.Pusher == nil {
+		if !strings.HasPrefix(remoteAddr, "http") {
+			remoteAddr = "http://" + remoteAddr
+		}
+		remoteAddr = strings.TrimSuffix(remoteAddr, "/") + PushPath
 	}
-	remoteAddr = strings.TrimSuffix(remoteAddr, "/") + PushPath
 
+	ctx, cancel := context.WithCancel(context.Background())
 	exporter := &HTTPExporter{
-		RemoteAddr:       remoteAddr,
-		IsStopPush:       false,
-		IsServerNotReady: true,
-		client:           createHTTPClient(),
-		messageCounter:   0,
-		LastCheckPoint:   nil,
-		resourcesRef:     []*resource.Resources{},
-		eventChan:        make(chan *resource.ResourceEvent),
-		batch:            []*resource.ResourceEvent{},
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+		RemoteAddr:     remoteAddr,
+		client:         createHTTPClient(opts.TLSConfig),
+		messageCounter: 0,
+		LastCheckPoint: nil,
+		resourcesRef:   []*resource.Resources{},
+		eventChan:      make(chan *resource.ResourceEvent),
+		batch:          []*resource.ResourceEvent{},
+		spool:          opts.Spool,
+		codec:          opts.Codec,
+		pusher:         opts.Pusher,
+		bearerToken:    opts.BearerToken,
 	}
+	exporter.IsServerNotReady.Store(true)
 
 	exporter.ticker = time.NewTicker(3 * time.Second)
 
@@ -67,11 +149,22 @@ func NewHTTPExporter(remoteAddr string) *HTTPExporter {
 }
 
 func (h *HTTPExporter) CheckIsServerReadyAndInit() bool {
-	// 清空未初始化之前batch和channel中的数据
+	// 清空未初始化之前batch和channel中的数据, 由之后的全量初始化恢复
+	dropped := len(h.batch)
 	for len(h.eventChan) > 0 {
 		<-h.eventChan
+		dropped++
 	}
+	h.dropEvents(dropped)
 	h.batch = []*resource.ResourceEvent{}
+	// 丢弃事件后增量同步已经不连续, 全量初始化成功之前不能再暂存增量事件
+	h.setLastCheckPoint(nil)
+	if h.spool != nil {
+		// 全量初始化后不再需要暂存的增量事件
+		if err := h.spool.Reset(); err != nil {
+			log.Printf("failed to reset spool: %v", err)
+		}
+	}
 	if !h.checkHealth() {
 		return false
 	}
@@ -88,29 +181,40 @@ func (h *HTTPExporter) CheckIsServerReadyAndInit() bool {
 		return false
 	}
 
-	h.LastCheckPoint = resp.LastCheckPoint
-	h.IsServerNotReady = false
+	h.setLastCheckPoint(resp.LastCheckPoint)
+	h.IsServerNotReady.Store(false)
 	log.Printf("meta-server [%s] is ready for pushing event", h.RemoteAddr)
 	return true
 }
 
 func (h *HTTPExporter) KeepPushingEvent() {
+	defer close(h.done)
+	defer h.ticker.Stop()
+
 	isReady := h.CheckIsServerReadyAndInit()
 	if !isReady {
 		log.Printf("meta-server [%s] is not ready, stop pushing event", h.RemoteAddr)
 	}
 	for {
 		select {
+		case <-h.ctx.Done():
+			h.flush()
+			return
 		case <-h.ticker.C:
-			if h.IsServerNotReady {
-				h.CheckIsServerReadyAndInit()
+			if h.IsServerNotReady.Load() {
+				if h.canSpool() {
+					h.spoolBatch()
+					h.recoverFromSpool()
+				} else {
+					h.CheckIsServerReadyAndInit()
+				}
 				continue
 			}
 
 			if len(h.batch) == 0 {
 				if !h.syncCheck() {
 					log.Printf("remote is not sync with agent, prepare to init again")
-					h.IsServerNotReady = false
+					h.IsServerNotReady.Store(true)
 				}
 				continue
 			}
@@ -122,22 +226,33 @@ func (h *HTTPExporter) KeepPushingEvent() {
 				EventIndex: h.messageCounter,
 			}
 
-			resp, err := h.pushEvent(h.batch, h.LastCheckPoint, nowCP)
+			metrics.ExporterBatchSize.WithLabelValues(h.RemoteAddr).Observe(float64(len(h.batch)))
+			resp, err := h.pushEvent(h.ctx, h.batch, h.LastCheckPoint, nowCP)
 			if err != nil {
+				h.IsServerNotReady.Store(true)
+				if h.ctx.Err() != nil {
+					// 推送被Stop中断, 由flush写入spool
+					continue
+				}
+				if h.canSpool() {
+					log.Printf("meta-server [%s] is not ready, spool events until it recovers, err:%v", h.RemoteAddr, err)
+					h.appendSpool(&SpoolRecord{CheckPoint: nowCP, Events: h.batch})
+					h.batch = []*resource.ResourceEvent{}
+					continue
+				}
 				log.Printf("meta-server [%s] is not ready, prepare to init again, err:%v", h.RemoteAddr, err)
-				h.IsServerNotReady = true
 				h.CheckIsServerReadyAndInit()
 				continue
 			}
 
 			if resp.IsInit {
 				log.Printf("remote is not sync with agent, prepare to init again")
-				h.IsServerNotReady = true
+				h.IsServerNotReady.Store(true)
 				h.CheckIsServerReadyAndInit()
 				continue
 			}
 
-			h.LastCheckPoint = nowCP
+			h.setLastCheckPoint(nowCP)
 
 			// 清空batch
 			h.batch = []*resource.ResourceEvent{}
@@ -150,10 +265,132 @@ func (h *HTTPExporter) KeepPushingEvent() {
 	}
 }
 
+// flush 停止前推送剩余的batch, 远端不可用时写入spool
+func (h *HTTPExporter) flush() {
+	if len(h.batch) == 0 {
+		return
+	}
+	if !h.IsServerNotReady.Load() {
+		ctx, cancel := context.WithTimeout(context.Background(), FlushTimeout)
+		defer cancel()
+		h.messageCounter++
+		nowCP := &resource.CheckPoint{
+			AgentIndex: h.AgentIndex,
+			Timestamp:  time.Now().Unix(),
+			EventIndex: h.messageCounter,
+		}
+		resp, err := h.pushEvent(ctx, h.batch, h.LastCheckPoint, nowCP)
+		if err == nil && !resp.IsInit {
+			h.setLastCheckPoint(nowCP)
+			h.batch = []*resource.ResourceEvent{}
+			return
+		}
+		log.Printf("failed to flush events to meta-server [%s] before stop, err: %v", h.RemoteAddr, err)
+	}
+	if h.canSpool() {
+		h.spoolBatch()
+		return
+	}
+	h.dropEvents(len(h.batch))
+	h.batch = []*resource.ResourceEvent{}
+}
+
+// setLastCheckPoint 更新远端已接收的同步进度, 为nil时远端恢复后只能全量初始化
+func (h *HTTPExporter) setLastCheckPoint(checkPoint *resource.CheckPoint) {
+	h.LastCheckPoint = checkPoint
+	h.spoolable.Store(h.canSpool())
+}
+
+// canSpool 是否可以暂存增量事件
+// 未完成过初始化或暂存的事件已经超过上限时, 远端恢复后只能全量初始化
+func (h *HTTPExporter) canSpool() bool {
+	return h.spool != nil && h.LastCheckPoint != nil && !h.spool.Overflowed()
+}
+
+// spoolBatch 将当前batch作为一条增量记录写入spool
+func (h *HTTPExporter) spoolBatch() {
+	if len(h.batch) == 0 {
+		return
+	}
+	h.messageCounter++
+	h.appendSpool(&SpoolRecord{
+		CheckPoint: &resource.CheckPoint{
+			AgentIndex: h.AgentIndex,
+			Timestamp:  time.Now().Unix(),
+			EventIndex: h.messageCounter,
+		},
+		Events: h.batch,
+	})
+	h.batch = []*resource.ResourceEvent{}
+}
+
+func (h *HTTPExporter) appendSpool(record *SpoolRecord) {
+	err := h.spool.Append(record)
+	if err == nil {
+		return
+	}
+	h.dropEvents(len(record.Events))
+	if errors.Is(err, ErrSpoolFull) {
+		log.Printf("spool is full, meta-server [%s] will be reset after it recovers", h.RemoteAddr)
+	} else {
+		log.Printf("failed to write spool, meta-server [%s] will be reset after it recovers, err: %v", h.RemoteAddr, err)
+		h.spool.MarkOverflowed()
+	}
+	// 暂存的事件已经不连续, 远端恢复后只能全量初始化
+	h.setLastCheckPoint(nil)
+}
+
+// recoverFromSpool 远端恢复且同步进度与Agent一致时, 按顺序重放暂存的事件
+// 远端要求重新初始化时放弃暂存的事件, 改为全量初始化
+func (h *HTTPExporter) recoverFromSpool() {
+	resp, err := h.pushEvent(h.ctx, nil, h.LastCheckPoint, nil)
+	if err != nil {
+		return
+	}
+	if resp.IsInit {
+		log.Printf("meta-server [%s] is not sync with agent after recovery, prepare to init again", h.RemoteAddr)
+		h.CheckIsServerReadyAndInit()
+		return
+	}
+
+	replayed := 0
+	err = h.spool.Replay(func(record *SpoolRecord) error {
+		if record.CheckPoint.EventIndex <= h.LastCheckPoint.EventIndex {
+			// 上次重放时已经推送成功
+			return nil
+		}
+		resp, err := h.pushEvent(h.ctx, record.Events, h.LastCheckPoint, record.CheckPoint)
+		if err != nil {
+			return err
+		}
+		if resp.IsInit {
+			return errRemoteNeedInit
+		}
+		h.setLastCheckPoint(record.CheckPoint)
+		replayed++
+		return nil
+	})
+	if errors.Is(err, errRemoteNeedInit) {
+		h.CheckIsServerReadyAndInit()
+		return
+	} else if err != nil {
+		log.Printf("failed to replay spool to meta-server [%s], retry later, err: %v", h.RemoteAddr, err)
+		return
+	}
+
+	if err := h.spool.Reset(); err != nil {
+		log.Printf("failed to reset spool: %v", err)
+	}
+	h.IsServerNotReady.Store(false)
+	log.Printf("meta-server [%s] is recovered, replay %d spooled batches", h.RemoteAddr, replayed)
+}
+
+var errRemoteNeedInit = errors.New("remote need init")
+
 // syncCheck同步检查
 func (h *HTTPExporter) syncCheck() bool {
 	// 检查服务端是否是最新
-	resp, err := h.pushEvent(nil, h.LastCheckPoint, nil)
+	resp, err := h.pushEvent(h.ctx, nil, h.LastCheckPoint, nil)
 	if err != nil {
 		log.Printf("meta-server [%s] is not ready, stop pushing event, err:%v", h.RemoteAddr, err)
 		return false
@@ -162,14 +399,25 @@ func (h *HTTPExporter) syncCheck() bool {
 	return !resp.IsInit
 }
 
+// Stop 停止推送, 推送剩余的事件或写入spool后返回, 可以重复调用
 func (h *HTTPExporter) Stop() {
-	h.IsStopPush = true
-	close(h.eventChan)
+	h.stopOnce.Do(func() {
+		h.cancel()
+		<-h.done
+		if h.spool != nil {
+			if err := h.spool.Close(); err != nil {
+				log.Printf("failed to close spool: %v", err)
+			}
+		}
+		if h.closeConn != nil {
+			h.closeConn()
+		}
+	})
 }
 
 func (h *HTTPExporter) checkHealth() bool {
 	// 健康检查时不传递任何数据
-	resp, err := h.pushEvent(nil, nil, nil)
+	resp, err := h.pushEvent(h.ctx, nil, nil, nil)
 	if err != nil {
 		h.failedTime++
 		if h.failedTime%10 == 1 {
@@ -187,8 +435,12 @@ func (h *HTTPExporter) checkHealth() bool {
 
 func (h *HTTPExporter) pushInitEvent(newCheckPoint *resource.CheckPoint) (*resource.SyncResponse, error) {
 	log.Printf("send init event to reset remote meta [%s]", h.RemoteAddr)
-	resetEvents := make([]*resource.ResourceEvent, 0, len(h.resourcesRef))
-	for _, res := range h.resourcesRef {
+	metrics.ExporterResets.WithLabelValues(h.RemoteAddr).Inc()
+	h.resourcesMux.RLock()
+	resourcesRef := h.resourcesRef
+	h.resourcesMux.RUnlock()
+	resetEvents := make([]*resource.ResourceEvent, 0, len(resourcesRef))
+	for _, res := range resourcesRef {
 		res.ExportMux.RLock()
 		resetEvents = append(resetEvents, &resource.ResourceEvent{
 			ClusterID:    res.ClusterID,
@@ -198,11 +450,12 @@ func (h *HTTPExporter) pushInitEvent(newCheckPoint *resource.CheckPoint) (*resou
 		})
 		res.ExportMux.RUnlock()
 	}
-	return h.pushEvent(resetEvents, nil, newCheckPoint)
+	return h.pushEvent(h.ctx, resetEvents, nil, newCheckPoint)
 }
 
 func (h *HTTPExporter) ExportResourceEvents(events *resource.ResourceEvent) {
-	if h.IsStopPush || h.IsServerNotReady {
+	if h.IsStopPush.Load() || h.ctx.Err() != nil || (h.IsServerNotReady.Load() && !h.spoolable.Load()) {
+		h.dropEvents(1)
 		return
 	}
 
@@ -211,32 +464,66 @@ func (h *HTTPExporter) ExportResourceEvents(events *resource.ResourceEvent) {
 	defer idleTimeout.Stop()
 	select {
 	case h.eventChan <- events:
+	case <-h.ctx.Done():
+		h.dropEvents(1)
 	case <-idleTimeout.C:
 		// 放弃插入
 		log.Printf("exporter is not ready, prepare to init again")
-		h.IsServerNotReady = true
+		h.dropEvents(1)
+		h.IsServerNotReady.Store(true)
 		return
 	}
 }
 
-func (h *HTTPExporter) pushEvent(events []*resource.ResourceEvent, lastCheckPoint *resource.CheckPoint, newCheckPoint *resource.CheckPoint) (*resource.SyncResponse, error) {
+func (h *HTTPExporter) dropEvents(count int) {
+	if count > 0 {
+		metrics.ExporterDroppedEvents.WithLabelValues(h.RemoteAddr).Add(float64(count))
+	}
+}
+
+func (h *HTTPExporter) pushEvent(ctx context.Context, events []*resource.ResourceEvent, lastCheckPoint *resource.CheckPoint, newCheckPoint *resource.CheckPoint) (*resource.SyncResponse, error) {
 	syncReq := &resource.SyncRequest{
 		Events:         events,
 		LastCheckPoint: lastCheckPoint,
 		CheckPoint:     newCheckPoint,
 	}
 
-	body, err := json.Marshal(syncReq)
+	var response *resource.SyncResponse
+	var err error
+	start := time.Now()
+	if h.pusher != nil {
+		response, err = h.pusher.Push(syncReq)
+	} else {
+		response, err = h.pushHTTP(ctx, syncReq)
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.ExporterPushDuration.WithLabelValues(h.RemoteAddr, result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	h.IsStopPush.Store(response.IsStopPush)
+	return response, nil
+}
+
+// pushHTTP 通过/push接口推送
+func (h *HTTPExporter) pushHTTP(ctx context.Context, syncReq *resource.SyncRequest) (*resource.SyncResponse, error) {
+	body, err := h.codec.Marshal(syncReq)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, h.RemoteAddr, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.RemoteAddr, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
+	h.codec.SetContentHeaders(req.Header)
+	h.codec.SetAcceptHeaders(req.Header)
 	req.Header.Add("X-Data-Flow", "meta-push")
+	server.SetBearerToken(req.Header, h.bearerToken)
 
 	resp, err := h.client.Do(req)
 	if err != nil {
@@ -248,27 +535,26 @@ func (h *HTTPExporter) pushEvent(events []*resource.ResourceEvent, lastCheckPoin
 		return nil, fmt.Errorf("server is not ready: stateCode %d", resp.StatusCode)
 	}
 
-	respBytes, err := io.ReadAll(resp.Body)
+	respCodec, err := codec.FromContentHeaders(resp.Header)
 	if err != nil {
-		log.Printf("failed to read response body: err: %v", err)
 		return nil, err
 	}
 
 	var response resource.SyncResponse
-	err = json.Unmarshal(respBytes, &response)
+	err = respCodec.Decode(resp.Body, &response)
 	if err != nil {
 		log.Printf("failed to read response body: err: %v", err)
 		return nil, err
 	}
-
-	h.IsStopPush = response.IsStopPush
 	return &response, nil
 }
 
 func (h *HTTPExporter) SetupResourcesRef(resources *resource.Resources) {
+	h.resourcesMux.Lock()
 	h.resourcesRef = append(h.resourcesRef, resources)
+	h.resourcesMux.Unlock()
 
-	if h.IsServerNotReady {
+	if h.IsServerNotReady.Load() {
 		log.Printf("setup resource [%s](%d), ignore init event since http remote is not ready", resources.ClusterID, resources.ResType)
 	} else {
 		log.Printf("setup resource [%s](%d), send init event to remote metasource", resources.ClusterID, resources.ResType)
@@ -285,19 +571,21 @@ func (h *HTTPExporter) SetupResourcesRef(resources *resource.Resources) {
 		defer idleTimeout.Stop()
 		select {
 		case h.eventChan <- initEvent:
+		case <-h.ctx.Done():
 		case <-idleTimeout.C:
 			// 放弃插入
 			log.Printf("exporter is not ready, prepare to init again")
-			h.IsServerNotReady = true
+			h.IsServerNotReady.Store(true)
 			return
 		}
 	}
 }
 
-func createHTTPClient() *http.Client {
+func createHTTPClient(tlsConfig *tls.Config) *http.Client {
 	client := &http.Client{
 		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
 			DialContext: (&net.Dialer{
 				Timeout:   30 * time.Second,
 				KeepAlive: 30 * time.Second,
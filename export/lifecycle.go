@@ -0,0 +1,43 @@
+package export
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle 记录处理中的连接, 停止后不再接受新的连接, 并等待已有的连接退出
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mux sync.Mutex
+	wg  sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// add 已经停止时返回false
+func (l *lifecycle) add() bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.ctx.Err() != nil {
+		return false
+	}
+	l.wg.Add(1)
+	return true
+}
+
+func (l *lifecycle) done() {
+	l.wg.Done()
+}
+
+// stop 取消ctx并等待全部连接退出, 可以重复调用
+func (l *lifecycle) stop() {
+	l.mux.Lock()
+	l.cancel()
+	l.mux.Unlock()
+	l.wg.Wait()
+}
@@ -0,0 +1,105 @@
+package export_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/source/metasource"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stopWithin 在timeout内未返回时测试失败
+func stopWithin(t *testing.T, timeout time.Duration, stop func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stop()
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("timeout waiting for stop")
+	}
+}
+
+func TestHTTPExporterStopFlush(t *testing.T) {
+	ms := metasource.NewMetaSource()
+	srv := httptest.NewServer(http.HandlerFunc(ms.HandlePushedEvent))
+	defer srv.Close()
+
+	exporter := export.NewHTTPExporter(srv.URL)
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(exporter)
+	podList.AddResource(testPodEvent(1).Res[0])
+
+	podCount := func() int {
+		handlerMap, find := ms.ClusterMaps.Load("")
+		if !find {
+			return 0
+		}
+		handler, find := handlerMap.(*metasource.ClusterHandlerMap).GetHandler(resource.PodType)
+		if !find {
+			return 0
+		}
+		return handler.(*resource.Resources).Len()
+	}
+	require.Eventually(t, func() bool { return podCount() == 1 }, 10*time.Second, 100*time.Millisecond)
+
+	// 停止前未推送的事件在Stop返回前推送
+	podList.AddResource(testPodEvent(2).Res[0])
+	stopWithin(t, 10*time.Second, exporter.Stop)
+	assert.Equal(t, 2, podCount())
+
+	// 停止后的事件直接丢弃, 不会阻塞
+	stopWithin(t, time.Second, func() { podList.AddResource(testPodEvent(3).Res[0]) })
+	stopWithin(t, time.Second, exporter.Stop)
+}
+
+func TestFetcherServerStop(t *testing.T) {
+	fetchServer := export.NewFetcherServer()
+	srv := httptest.NewServer(http.HandlerFunc(fetchServer.FetchWithWS))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(&resource.FetchRequest{}))
+	_, _, err = conn.ReadMessage()
+	require.NoError(t, err)
+
+	stopWithin(t, 5*time.Second, fetchServer.Stop)
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "unexpected error: %v", err)
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestWatchServerStop(t *testing.T) {
+	watchServer := export.NewWatchServer()
+	srv := httptest.NewServer(http.HandlerFunc(watchServer.Watch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/watch")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	stopWithin(t, 5*time.Second, watchServer.Stop)
+	_, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	resp, err = http.Get(srv.URL + "/watch")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// DefaultSpoolMaxBytes 默认的WAL大小上限
+const DefaultSpoolMaxBytes = 64 << 20
+
+var ErrSpoolFull = errors.New("spool is full")
+
+// SpoolRecord WAL中的一条记录, 对应一次未能推送的增量同步
+type SpoolRecord struct {
+	CheckPoint *resource.CheckPoint
+	Events     []*resource.ResourceEvent
+}
+
+// Spool 远端不可用时暂存增量事件的WAL, 远端恢复后按顺序重放
+//
+// WAL只用于远端短暂不可用的场景, Agent重启后内存中的资源会重新初始化, 因此打开时会清空已有记录
+// Spool不是并发安全的, 只应在HTTPExporter的推送协程中使用
+type Spool struct {
+	path     string
+	maxBytes int64
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	count  int
+
+	// 超过大小上限后丢弃后续记录, 远端恢复后需要全量初始化
+	overflowed bool
+}
+
+func OpenSpool(path string, maxBytes int64) (*Spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSpoolMaxBytes
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Spool{
+		path:     path,
+		maxBytes: maxBytes,
+		file:     file,
+		writer:   bufio.NewWriter(file),
+	}, nil
+}
+
+// Append 追加一条记录并落盘, 超过大小上限时返回ErrSpoolFull
+func (s *Spool) Append(record *SpoolRecord) error {
+	if s.overflowed {
+		return ErrSpoolFull
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if s.size+int64(len(data))+1 > s.maxBytes {
+		s.overflowed = true
+		return ErrSpoolFull
+	}
+	if _, err = s.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err = s.writer.Flush(); err != nil {
+		return err
+	}
+	if err = s.file.Sync(); err != nil {
+		return err
+	}
+	s.size += int64(len(data)) + 1
+	s.count++
+	return nil
+}
+
+// Replay 按写入顺序读取全部记录, fn返回错误时停止
+func (s *Spool) Replay(fn func(record *SpoolRecord) error) error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// 读取后恢复到文件末尾, 保证后续追加的位置正确
+	defer s.file.Seek(0, io.SeekEnd)
+
+	decoder := json.NewDecoder(bufio.NewReader(s.file))
+	for i := 0; i < s.count; i++ {
+		var record SpoolRecord
+		if err := decoder.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset 清空全部记录
+func (s *Spool) Reset() error {
+	s.writer.Reset(s.file)
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.size = 0
+	s.count = 0
+	s.overflowed = false
+	return nil
+}
+
+func (s *Spool) Len() int {
+	return s.count
+}
+
+// MarkOverflowed 丢弃后续记录, 直到Reset
+func (s *Spool) MarkOverflowed() {
+	s.overflowed = true
+}
+
+func (s *Spool) Overflowed() bool {
+	return s.overflowed
+}
+
+func (s *Spool) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,99 @@
+package export_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/source/metasource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	spool, err := export.OpenSpool(filepath.Join(t.TempDir(), "exporter.wal"), 1024)
+	require.NoError(t, err)
+	defer spool.Close()
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, spool.Append(&export.SpoolRecord{
+			CheckPoint: &resource.CheckPoint{EventIndex: i},
+			Events:     []*resource.ResourceEvent{testPodEvent(i)},
+		}))
+	}
+
+	var replayed []int
+	require.NoError(t, spool.Replay(func(record *export.SpoolRecord) error {
+		replayed = append(replayed, record.CheckPoint.EventIndex)
+		return nil
+	}))
+	assert.Equal(t, []int{1, 2, 3}, replayed)
+
+	// 重放后可以继续追加
+	require.NoError(t, spool.Append(&export.SpoolRecord{CheckPoint: &resource.CheckPoint{EventIndex: 4}}))
+	assert.Equal(t, 4, spool.Len())
+
+	big := &export.SpoolRecord{CheckPoint: &resource.CheckPoint{EventIndex: 5}}
+	for i := 0; i < 20; i++ {
+		big.Events = append(big.Events, testPodEvent(i))
+	}
+	assert.ErrorIs(t, spool.Append(big), export.ErrSpoolFull)
+	assert.True(t, spool.Overflowed())
+
+	require.NoError(t, spool.Reset())
+	assert.Equal(t, 0, spool.Len())
+	assert.False(t, spool.Overflowed())
+}
+
+func TestHTTPExporterReplaySpool(t *testing.T) {
+	ms := metasource.NewMetaSource()
+	var isDown atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ms.HandlePushedEvent(w, r)
+	}))
+	defer srv.Close()
+
+	spool, err := export.OpenSpool(filepath.Join(t.TempDir(), "exporter.wal"), 0)
+	require.NoError(t, err)
+	defer spool.Close()
+
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(export.NewHTTPExporterWithSpool(srv.URL, spool))
+	podList.AddResource(testPodEvent(1).Res[0])
+
+	podNames := func() []string {
+		handlerMap, find := ms.ClusterMaps.Load("")
+		if !find {
+			return nil
+		}
+		handler, find := handlerMap.(*metasource.ClusterHandlerMap).GetHandler(resource.PodType)
+		if !find {
+			return nil
+		}
+		var names []string
+		for _, res := range handler.(*resource.Resources).Snapshot() {
+			names = append(names, res.Name)
+		}
+		return names
+	}
+	require.Eventually(t, func() bool { return len(podNames()) == 1 }, 10*time.Second, 100*time.Millisecond)
+
+	isDown.Store(true)
+	podList.AddResource(testPodEvent(2).Res[0])
+	podList.AddResource(testPodEvent(3).Res[0])
+	time.Sleep(4 * time.Second)
+	isDown.Store(false)
+
+	require.Eventually(t, func() bool { return len(podNames()) == 3 }, 10*time.Second, 100*time.Millisecond)
+	// 恢复后增量重放, 不会重新申请Agent编号并全量初始化
+	assert.Equal(t, int64(1), ms.AgentCounter.Load())
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"sort"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// ExporterStatus 用于管理接口展示Exporter的状态
+type ExporterStatus struct {
+	// http, grpc, fetch或watch
+	Type       string `json:"type"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// 推送到远端的Exporter
+	AgentIndex       int64                `json:"agent_index,omitempty"`
+	IsServerNotReady bool                 `json:"is_server_not_ready"`
+	IsStopPush       bool                 `json:"is_stop_push"`
+	LastCheckPoint   *resource.CheckPoint `json:"last_check_point,omitempty"`
+
+	// 连接到FetcherServer的Fetcher
+	Fetchers []FetcherStatus `json:"fetchers,omitempty"`
+}
+
+type FetcherStatus struct {
+	ID         int64  `json:"id"`
+	RemoteAddr string `json:"remote_addr"`
+	// 为空时获取全部类型
+	FetchedTypes []string `json:"fetched_types"`
+	// 为空时获取全部集群
+	ClusterID string `json:"cluster_id,omitempty"`
+}
+
+// StatusOf 展开Exporter并返回其中各Exporter的状态
+func StatusOf(exporter resource.Exporter) []ExporterStatus {
+	switch e := exporter.(type) {
+	case *Exporter:
+		var status []ExporterStatus
+		for _, exporter := range e.Exporters {
+			status = append(status, StatusOf(exporter)...)
+		}
+		return status
+	case *HTTPExporter:
+		return []ExporterStatus{e.Status()}
+	case *FetcherServer:
+		return []ExporterStatus{e.Status()}
+	case *WatchServer:
+		return []ExporterStatus{{Type: "watch"}}
+	}
+	return nil
+}
+
+func (h *HTTPExporter) Status() ExporterStatus {
+	status := ExporterStatus{
+		Type:             "http",
+		RemoteAddr:       h.RemoteAddr,
+		AgentIndex:       h.AgentIndex,
+		IsServerNotReady: h.IsServerNotReady.Load(),
+		IsStopPush:       h.IsStopPush.Load(),
+		LastCheckPoint:   h.LastCheckPoint,
+	}
+	if h.pusher != nil {
+		status.Type = "grpc"
+	}
+	return status
+}
+
+func (s *FetcherServer) Status() ExporterStatus {
+	status := ExporterStatus{Type: "fetch", Fetchers: []FetcherStatus{}}
+	s.fetchers.Range(func(_, value any) bool {
+		fetcher := value.(*Fetcher)
+		fetchedTypes := make([]string, 0, len(fetcher.FetchedTypes))
+		for resType := range fetcher.FetchedTypes {
+			fetchedTypes = append(fetchedTypes, resType.Kind())
+		}
+		sort.Strings(fetchedTypes)
+		status.Fetchers = append(status.Fetchers, FetcherStatus{
+			ID:           fetcher.ID,
+			RemoteAddr:   fetcher.RemoteAddr,
+			FetchedTypes: fetchedTypes,
+			ClusterID:    fetcher.ClusterID,
+		})
+		return true
+	})
+	sort.Slice(status.Fetchers, func(i, j int) bool {
+		return status.Fetchers[i].ID < status.Fetchers[j].ID
+	})
+	return status
+}
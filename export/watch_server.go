@@ -0,0 +1,370 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// WatchServer 通过SSE向订阅者推送过滤后的资源变更事件
+//
+//	GET /watch?cluster=&namespace=&type=pod&type=service&labelSelector=&snapshot=true
+//
+// 与/fetch不同, 订阅者只接收匹配过滤条件的资源, 且可以选择不接收初始快照
+type WatchServer struct {
+	resourcesMux sync.RWMutex
+	resources    []*resource.Resources
+
+	subscriberID atomic.Int64
+	subscribers  sync.Map
+	// 停止时断开全部订阅者
+	lifecycle *lifecycle
+
+	// 订阅者的事件缓冲, 缓冲满时断开订阅者, 避免阻塞事件导出
+	BufferSize        int
+	HeartbeatInterval time.Duration
+}
+
+func NewWatchServer() *WatchServer {
+	return &WatchServer{
+		lifecycle:         newLifecycle(),
+		BufferSize:        1024,
+		HeartbeatInterval: 30 * time.Second,
+	}
+}
+
+// WatchEvent 推送给订阅者的单个事件
+type WatchEvent struct {
+	ClusterID    string                `json:"clusterID"`
+	ResourceType resource.ResType      `json:"resourceType"`
+	Operation    resource.ResOperation `json:"operation"`
+	// Add/Update/Delete时为单个资源, Reset时为过滤后的资源列表
+	Object *resource.Resource   `json:"object,omitempty"`
+	List   []*resource.Resource `json:"list,omitempty"`
+}
+
+// WatchFilter 订阅的过滤条件, 为空的条件不做过滤
+type WatchFilter struct {
+	ClusterID string
+	Namespace string
+	ResTypes  map[resource.ResType]struct{}
+	Selector  labels.Selector
+	// 调用方可以访问的数据范围, 为nil时不做限制
+	Policy *policy.Policy
+}
+
+func ParseWatchFilter(r *http.Request) (*WatchFilter, error) {
+	params := r.URL.Query()
+	filter := &WatchFilter{
+		ClusterID: params.Get("cluster"),
+		Namespace: params.Get("namespace"),
+	}
+	for _, name := range params["type"] {
+		resType, find := resource.ParseResType(name)
+		if !find {
+			return nil, fmt.Errorf("unknown resource type %q", name)
+		}
+		if filter.ResTypes == nil {
+			filter.ResTypes = map[resource.ResType]struct{}{}
+		}
+		filter.ResTypes[resType] = struct{}{}
+	}
+	if selector := params.Get("labelSelector"); len(selector) > 0 {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labelSelector %q: %w", selector, err)
+		}
+		filter.Selector = parsed
+	}
+	return filter, nil
+}
+
+func (f *WatchFilter) matchEvent(clusterID string, resType resource.ResType) bool {
+	if len(f.ClusterID) > 0 && f.ClusterID != clusterID {
+		return false
+	}
+	if !f.Policy.AllowCluster(clusterID) {
+		return false
+	}
+	if f.ResTypes != nil {
+		if _, find := f.ResTypes[resType]; !find {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeResource 返回脱敏后的资源, 不匹配时返回false
+// 标签选择器匹配脱敏后的标签, 避免通过选择器探测被移除的标签
+func (f *WatchFilter) scopeResource(res *resource.Resource) (*resource.Resource, bool) {
+	if !f.Policy.AllowResource(res) {
+		return nil, false
+	}
+	if len(f.Namespace) > 0 && f.Namespace != res.Namespace() {
+		return nil, false
+	}
+	res = f.Policy.Redact(res)
+	if f.Selector != nil && !f.Selector.Matches(labels.Set(res.Labels())) {
+		return nil, false
+	}
+	return res, true
+}
+
+// tombstone 资源不再匹配过滤条件时, 推送给订阅者的delete事件中的资源
+func (f *WatchFilter) tombstone(res *resource.Resource) *resource.Resource {
+	if f.Policy.AllowResource(res) {
+		return f.Policy.Redact(res)
+	}
+	return &resource.Resource{ResUID: res.ResUID, ResType: res.ResType, Name: res.Name}
+}
+
+func (f *WatchFilter) filterList(resList []*resource.Resource) []*resource.Resource {
+	filtered := make([]*resource.Resource, 0, len(resList))
+	for _, res := range resList {
+		if scoped, ok := f.scopeResource(res); ok {
+			filtered = append(filtered, scoped)
+		}
+	}
+	return filtered
+}
+
+type visibleKey struct {
+	clusterID string
+	resType   resource.ResType
+	uid       resource.ResUID
+}
+
+type subscriber struct {
+	id     int64
+	filter *WatchFilter
+
+	// 已经推送给订阅者且匹配过滤条件的资源, 更新后不再匹配时推送delete
+	visibleMux sync.Mutex
+	visible    map[visibleKey]struct{}
+
+	sendChan chan *WatchEvent
+	closed   atomic.Bool
+	done     chan struct{}
+}
+
+func (sub *subscriber) close() {
+	if !sub.closed.Swap(true) {
+		close(sub.done)
+	}
+}
+
+func (s *WatchServer) SetupResourcesRef(resources *resource.Resources) {
+	s.resourcesMux.Lock()
+	s.resources = append(s.resources, resources)
+	s.resourcesMux.Unlock()
+}
+
+func (s *WatchServer) ExportResourceEvents(event *resource.ResourceEvent) {
+	s.subscribers.Range(func(_, value any) bool {
+		sub := value.(*subscriber)
+		if sub.filter.matchEvent(event.ClusterID, event.ResourceType) {
+			sub.export(event)
+		}
+		return true
+	})
+}
+
+func (sub *subscriber) export(event *resource.ResourceEvent) {
+	sub.visibleMux.Lock()
+	defer sub.visibleMux.Unlock()
+
+	if event.Operation == resource.ResetOP {
+		list := sub.filter.filterList(event.Res)
+		sub.resetVisible(event.ClusterID, event.ResourceType, list)
+		sub.send(&WatchEvent{
+			ClusterID:    event.ClusterID,
+			ResourceType: event.ResourceType,
+			Operation:    event.Operation,
+			List:         list,
+		})
+		return
+	}
+	for _, res := range event.Res {
+		key := visibleKey{clusterID: event.ClusterID, resType: event.ResourceType, uid: res.ResUID}
+		_, visible := sub.visible[key]
+		scoped, ok := sub.filter.scopeResource(res)
+		operation := event.Operation
+		switch {
+		case operation == resource.DeleteOP:
+			delete(sub.visible, key)
+			if !ok {
+				if !visible {
+					continue
+				}
+				scoped = sub.filter.tombstone(res)
+			}
+		case ok:
+			sub.visible[key] = struct{}{}
+		case visible:
+			// 更新后不再匹配过滤条件, 对订阅者而言资源已经被删除
+			delete(sub.visible, key)
+			operation = resource.DeleteOP
+			scoped = sub.filter.tombstone(res)
+		default:
+			continue
+		}
+		sub.send(&WatchEvent{
+			ClusterID:    event.ClusterID,
+			ResourceType: event.ResourceType,
+			Operation:    operation,
+			Object:       scoped,
+		})
+	}
+}
+
+// resetVisible 使用Reset事件中的资源替换该集群该类型的可见资源, 调用方持有visibleMux
+func (sub *subscriber) resetVisible(clusterID string, resType resource.ResType, list []*resource.Resource) {
+	for key := range sub.visible {
+		if key.clusterID == clusterID && key.resType == resType {
+			delete(sub.visible, key)
+		}
+	}
+	for _, res := range list {
+		sub.visible[visibleKey{clusterID: clusterID, resType: resType, uid: res.ResUID}] = struct{}{}
+	}
+}
+
+func (sub *subscriber) send(event *WatchEvent) {
+	if sub.closed.Load() {
+		return
+	}
+	select {
+	case sub.sendChan <- event:
+	default:
+		// 订阅者消费过慢, 断开后由订阅者重新订阅
+		log.Printf("watch subscriber [%d] is too slow, close it", sub.id)
+		sub.close()
+	}
+}
+
+// snapshot 返回当前所有匹配过滤条件的资源, 每种资源类型一个Reset事件
+func (s *WatchServer) snapshot(filter *WatchFilter) []*WatchEvent {
+	s.resourcesMux.RLock()
+	defer s.resourcesMux.RUnlock()
+
+	var events []*WatchEvent
+	for _, res := range s.resources {
+		if !filter.matchEvent(res.ClusterID, res.ResType) {
+			continue
+		}
+		events = append(events, &WatchEvent{
+			ClusterID:    res.ClusterID,
+			ResourceType: res.ResType,
+			Operation:    resource.ResetOP,
+			List:         filter.filterList(res.Snapshot()),
+		})
+	}
+	return events
+}
+
+func (s *WatchServer) Watch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	filter, err := ParseWatchFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.lifecycle.add() {
+		http.Error(w, "watch server is stopped", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.lifecycle.done()
+	filter.Policy = policy.FromContext(r.Context())
+	withSnapshot, _ := strconv.ParseBool(r.URL.Query().Get("snapshot"))
+
+	sub := &subscriber{
+		id:       s.subscriberID.Add(1),
+		filter:   filter,
+		visible:  map[visibleKey]struct{}{},
+		sendChan: make(chan *WatchEvent, s.BufferSize),
+		done:     make(chan struct{}),
+	}
+	// 先注册再获取快照, 快照期间的变更可能重复推送, 但不会丢失
+	s.subscribers.Store(sub.id, sub)
+	defer s.subscribers.Delete(sub.id)
+	defer sub.close()
+	log.Printf("add watch subscriber [%d] from %s", sub.id, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if withSnapshot {
+		// 获取快照期间暂停推送事件, 快照之后的变更基于快照中的资源判断是否推送delete
+		sub.visibleMux.Lock()
+		snapshot := s.snapshot(filter)
+		for _, event := range snapshot {
+			sub.resetVisible(event.ClusterID, event.ResourceType, event.List)
+		}
+		sub.visibleMux.Unlock()
+		for _, event := range snapshot {
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case <-s.lifecycle.ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-sub.sendChan:
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+var opNames = map[resource.ResOperation]string{
+	resource.AddOP:    "add",
+	resource.UpdateOP: "update",
+	resource.DeleteOP: "delete",
+	resource.ResetOP:  "reset",
+}
+
+func writeSSE(w http.ResponseWriter, event *WatchEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", opNames[event.Operation], data)
+	return err
+}
+
+// Stop 断开全部订阅者, 所有订阅者退出后返回
+func (s *WatchServer) Stop() {
+	s.lifecycle.stop()
+}
@@ -0,0 +1,154 @@
+package export_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPod(uid string, namespace string, app string) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(uid),
+		ResType:    resource.PodType,
+		Name:       uid,
+		StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: namespace},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.PodLabelsAttr: {"app": app},
+		},
+	}
+}
+
+type sseEvent struct {
+	name  string
+	event export.WatchEvent
+}
+
+func readSSE(t *testing.T, reader *bufio.Reader) sseEvent {
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.event))
+		case len(line) == 0 && len(ev.name) > 0:
+			return ev
+		}
+	}
+}
+
+func TestWatchServer(t *testing.T) {
+	watchServer := export.NewWatchServer()
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(watchServer)
+	serviceList := resource.NewResources(resource.ServiceType, nil)
+	serviceList.SetExporter(watchServer)
+
+	podList.AddResource(testPod("pod-1", "default", "web"))
+	podList.AddResource(testPod("pod-2", "kube-system", "web"))
+
+	srv := httptest.NewServer(http.HandlerFunc(watchServer.Watch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/watch?type=pod&namespace=default&labelSelector=app%3Dweb&snapshot=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	ev := readSSE(t, reader)
+	assert.Equal(t, "reset", ev.name)
+	require.Len(t, ev.event.List, 1)
+	assert.Equal(t, "pod-1", ev.event.List[0].Name)
+
+	// 不匹配的资源不会推送
+	serviceList.AddResource(&resource.Resource{ResUID: "svc-1", ResType: resource.ServiceType})
+	podList.AddResource(testPod("pod-3", "default", "db"))
+	podList.AddResource(testPod("pod-4", "default", "web"))
+	podList.DeleteResource(testPod("pod-1", "default", "web"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ev = readSSE(t, reader)
+		assert.Equal(t, "add", ev.name)
+		assert.Equal(t, "pod-4", ev.event.Object.Name)
+
+		ev = readSSE(t, reader)
+		assert.Equal(t, "delete", ev.name)
+		assert.Equal(t, "pod-1", ev.event.Object.Name)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch events")
+	}
+}
+
+func TestWatchUpdateLeavesFilter(t *testing.T) {
+	watchServer := export.NewWatchServer()
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(watchServer)
+	podList.AddResource(testPod("pod-1", "default", "web"))
+	podList.AddResource(testPod("pod-2", "default", "db"))
+
+	srv := httptest.NewServer(http.HandlerFunc(watchServer.Watch))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/watch?type=pod&labelSelector=app%3Dweb&snapshot=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	ev := readSSE(t, reader)
+	assert.Equal(t, "reset", ev.name)
+	require.Len(t, ev.event.List, 1)
+
+	// pod-1不再匹配标签选择器, pod-2始终不匹配
+	podList.UpdateResource(testPod("pod-1", "default", "db"))
+	podList.UpdateResource(testPod("pod-2", "default", "cache"))
+	podList.UpdateResource(testPod("pod-2", "default", "web"))
+	podList.UpdateResource(testPod("pod-1", "default", "cache"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ev = readSSE(t, reader)
+		assert.Equal(t, "delete", ev.name)
+		assert.Equal(t, "pod-1", ev.event.Object.Name)
+
+		ev = readSSE(t, reader)
+		assert.Equal(t, "update", ev.name)
+		assert.Equal(t, "pod-2", ev.event.Object.Name)
+
+		podList.UpdateResource(testPod("pod-2", "default", "db"))
+		ev = readSSE(t, reader)
+		assert.Equal(t, "delete", ev.name)
+		assert.Equal(t, "pod-2", ev.event.Object.Name)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch events")
+	}
+}
+
+func TestWatchBadFilter(t *testing.T) {
+	watchServer := export.NewWatchServer()
+	for _, query := range []string{"type=secret", "labelSelector=app+in+web"} {
+		w := httptest.NewRecorder()
+		watchServer.Watch(w, httptest.NewRequest(http.MethodGet, "/watch?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "metadata"
+
+// Registry 模块内的全部指标
+// 不使用prometheus默认的Registry, 避免与引入本模块的进程的指标冲突
+var Registry = prometheus.NewRegistry()
+
+var (
+	// SourceEvents K8s Informer分发的事件
+	SourceEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "source",
+		Name:      "events_total",
+		Help:      "Number of events received from kubernetes informers.",
+	}, []string{"res_type", "operation"})
+
+	ExporterBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "batch_size",
+		Help:      "Number of events in each incremental push.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"remote"})
+	ExporterPushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "push_duration_seconds",
+		Help:      "Latency of push requests, including health and sync checks.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"remote", "result"})
+	ExporterResets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "resets_total",
+		Help:      "Number of full resets pushed to the remote.",
+	}, []string{"remote"})
+	ExporterDroppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "dropped_events_total",
+		Help:      "Number of events dropped while the remote is not ready, they are recovered by the next reset.",
+	}, []string{"remote"})
+
+	FetcherConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "connected",
+		Help:      "Number of fetchers connected to /fetch or the grpc Fetch stream.",
+	})
+	FetcherSendTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "fetcher",
+		Name:      "send_timeouts_total",
+		Help:      "Number of fetchers disconnected because their event queue was full.",
+	})
+
+	// MetaSourceResyncs MetaSource要求Agent重新初始化(IsInit)
+	MetaSourceResyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "meta_source",
+		Name:      "forced_resyncs_total",
+		Help:      "Number of responses asking an agent to push a full reset.",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		SourceEvents,
+		ExporterBatchSize,
+		ExporterPushDuration,
+		ExporterResets,
+		ExporterDroppedEvents,
+		FetcherConnected,
+		FetcherSendTimeouts,
+		MetaSourceResyncs,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler 以Prometheus文本格式返回Registry中的指标
+func Handler() http.HandlerFunc {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}).ServeHTTP
+}
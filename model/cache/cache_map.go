@@ -96,13 +96,10 @@ func NewClusterCacheList() *ClusterCacheMap {
 
 // AddResHandler implements Querier.
 func (b *ClusterCacheMap) AddResHandler(clusterId string, resType resource.ResType, handler resource.ResHandler) {
-	handlerMap, find := b.Caches.Load(clusterId)
-	if !find {
-		b.Caches.Store(clusterId, &HandlerMap{})
-	}
-
+	handlerMap, _ := b.Caches.LoadOrStore(clusterId, &HandlerMap{
+		Handlers: make(map[resource.ResType]resource.ResHandler),
+	})
 	handlerMap.(*HandlerMap).AddHandler(resType, handler)
-	b.Caches.Store(clusterId, handlerMap)
 }
 
 // AddResHandlers implements Querier.
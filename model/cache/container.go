@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// shortContainerIDLen 与docker ps一致的短容器ID长度
+const shortContainerIDLen = 12
+
+const (
+	ContainerTypeInit      = "init"
+	ContainerTypeRegular   = "container"
+	ContainerTypeEphemeral = "ephemeral"
+)
+
+// Container Pod中的一个容器, 包括init和ephemeral容器
+type Container struct {
+	// 不含运行时前缀的完整容器ID
+	ID           string
+	Name         string
+	Image        string
+	ImageID      string
+	Type         string
+	RestartCount int64
+	Ready        bool
+	// waiting / running / terminated
+	State       string
+	StateReason string
+
+	Pod *Pod `json:"-"`
+}
+
+func (c *Container) ShortID() string {
+	return shortContainerID(c.ID)
+}
+
+// MatchID containerID为短ID或完整ID
+func (c *Container) MatchID(containerID string) bool {
+	return len(containerID) >= shortContainerIDLen && strings.HasPrefix(c.ID, containerID)
+}
+
+func shortContainerID(containerID string) string {
+	if len(containerID) > shortContainerIDLen {
+		return containerID[:shortContainerIDLen]
+	}
+	return containerID
+}
+
+// Containers 解析Pod的R_CONTAINER关系, 旧版本的数据源不提供时返回空
+func (p *Pod) Containers() []*Container {
+	var containers []*Container
+	for _, relation := range p.Relations {
+		if relation.ReType != resource.R_CONTAINER {
+			continue
+		}
+		restartCount, _ := strconv.ParseInt(relation.StringAttr[resource.ContainerRestartCount], 10, 64)
+		containers = append(containers, &Container{
+			ID:           string(relation.ResUID),
+			Name:         relation.StringAttr[resource.ContainerName],
+			Image:        relation.StringAttr[resource.ContainerImage],
+			ImageID:      relation.StringAttr[resource.ContainerImageID],
+			Type:         relation.StringAttr[resource.ContainerType],
+			RestartCount: restartCount,
+			Ready:        relation.StringAttr[resource.ContainerReady] == "true",
+			State:        relation.StringAttr[resource.ContainerState],
+			StateReason:  relation.StringAttr[resource.ContainerStateReason],
+			Pod:          p,
+		})
+	}
+	return containers
+}
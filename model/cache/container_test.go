@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	appContainerID  = "286b025a9464cb948a3f388df8a6700895fab34ff01d4770d308c6ae00508c8d"
+	initContainerID = "be17c1ed0a0b385a5d7735dc7bbd989662cbe820f6ec6ead7c3458cafb3309cc"
+)
+
+func containerRelation(id string, name string, containerType string) resource.Relation {
+	return resource.Relation{
+		ResUID: resource.ResUID(id),
+		ReType: resource.R_CONTAINER,
+		StringAttr: map[resource.AttrKey]string{
+			resource.ContainerName:         name,
+			resource.ContainerImage:        name + ":v1",
+			resource.ContainerType:         containerType,
+			resource.ContainerRestartCount: "3",
+			resource.ContainerReady:        "true",
+			resource.ContainerState:        "running",
+		},
+	}
+}
+
+func TestGetContainerByID(t *testing.T) {
+	pod := testWorkload(resource.PodType, "pod-1", "web-0", ownerRelation("rs-1", "ReplicaSet", "web-7d9f"))
+	pod.StringAttr[resource.ContainerIDsAttr] = appContainerID[:12]
+	pod.Relations = append(pod.Relations,
+		containerRelation(initContainerID, "init-db", ContainerTypeInit),
+		containerRelation(appContainerID, "web", ContainerTypeRegular),
+	)
+
+	podList := NewPodList(resource.PodType, nil).(*PodList)
+	podList.SetExporter(nonExporter{})
+	podList.AddResource(pod)
+	cacheMap := NewSingleClusterCacheList()
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	for _, containerID := range []string{appContainerID, appContainerID[:12], appContainerID[:20]} {
+		container, find := q.GetContainerByID("", containerID)
+		assert.True(t, find)
+		assert.Equal(t, "web", container.Name)
+		assert.Equal(t, "web:v1", container.Image)
+		assert.Equal(t, int64(3), container.RestartCount)
+		assert.True(t, container.Ready)
+		assert.Equal(t, "web-0", container.Pod.Name)
+	}
+
+	_, find := q.GetContainerByID("", appContainerID[:8])
+	assert.False(t, find)
+	_, find = q.GetContainerByID("", appContainerID[:12]+"ffff")
+	assert.False(t, find)
+
+	// init容器同样可以查询到所属的Pod
+	found, find := q.GetPodByContainerId("", initContainerID)
+	assert.True(t, find)
+	assert.Equal(t, "web-0", found.Name)
+
+	podList.DeleteResource(pod)
+	_, find = q.GetContainerByID("", appContainerID)
+	assert.False(t, find)
+}
+
+func TestGetContainerByIDWithoutPodCache(t *testing.T) {
+	q := &Query{CacheMap: NewSingleClusterCacheList()}
+	_, find := q.GetContainerByID("", appContainerID)
+	assert.False(t, find)
+}
@@ -24,3 +24,16 @@ func (m *HandlerMap) AddHandler(resType resource.ResType, handler resource.ResHa
 	defer m.Unlock()
 	m.Handlers[resType] = handler
 }
+
+// ResourceCounts 返回各类型的资源数量, key为资源类型名
+func (m *HandlerMap) ResourceCounts() map[string]int {
+	m.RLock()
+	defer m.RUnlock()
+	counts := make(map[string]int, len(m.Handlers))
+	for resType, handler := range m.Handlers {
+		if ref, ok := handler.(interface{ ResourcesRef() *resource.Resources }); ok {
+			counts[resType.Kind()] = ref.ResourcesRef().Len()
+		}
+	}
+	return counts
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// Validity 资源在某个索引键(IP/容器ID)上的有效区间
+type Validity struct {
+	// 首次观察到的时间, unix毫秒
+	FirstSeen int64 `json:"firstSeen"`
+	// 删除或被其他资源替换的时间, unix毫秒, 0表示仍然有效
+	DeletedAt int64 `json:"deletedAt"`
+}
+
+func (v *Validity) contains(ts int64) bool {
+	return v.FirstSeen <= ts && (v.DeletedAt == 0 || ts < v.DeletedAt)
+}
+
+type HistoryEntry struct {
+	Validity
+	UID    resource.ResUID
+	Object any
+}
+
+// History 记录索引键在不同时间段对应的资源
+// 用于处理延迟到达的数据: IP被复用后, 仍能将旧数据关联到当时持有该IP的资源
+type History struct {
+	mux       sync.RWMutex
+	retention time.Duration
+	// key -> entries, 按FirstSeen升序
+	entries map[string][]*HistoryEntry
+
+	lastExpire time.Time
+}
+
+// NewHistory retention为0时返回nil, nil History的所有方法均为空操作
+func NewHistory(retention time.Duration) *History {
+	if retention <= 0 {
+		return nil
+	}
+	return &History{
+		retention: retention,
+		entries:   map[string][]*HistoryEntry{},
+	}
+}
+
+// Record 记录key当前对应的资源
+// 如果key之前对应其他资源, 则认为旧资源在now时失效
+func (h *History) Record(key string, UID resource.ResUID, obj any, now time.Time) {
+	if h == nil || len(key) == 0 {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	ts := now.UnixMilli()
+	entries := h.entries[key]
+	for _, entry := range entries {
+		if entry.DeletedAt != 0 {
+			continue
+		}
+		if entry.UID == UID {
+			entry.Object = obj
+			return
+		}
+		entry.DeletedAt = ts
+	}
+	h.entries[key] = append(entries, &HistoryEntry{
+		Validity: Validity{FirstSeen: ts},
+		UID:      UID,
+		Object:   obj,
+	})
+	h.expire(now)
+}
+
+// Delete 标记key上UID对应的资源在now时失效
+func (h *History) Delete(key string, UID resource.ResUID, now time.Time) {
+	if h == nil || len(key) == 0 {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	for _, entry := range h.entries[key] {
+		if entry.UID == UID && entry.DeletedAt == 0 {
+			entry.DeletedAt = now.UnixMilli()
+		}
+	}
+	h.expire(now)
+}
+
+// DeleteMissing 将不在alive中的资源全部标记为失效, 用于Reset
+func (h *History) DeleteMissing(alive map[resource.ResUID]struct{}, now time.Time) {
+	if h == nil {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	ts := now.UnixMilli()
+	for _, entries := range h.entries {
+		for _, entry := range entries {
+			if _, find := alive[entry.UID]; !find && entry.DeletedAt == 0 {
+				entry.DeletedAt = ts
+			}
+		}
+	}
+	h.expire(now)
+}
+
+// Lookup 查询ts时刻key对应的资源
+// ts早于所有记录时(例如启动前已存在的资源), 返回最早的记录
+func (h *History) Lookup(key string, ts time.Time) (*HistoryEntry, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	entries := h.entries[key]
+	if len(entries) == 0 {
+		return nil, false
+	}
+	// 返回副本, 避免读取时与Record/Delete并发修改
+	tsMilli := ts.UnixMilli()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].contains(tsMilli) {
+			entry := *entries[i]
+			return &entry, true
+		}
+	}
+	if tsMilli < entries[0].FirstSeen {
+		entry := *entries[0]
+		return &entry, true
+	}
+	return nil, false
+}
+
+// expire 清理超过保留时长的记录, 最多每半个保留周期执行一次
+func (h *History) expire(now time.Time) {
+	if now.Sub(h.lastExpire) < h.retention/2 {
+		return
+	}
+	h.lastExpire = now
+
+	deadline := now.Add(-h.retention).UnixMilli()
+	for key, entries := range h.entries {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.DeletedAt == 0 || entry.DeletedAt > deadline {
+				kept = append(kept, entry)
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.entries, key)
+		} else {
+			h.entries[key] = kept
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryIPReuse(t *testing.T) {
+	h := NewHistory(10 * time.Minute)
+	start := time.UnixMilli(1_700_000_000_000)
+
+	h.Record("10.0.0.1", "pod-a", "a", start)
+	h.Delete("10.0.0.1", "pod-a", start.Add(time.Minute))
+	h.Record("10.0.0.1", "pod-b", "b", start.Add(2*time.Minute))
+
+	tests := []struct {
+		name string
+		ts   time.Time
+		want any
+		find bool
+	}{
+		{name: "before first seen", ts: start.Add(-time.Hour), want: "a", find: true},
+		{name: "pod-a alive", ts: start.Add(30 * time.Second), want: "a", find: true},
+		{name: "gap between pods", ts: start.Add(90 * time.Second), find: false},
+		{name: "pod-b alive", ts: start.Add(3 * time.Minute), want: "b", find: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, find := h.Lookup("10.0.0.1", tt.ts)
+			assert.Equal(t, tt.find, find)
+			if find {
+				assert.Equal(t, tt.want, entry.Object)
+			}
+		})
+	}
+
+	// 超过保留时长后删除pod-a的记录
+	h.Record("10.0.0.2", "pod-c", "c", start.Add(20*time.Minute))
+	entry, find := h.Lookup("10.0.0.1", start.Add(30*time.Second))
+	assert.True(t, find)
+	assert.Equal(t, "b", entry.Object)
+}
+
+func TestGetPodByIPAt(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := PodListWithRetention(time.Hour)(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	oldPod := testWorkload(resource.PodType, "old", "old", nil)
+	oldPod.StringAttr[resource.PodIP] = "10.0.0.1"
+	podList.AddResource(oldPod)
+	beforeDelete := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	podList.DeleteResource(oldPod)
+
+	newPod := testWorkload(resource.PodType, "new", "new", nil)
+	newPod.StringAttr[resource.PodIP] = "10.0.0.1"
+	podList.AddResource(newPod)
+
+	pod, find := q.GetPodByIPAt("", "10.0.0.1", beforeDelete)
+	assert.True(t, find)
+	assert.Equal(t, "old", pod.Name)
+
+	pod, find = q.GetPodByIPAt("", "10.0.0.1", time.Now())
+	assert.True(t, find)
+	assert.Equal(t, "new", pod.Name)
+}
+
+func TestQueryResourceAt(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := NewPodList(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	pod := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	pod.StringAttr[resource.PodIP] = "10.0.0.1"
+	podList.AddResource(pod)
+
+	// 未保留历史时查询当前资源, 有效区间未知
+	resp := &ResInfo{}
+	err := q.queryResourceAt(&QueryResRequest{ResType: resource.PodType, IP: "10.0.0.1", Timestamp: 1}, resp)
+	assert.NoError(t, err)
+	assert.True(t, resp.IsFind)
+	assert.Nil(t, resp.Validity)
+
+	// 没有历史的类型不按Service查询
+	err = q.queryResourceAt(&QueryResRequest{ResType: resource.NamespaceType, IP: "10.0.0.1", Timestamp: 1}, &ResInfo{})
+	assert.ErrorContains(t, err, "Namespace")
+}
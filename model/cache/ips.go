@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"strings"
+)
+
+// splitList 解析ip1,ip2,...格式的属性
+func splitList(value string) []string {
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// appendIPs 追加不重复的IP, 忽略空值和Headless Service的None
+func appendIPs(ips []string, values ...string) []string {
+	for _, ip := range values {
+		if len(ip) == 0 || ip == "None" || containsIP(ips, ip) {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+func containsIP(ips []string, ip string) bool {
+	for _, existed := range ips {
+		if existed == ip {
+			return true
+		}
+	}
+	return false
+}
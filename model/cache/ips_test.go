@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDualStackPod(t *testing.T) {
+	podList := NewPodList(resource.PodType, nil).(*PodList)
+	podList.SetExporter(nonExporter{})
+
+	pod := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	pod.StringAttr[resource.PodIP] = "10.0.0.1"
+	pod.StringAttr[resource.PodIPs] = "10.0.0.1,fd00::1"
+	podList.AddResource(pod)
+
+	for _, ip := range []string{"10.0.0.1", "fd00::1"} {
+		found, find := podList.Index().IP2PodMap.Load(ip)
+		assert.True(t, find)
+		assert.Equal(t, "web-0", found.(*Pod).Name)
+	}
+
+	updated := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	updated.StringAttr[resource.PodIP] = "10.0.0.1"
+	updated.StringAttr[resource.PodIPs] = "10.0.0.1,fd00::2"
+	podList.UpdateResource(updated)
+	_, find := podList.Index().IP2PodMap.Load("fd00::1")
+	assert.False(t, find)
+	_, find = podList.Index().IP2PodMap.Load("fd00::2")
+	assert.True(t, find)
+
+	podList.DeleteResource(updated)
+	_, find = podList.Index().IP2PodMap.Load("10.0.0.1")
+	assert.False(t, find)
+	_, find = podList.Index().IP2PodMap.Load("fd00::2")
+	assert.False(t, find)
+}
+
+func TestResetHostNetworkPod(t *testing.T) {
+	web := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	web.StringAttr[resource.PodIP] = "10.0.0.1"
+	agent := testWorkload(resource.PodType, "pod-2", "agent-0", nil)
+	agent.StringAttr[resource.PodIP] = "192.168.0.1"
+	agent.StringAttr[resource.PodHostIP] = "192.168.0.1"
+	agent.Int64Attr[resource.PodHostNetwork] = 1
+	resList := []*resource.Resource{web, agent}
+
+	// MetaSource只通过Reset接收全量数据, hostNetwork的Pod同样不能占用NodeIP
+	created := NewPodList(resource.PodType, resList).(*PodList)
+	podList := NewPodList(resource.PodType, nil).(*PodList)
+	podList.SetExporter(nonExporter{})
+	podList.Reset(resList)
+	for _, pl := range []*PodList{created, podList} {
+		_, find := pl.Index().IP2PodMap.Load("10.0.0.1")
+		assert.True(t, find)
+		_, find = pl.Index().IP2PodMap.Load("192.168.0.1")
+		assert.False(t, find)
+		_, find = pl.Index().UIDMap.Load(resource.ResUID("pod-2"))
+		assert.True(t, find)
+	}
+}
+
+func TestMultiIPService(t *testing.T) {
+	serviceList := NewServiceList(resource.ServiceType, nil).(*ServiceList)
+	serviceList.SetExporter(nonExporter{})
+
+	service := testWorkload(resource.ServiceType, "svc-1", "web", nil)
+	service.StringAttr[resource.ServiceIP] = "10.96.0.10"
+	service.StringAttr[resource.ServiceIPs] = "10.96.0.10,fd00:96::10"
+	service.StringAttr[resource.ServiceExternalIPs] = "192.168.1.10,35.1.2.3"
+	serviceList.AddResource(service)
+
+	for _, ip := range []string{"10.96.0.10", "fd00:96::10", "192.168.1.10", "35.1.2.3"} {
+		found, find := serviceList.Index().IP2ServiceMap.Load(ip)
+		assert.True(t, find, ip)
+		assert.Equal(t, "web", found.(*Service).Name)
+	}
+
+	// Headless Service
+	headless := testWorkload(resource.ServiceType, "svc-2", "db", nil)
+	headless.StringAttr[resource.ServiceIP] = "None"
+	headless.StringAttr[resource.ServiceIPs] = "None"
+	serviceList.AddResource(headless)
+	_, find := serviceList.Index().IP2ServiceMap.Load("None")
+	assert.False(t, find)
+
+	serviceList.DeleteResource(service)
+	_, find = serviceList.Index().IP2ServiceMap.Load("35.1.2.3")
+	assert.False(t, find)
+}
+
+func TestMultiIPNode(t *testing.T) {
+	nodeList := NewNodeList(resource.NodeType, nil).(*NodeList)
+	nodeList.SetExporter(nonExporter{})
+
+	node := testWorkload(resource.NodeType, "node-1", "node-1", nil)
+	node.StringAttr[resource.NodeInternalIP] = "172.16.0.1"
+	node.StringAttr[resource.NodeIPs] = "172.16.0.1,fd00:16::1,35.0.0.1"
+	nodeList.AddResource(node)
+
+	for _, ip := range []string{"172.16.0.1", "fd00:16::1", "35.0.0.1"} {
+		assert.NotNil(t, nodeList.GetNodeByIP(ip), ip)
+	}
+
+	updated := testWorkload(resource.NodeType, "node-1", "node-1", nil)
+	updated.StringAttr[resource.NodeInternalIP] = "172.16.0.1"
+	updated.StringAttr[resource.NodeIPs] = "172.16.0.1"
+	nodeList.UpdateResource(updated)
+	assert.Nil(t, nodeList.GetNodeByIP("fd00:16::1"))
+	assert.NotNil(t, nodeList.GetNodeByIP("172.16.0.1"))
+}
+
+func TestResetKeepsLookupsAvailable(t *testing.T) {
+	web := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	web.StringAttr[resource.PodIP] = "10.0.0.1"
+	podList := NewPodList(resource.PodType, nil).(*PodList)
+	podList.SetExporter(nonExporter{})
+	podList.Reset([]*resource.Resource{web})
+
+	// Reset期间一直存在的Pod不能查询不到
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			podList.Reset([]*resource.Resource{web})
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		_, find := podList.Index().IP2PodMap.Load("10.0.0.1")
+		if !assert.True(t, find) {
+			<-done
+			return
+		}
+	}
+}
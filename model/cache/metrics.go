@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var cacheResourcesDesc = prometheus.NewDesc(
+	"metadata_cache_resources",
+	"Number of resources in the query cache.",
+	[]string{"cluster", "res_type"}, nil,
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheCollector{})
+}
+
+// cacheCollector 在采集时统计Querier中各集群各类型的资源数量
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheResourcesDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	switch cacheMap := Querier.CacheMap.(type) {
+	case *SingleClusterCacheMap:
+		collectHandlerMap(ch, cacheMap.Handlers)
+	case *ClusterCacheMap:
+		cacheMap.Caches.Range(func(_, value any) bool {
+			collectHandlerMap(ch, value.(*HandlerMap))
+			return true
+		})
+	}
+}
+
+func collectHandlerMap(ch chan<- prometheus.Metric, handlerMap *HandlerMap) {
+	handlerMap.RLock()
+	defer handlerMap.RUnlock()
+	for resType, handler := range handlerMap.Handlers {
+		ref, ok := handler.(interface{ ResourcesRef() *resource.Resources })
+		if !ok {
+			continue
+		}
+		resources := ref.ResourcesRef()
+		ch <- prometheus.MustNewConstMetric(cacheResourcesDesc, prometheus.GaugeValue,
+			float64(resources.Len()), resources.ClusterID, resType.Kind())
+	}
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+var _ resource.ResHandler = &NamespaceList{}
+
+type NamespaceList struct {
+	*resource.Resources
+	index atomic.Pointer[NamespaceIndex]
+}
+
+// NamespaceIndex NamespaceList的查询表, Reset时重建后整体替换
+type NamespaceIndex struct {
+	// Namespace UID -> *Namespace
+	UIDMap sync.Map
+	// Name -> *Namespace
+	NameMap sync.Map
+}
+
+func (idx *NamespaceIndex) store(namespace *Namespace) {
+	idx.UIDMap.Store(namespace.ResUID, namespace)
+	idx.NameMap.Store(namespace.Name, namespace)
+}
+
+func NewNamespaceList(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+	nl := &NamespaceList{
+		Resources: &resource.Resources{
+			ResType: resource.NamespaceType,
+			ResList: resList,
+		},
+	}
+	nl.index.Store(newNamespaceIndex(resList))
+
+	if resList == nil {
+		nl.Resources.ResList = []*resource.Resource{}
+	}
+	return nl
+}
+
+func newNamespaceIndex(resList []*resource.Resource) *NamespaceIndex {
+	idx := &NamespaceIndex{}
+	for _, res := range resList {
+		idx.store(&Namespace{Resource: res})
+	}
+	return idx
+}
+
+// Index 当前的查询表
+func (nl *NamespaceList) Index() *NamespaceIndex {
+	return nl.index.Load()
+}
+
+func (nl *NamespaceList) Reset(resList []*resource.Resource) {
+	// 重建后整体替换, 期间的查询仍使用旧的查询表
+	nl.index.Store(newNamespaceIndex(resList))
+	nl.Resources.Reset(resList)
+}
+
+func (nl *NamespaceList) AddResource(res *resource.Resource) {
+	nl.Index().store(&Namespace{Resource: res})
+	nl.Resources.AddResource(res)
+}
+
+func (nl *NamespaceList) UpdateResource(res *resource.Resource) {
+	nl.Index().store(&Namespace{Resource: res})
+	nl.Resources.UpdateResource(res)
+}
+
+func (nl *NamespaceList) DeleteResource(res *resource.Resource) {
+	idx := nl.Index()
+	oldRef, find := idx.UIDMap.LoadAndDelete(res.ResUID)
+	if find {
+		idx.NameMap.Delete(oldRef.(*Namespace).Name)
+	}
+	nl.Resources.DeleteResource(res)
+}
+
+func (nl *NamespaceList) GetNamespaceByName(name string) (*Namespace, bool) {
+	ref, find := nl.Index().NameMap.Load(name)
+	if !find {
+		return nil, false
+	}
+	return ref.(*Namespace), true
+}
+
+type Namespace struct {
+	*resource.Resource
+}
+
+func (n *Namespace) Labels() map[string]string {
+	return n.ExtraAttr[resource.NamespaceLabelsAttr]
+}
+
+func (n *Namespace) Annotations() map[string]string {
+	return n.ExtraAttr[resource.NamespaceAnnotationsAttr]
+}
+
+const (
+	NAMESPACE_PHASE_ACTIVE      = "Active"
+	NAMESPACE_PHASE_TERMINATING = "Terminating"
+)
+
+func (n *Namespace) Phase() string {
+	return n.StringAttr[resource.NamespacePhase]
+}
+
+// CreationTime 创建时间, unix时间戳(秒)
+func (n *Namespace) CreationTime() int64 {
+	return n.Int64Attr[resource.NamespaceCreationTime]
+}
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CloudDetail/metadata/model/resource"
 )
@@ -10,54 +12,83 @@ var _ resource.ResHandler = &NodeList{}
 
 type NodeList struct {
 	*resource.Resources
+	index atomic.Pointer[NodeIndex]
 
+	// 保留已删除Node的历史, 用于按时间查询; 未设置保留时长时为nil
+	IPHistory *History
+}
+
+// NodeIndex NodeList的查询表, Reset时重建后整体替换
+type NodeIndex struct {
 	UIDMap  sync.Map
 	IP2Node sync.Map
 }
 
+func (idx *NodeIndex) store(node *Node) {
+	for _, ip := range node.NodeIPs() {
+		idx.IP2Node.Store(ip, node)
+	}
+	idx.UIDMap.Store(node.ResUID, node)
+}
+
 func NewNodeList(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+	return newNodeList(resList, 0)
+}
+
+// NodeListWithRetention 返回的模版创建的NodeList保留retention内已删除Node的历史, 用于按时间查询
+func NodeListWithRetention(retention time.Duration) resource.HandlerTemplate {
+	return func(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+		return newNodeList(resList, retention)
+	}
+}
+
+func newNodeList(resList []*resource.Resource, retention time.Duration) *NodeList {
 	nl := &NodeList{
 		Resources: &resource.Resources{
 			ResType: resource.NodeType,
 			ResList: resList,
 		},
+		IPHistory: NewHistory(retention),
 	}
+	nl.index.Store(nl.buildIndex(resList, time.Now()))
 
 	if resList == nil {
 		nl.Resources.ResList = []*resource.Resource{}
-		return nl
 	}
+	return nl
+}
 
-	// 重建查询表
+// buildIndex 根据resList重建查询表并记录历史
+func (nl *NodeList) buildIndex(resList []*resource.Resource, now time.Time) *NodeIndex {
+	idx := &NodeIndex{}
 	for _, res := range resList {
-		node := Node{
-			Resource: res,
-		}
-		nl.IP2Node.Store(node.NodeIP(), &node)
-		nl.UIDMap.Store(node.ResUID, &node)
+		node := &Node{Resource: res}
+		idx.store(node)
+		nl.recordHistory(node, now)
 	}
+	return idx
+}
 
-	return nl
+// Index 当前的查询表
+func (nl *NodeList) Index() *NodeIndex {
+	return nl.index.Load()
 }
 
 func (nl *NodeList) Reset(resList []*resource.Resource) {
-	newIP2NodeMap := sync.Map{}
-	newNodeUIDMap := sync.Map{}
-	// 重建查询表
+	now := time.Now()
+	alive := make(map[resource.ResUID]struct{}, len(resList))
 	for _, res := range resList {
-		node := Node{
-			Resource: res,
-		}
-		newIP2NodeMap.Store(node.NodeIP(), &node)
-		newNodeUIDMap.Store(node.ResUID, &node)
+		alive[res.ResUID] = struct{}{}
 	}
-	nl.IP2Node = newIP2NodeMap
-	nl.UIDMap = newNodeUIDMap
+	nl.IPHistory.DeleteMissing(alive, now)
+
+	// 重建后整体替换, 期间的查询仍使用旧的查询表
+	nl.index.Store(nl.buildIndex(resList, now))
 	nl.Resources.Reset(resList)
 }
 
 func (nl *NodeList) GetNodeByIP(nodeIP string) *Node {
-	val, find := nl.IP2Node.Load(nodeIP)
+	val, find := nl.Index().IP2Node.Load(nodeIP)
 	if find {
 		return val.(*Node)
 	}
@@ -65,29 +96,31 @@ func (nl *NodeList) GetNodeByIP(nodeIP string) *Node {
 }
 
 func (nl *NodeList) AddResource(res *resource.Resource) {
-	node := Node{
-		Resource: res,
-	}
-	nl.IP2Node.Store(node.NodeIP(), &node)
-	nl.UIDMap.Store(node.ResUID, &node)
+	node := &Node{Resource: res}
+	nl.Index().store(node)
+	nl.recordHistory(node, time.Now())
 	nl.Resources.AddResource(res)
 }
 
 func (nl *NodeList) UpdateResource(res *resource.Resource) {
-	node := Node{
-		Resource: res,
-	}
+	node := &Node{Resource: res}
 
-	oldNode, find := nl.UIDMap.Load(res.ResUID)
+	idx := nl.Index()
+	oldNode, find := idx.UIDMap.Load(res.ResUID)
 	if find {
-		oldNode, ok := oldNode.(*Node)
-		if ok && oldNode.NodeIP() != node.NodeIP() {
-			nl.IP2Node.Delete(oldNode.NodeIP())
+		if oldNode, ok := oldNode.(*Node); ok {
+			newIPs := node.NodeIPs()
+			for _, ip := range oldNode.NodeIPs() {
+				if !containsIP(newIPs, ip) {
+					deleteIfOwnedBy(&idx.IP2Node, ip, oldNode.ResUID)
+					nl.IPHistory.Delete(ip, oldNode.ResUID, time.Now())
+				}
+			}
 		}
 	}
 
-	nl.IP2Node.Store(node.NodeIP(), &node)
-	nl.UIDMap.Store(node.ResUID, &node)
+	idx.store(node)
+	nl.recordHistory(node, time.Now())
 	nl.Resources.UpdateResource(res)
 }
 
@@ -95,11 +128,21 @@ func (nl *NodeList) DeleteResource(res *resource.Resource) {
 	node := Node{
 		Resource: res,
 	}
-	nl.IP2Node.Delete(node.NodeIP())
-	nl.UIDMap.Delete(node.ResUID)
+	idx := nl.Index()
+	for _, ip := range node.NodeIPs() {
+		deleteIfOwnedBy(&idx.IP2Node, ip, node.ResUID)
+		nl.IPHistory.Delete(ip, node.ResUID, time.Now())
+	}
+	idx.UIDMap.Delete(node.ResUID)
 	nl.Resources.DeleteResource(res)
 }
 
+func (nl *NodeList) recordHistory(node *Node, now time.Time) {
+	for _, ip := range node.NodeIPs() {
+		nl.IPHistory.Record(ip, node.ResUID, node, now)
+	}
+}
+
 type Node struct {
 	*resource.Resource
 }
@@ -112,6 +155,12 @@ func (node *Node) NodeIP() string {
 	return node.StringAttr[resource.NodeExternalIP]
 }
 
+// NodeIPs Node的全部InternalIP和ExternalIP, 第一个为NodeIP
+func (node *Node) NodeIPs() []string {
+	ips := appendIPs(nil, node.NodeIP())
+	return appendIPs(ips, splitList(node.StringAttr[resource.NodeIPs])...)
+}
+
 func (node *Node) InternalIP() string {
 	return node.StringAttr[resource.NodeInternalIP]
 }
@@ -123,3 +172,7 @@ func (node *Node) ExternalIP() string {
 func (node *Node) NodeHostName() string {
 	return node.StringAttr[resource.NodeHostName]
 }
+
+func (node *Node) Labels() map[string]string {
+	return node.ExtraAttr[resource.NodeLabelsAttr]
+}
@@ -3,6 +3,8 @@ package cache
 import (
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CloudDetail/metadata/model/resource"
 )
@@ -11,128 +13,201 @@ var _ resource.ResHandler = &PodList{}
 
 type PodList struct {
 	*resource.Resources
+	index atomic.Pointer[PodIndex]
+
+	// 保留已删除Pod的历史, 用于按时间查询; 未设置保留时长时为nil
+	IPHistory          *History
+	ContainerIDHistory *History
+}
+
+// PodIndex PodList的查询表, Reset时重建后整体替换
+type PodIndex struct {
 	// POD UID -> *Pod
 	UIDMap sync.Map
 	// Namespace/Name -> *Pod
 	PodMap sync.Map
 	// ContainerID -> *Pod
 	ContainerID2Pod sync.Map
+	// ContainerID -> *Container, 数据源提供R_CONTAINER关系时可用
+	ContainerID2Container sync.Map
+	// HostIP:Port/Protocol -> *Pod, 占用节点端口的Pod, 包括hostNetwork的Pod
+	HostPort2Pod sync.Map
 	// IP -> *Pod only store not hostNetwork IP
 	// TODO 重写sync.Map的store方法,丢弃key为空的记录
 	IP2PodMap sync.Map
 }
 
+func (idx *PodIndex) store(pod *Pod) {
+	idx.UIDMap.Store(pod.ResUID, pod)
+	idx.PodMap.Store(pod.NS()+"/"+pod.Name, pod)
+	idx.storeContainers(pod)
+	if !pod.IsHostNetWork() {
+		for _, ip := range pod.PodIPs() {
+			idx.IP2PodMap.Store(ip, pod)
+		}
+	}
+}
+
+// storeContainers 更新容器ID和节点端口索引
+func (idx *PodIndex) storeContainers(pod *Pod) {
+	for _, containerID := range pod.ContainerIDs() {
+		idx.ContainerID2Pod.Store(containerID, pod)
+	}
+	for _, container := range pod.Containers() {
+		idx.ContainerID2Container.Store(container.ShortID(), container)
+	}
+	for _, key := range pod.hostPortKeys() {
+		idx.HostPort2Pod.Store(key, pod)
+	}
+}
+
+func (idx *PodIndex) deleteContainers(pod *Pod) {
+	for _, containerID := range pod.ContainerIDs() {
+		idx.ContainerID2Pod.Delete(containerID)
+		idx.ContainerID2Container.Delete(containerID)
+	}
+	for _, key := range pod.hostPortKeys() {
+		deleteIfOwnedBy(&idx.HostPort2Pod, key, pod.ResUID)
+	}
+}
+
 func NewPodList(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+	return newPodList(resList, 0)
+}
+
+// PodListWithRetention 返回的模版创建的PodList保留retention内已删除Pod的历史, 用于按时间查询
+func PodListWithRetention(retention time.Duration) resource.HandlerTemplate {
+	return func(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+		return newPodList(resList, retention)
+	}
+}
+
+func newPodList(resList []*resource.Resource, retention time.Duration) *PodList {
 	pl := &PodList{
 		Resources: &resource.Resources{
 			ResType: resource.PodType,
 			ResList: resList,
 		},
+		IPHistory:          NewHistory(retention),
+		ContainerIDHistory: NewHistory(retention),
 	}
+	pl.index.Store(pl.buildIndex(resList, time.Now()))
 
 	if resList == nil {
 		pl.Resources.ResList = []*resource.Resource{}
-		return pl
 	}
+	return pl
+}
 
-	// 重建查询表
+// buildIndex 根据resList重建查询表并记录历史
+func (pl *PodList) buildIndex(resList []*resource.Resource, now time.Time) *PodIndex {
+	idx := &PodIndex{}
 	for _, res := range resList {
-		pod := Pod{
-			Resource: res,
-		}
-		pl.UIDMap.Store(pod.ResUID, &pod)
-		pl.PodMap.Store(pod.NS()+"/"+pod.Name, &pod)
-		pl.IP2PodMap.Store(pod.PodIP(), &pod)
-		for _, containerID := range pod.ContainerIDs() {
-			pl.ContainerID2Pod.Store(containerID, &pod)
-		}
+		pod := &Pod{Resource: res}
+		idx.store(pod)
+		pl.recordHistory(pod, now)
 	}
-	return pl
+	return idx
+}
+
+// Index 当前的查询表
+func (pl *PodList) Index() *PodIndex {
+	return pl.index.Load()
 }
 
 func (pl *PodList) Reset(resList []*resource.Resource) {
-	newPodMap := sync.Map{}
-	newContainerId2Pod := sync.Map{}
-	newPodUIDMap := sync.Map{}
-	newPodIP2Pod := sync.Map{}
-	// 重建查询表
+	now := time.Now()
+	alive := make(map[resource.ResUID]struct{}, len(resList))
 	for _, res := range resList {
-		pod := Pod{
-			Resource: res,
-		}
-		newPodUIDMap.Store(pod.ResUID, &pod)
-		newPodMap.Store(pod.NS()+"/"+pod.Name, &pod)
-		for _, containerID := range pod.ContainerIDs() {
-			newContainerId2Pod.Store(containerID, &pod)
-		}
-		newPodIP2Pod.Store(pod.PodIP(), &pod)
+		alive[res.ResUID] = struct{}{}
 	}
+	pl.IPHistory.DeleteMissing(alive, now)
+	pl.ContainerIDHistory.DeleteMissing(alive, now)
 
-	// !!! 这里的赋值包含了锁拷贝,
-	// newxxxMap必须只在当前线程内使用 才是线程安全的
-	pl.PodMap = newPodMap
-	pl.UIDMap = newPodUIDMap
-	pl.ContainerID2Pod = newContainerId2Pod
-	pl.IP2PodMap = newPodIP2Pod
+	// 重建后整体替换, 期间的查询仍使用旧的查询表
+	pl.index.Store(pl.buildIndex(resList, now))
 	pl.Resources.Reset(resList)
 }
 
 func (pl *PodList) AddResource(res *resource.Resource) {
-	pod := Pod{
-		Resource: res,
-	}
-
-	pl.UIDMap.Store(pod.ResUID, &pod)
-	pl.PodMap.Store(pod.NS()+"/"+pod.Name, &pod)
-	for _, containerID := range pod.ContainerIDs() {
-		pl.ContainerID2Pod.Store(containerID, &pod)
-	}
-	if !pod.IsHostNetWork() {
-		pl.IP2PodMap.Store(pod.PodIP(), &pod)
-	}
+	pod := &Pod{Resource: res}
+	pl.Index().store(pod)
+	pl.recordHistory(pod, time.Now())
 	pl.Resources.AddResource(res)
 }
 
 func (pl *PodList) UpdateResource(res *resource.Resource) {
-	oldPod, find := pl.UIDMap.Load(res.ResUID)
+	now := time.Now()
+	newPod := &Pod{Resource: res}
+	idx := pl.Index()
+	oldPod, find := idx.UIDMap.Load(res.ResUID)
 	if find {
-		for _, containerID := range oldPod.(*Pod).ContainerIDs() {
-			pl.ContainerID2Pod.Delete(containerID)
+		idx.deleteContainers(oldPod.(*Pod))
+		for _, ip := range oldPod.(*Pod).PodIPs() {
+			deleteIfOwnedBy(&idx.IP2PodMap, ip, res.ResUID)
 		}
-		pl.IP2PodMap.Delete(oldPod.(*Pod).PodIP())
+		pl.deleteStaleHistory(oldPod.(*Pod), newPod, now)
 	}
 
-	newPod := Pod{
-		Resource: res,
-	}
-	for _, containerID := range newPod.ContainerIDs() {
-		pl.ContainerID2Pod.Store(containerID, &newPod)
-	}
-	if !newPod.IsHostNetWork() {
-		pl.IP2PodMap.Store(newPod.PodIP(), &newPod)
-	}
-	pl.UIDMap.Store(newPod.ResUID, &newPod)
-	pl.PodMap.Store(newPod.NS()+"/"+newPod.Name, &newPod)
+	idx.store(newPod)
+	pl.recordHistory(newPod, now)
 	pl.Resources.UpdateResource(res)
 }
 
 func (pl *PodList) DeleteResource(res *resource.Resource) {
-	oldPodRef, find := pl.UIDMap.LoadAndDelete(res.ResUID)
+	idx := pl.Index()
+	oldPodRef, find := idx.UIDMap.LoadAndDelete(res.ResUID)
 	if !find {
 		return
 	}
 	oldPod := oldPodRef.(*Pod)
-	pl.IP2PodMap.Delete(oldPod.PodIP())
-	pl.UIDMap.Delete(oldPod.ResUID)
-	pl.PodMap.Delete(oldPod.NS() + "/" + oldPod.Name)
-
-	for _, containerID := range oldPod.ContainerIDs() {
-		pl.ContainerID2Pod.Delete(containerID)
+	// IP可能已经被新的Pod复用
+	for _, ip := range oldPod.PodIPs() {
+		deleteIfOwnedBy(&idx.IP2PodMap, ip, oldPod.ResUID)
 	}
+	idx.PodMap.Delete(oldPod.NS() + "/" + oldPod.Name)
+
+	idx.deleteContainers(oldPod)
+	pl.deleteStaleHistory(oldPod, nil, time.Now())
 
 	pl.Resources.DeleteResource(res)
 }
 
+func (pl *PodList) recordHistory(pod *Pod, now time.Time) {
+	if !pod.IsHostNetWork() {
+		for _, ip := range pod.PodIPs() {
+			pl.IPHistory.Record(ip, pod.ResUID, pod, now)
+		}
+	}
+	for _, containerID := range pod.ContainerIDs() {
+		pl.ContainerIDHistory.Record(containerID, pod.ResUID, pod, now)
+	}
+}
+
+// deleteStaleHistory 标记oldPod中不再被newPod使用的IP和容器ID失效, newPod为nil表示Pod被删除
+func (pl *PodList) deleteStaleHistory(oldPod *Pod, newPod *Pod, now time.Time) {
+	var newIPs []string
+	newContainerIDs := map[string]struct{}{}
+	if newPod != nil {
+		if !newPod.IsHostNetWork() {
+			newIPs = newPod.PodIPs()
+		}
+		for _, containerID := range newPod.ContainerIDs() {
+			newContainerIDs[containerID] = struct{}{}
+		}
+	}
+	for _, ip := range oldPod.PodIPs() {
+		if !containsIP(newIPs, ip) {
+			pl.IPHistory.Delete(ip, oldPod.ResUID, now)
+		}
+	}
+	for _, containerID := range oldPod.ContainerIDs() {
+		if _, find := newContainerIDs[containerID]; !find {
+			pl.ContainerIDHistory.Delete(containerID, oldPod.ResUID, now)
+		}
+	}
+}
+
 type Pod struct {
 	*resource.Resource
 }
@@ -141,7 +216,18 @@ func (p *Pod) NS() string {
 	return p.StringAttr[resource.NamespaceAttr]
 }
 
+// ContainerIDs 短容器ID, 数据源提供R_CONTAINER关系时包括init和ephemeral容器
 func (p *Pod) ContainerIDs() []string {
+	var containerIDs []string
+	for _, relation := range p.Relations {
+		if relation.ReType == resource.R_CONTAINER {
+			containerIDs = append(containerIDs, shortContainerID(string(relation.ResUID)))
+		}
+	}
+	if len(containerIDs) > 0 {
+		return containerIDs
+	}
+
 	containerIds := p.StringAttr[resource.ContainerIDsAttr]
 	if len(containerIds) == 0 {
 		return []string{}
@@ -154,6 +240,35 @@ func (p *Pod) PodIP() string {
 	return p.StringAttr[resource.PodIP]
 }
 
+// PodIPs Pod的全部IP, 双栈时包括IPv4和IPv6地址, 第一个为PodIP
+func (p *Pod) PodIPs() []string {
+	ips := appendIPs(nil, p.PodIP())
+	return appendIPs(ips, splitList(p.StringAttr[resource.PodIPs])...)
+}
+
+// hostPortKeys 节点IP:端口/协议, hostNetwork的Pod同时使用PodIP
+func (p *Pod) hostPortKeys() []string {
+	ports := splitList(p.StringAttr[resource.PodHostPorts])
+	if len(ports) == 0 {
+		return nil
+	}
+	ips := appendIPs(nil, p.HostIP())
+	if p.IsHostNetWork() {
+		ips = appendIPs(ips, p.PodIPs()...)
+	}
+	keys := make([]string, 0, len(ips)*len(ports))
+	for _, ip := range ips {
+		for _, port := range ports {
+			portAndProtocol := strings.SplitN(port, "/", 2)
+			if len(portAndProtocol) != 2 {
+				continue
+			}
+			keys = append(keys, hostPortKey(ip, portAndProtocol[0], portAndProtocol[1]))
+		}
+	}
+	return keys
+}
+
 func (p *Pod) Labels() map[string]string {
 	return p.ExtraAttr[resource.PodLabelsAttr]
 }
@@ -189,29 +304,39 @@ type OwnerReferences struct {
 	Name string
 }
 
+// GetOwnerReferences guessDeployment为true时通过Querier的工作负载缓存解析真实的控制者,
+// 未配置查询缓存或未缓存对应的ReplicaSet时才根据名称推测Deployment; 已知集群时可以使用Query.GetPodOwnerReferences
 func (p *Pod) GetOwnerReferences(guessDeployment bool) []OwnerReferences {
+	if guessDeployment && Querier.CacheMap != nil {
+		// UID在各集群中唯一, 不限定集群
+		return Querier.GetPodOwnerReferences("", p, true)
+	}
 	var ownerRefs []OwnerReferences
 	for _, relation := range p.Relations {
 		if relation.ReType != resource.R_OWNER {
 			continue
 		}
 
-		ownerKind := relation.StringAttr[resource.OwnerType]
-		ownerName := relation.StringAttr[resource.OwnerName]
-		if ownerKind == "ReplicaSet" && guessDeployment {
-			// TODO 如果监控了ReplicaSet信息,对RS进一步解析
-			// 否则使用推测的Deployment信息
-			ownerKind = "Deployment"
-			lastPartIndex := strings.LastIndex(ownerName, "-")
-			if lastPartIndex > 0 && lastPartIndex < len(ownerName) {
-				ownerName = ownerName[:lastPartIndex]
-			}
-		}
-		ownerRefs = append(ownerRefs, OwnerReferences{
+		owner := OwnerReferences{
 			UID:  string(relation.ResUID),
-			Kind: ownerKind,
-			Name: ownerName,
-		})
+			Kind: relation.StringAttr[resource.OwnerType],
+			Name: relation.StringAttr[resource.OwnerName],
+		}
+		if owner.Kind == "ReplicaSet" && guessDeployment {
+			owner = guessDeploymentFromReplicaSet(owner)
+		}
+		ownerRefs = append(ownerRefs, owner)
 	}
 	return ownerRefs
 }
+
+// guessDeploymentFromReplicaSet 去掉ReplicaSet名称的最后一段作为Deployment名称
+// 推测结果中的UID仍为ReplicaSet的UID
+func guessDeploymentFromReplicaSet(owner OwnerReferences) OwnerReferences {
+	owner.Kind = "Deployment"
+	lastPartIndex := strings.LastIndex(owner.Name, "-")
+	if lastPartIndex > 0 && lastPartIndex < len(owner.Name) {
+		owner.Name = owner.Name[:lastPartIndex]
+	}
+	return owner
+}
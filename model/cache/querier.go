@@ -1,9 +1,11 @@
 package cache
 
 import (
-	"encoding/json"
+	"encoding/gob"
 	"net/http"
 
+	"github.com/CloudDetail/metadata/model/codec"
+	"github.com/CloudDetail/metadata/model/policy"
 	"github.com/CloudDetail/metadata/model/resource"
 )
 
@@ -12,9 +14,20 @@ var Querier = &Query{
 }
 var QueryInterface IQuery = Querier
 
+func init() {
+	// 使用gob编码查询结果时, 需要注册ResInfo.Object中可能出现的类型
+	gob.Register(&Pod{})
+	gob.Register([]*Pod{})
+	gob.Register(&Service{})
+	gob.Register([]*Service{})
+	gob.Register(&Node{})
+	gob.Register([]*Node{})
+}
+
 type IQuery interface {
 	SetCacheMap(cacheMap CacheMap)
 	QueryResource(w http.ResponseWriter, r *http.Request)
+	QueryREST(w http.ResponseWriter, r *http.Request)
 }
 
 type Query struct {
@@ -31,12 +44,43 @@ type QueryResRequest struct {
 	ResName      string
 	ResNamespace string
 	IP           string
+	ContainerID  string
 	ListAll      bool
+
+	// 按时间查询, unix毫秒; 为0时查询当前资源
+	Timestamp int64
+
+	// ListAll时的过滤和分页条件, ResNamespace作为Namespace过滤条件
+	LabelSelector string
+	NodeName      string
+	Phase         string
+	OwnerKind     string
+	OwnerName     string
+	Limit         int
+	Continue      string
+}
+
+func (req *QueryResRequest) listOptions() *ListOptions {
+	return &ListOptions{
+		Namespace:     req.ResNamespace,
+		LabelSelector: req.LabelSelector,
+		NodeName:      req.NodeName,
+		Phase:         req.Phase,
+		OwnerKind:     req.OwnerKind,
+		OwnerName:     req.OwnerName,
+		Limit:         req.Limit,
+		Continue:      req.Continue,
+	}
 }
 
 type ResInfo struct {
 	IsFind bool
 	Object any
+
+	// 按时间查询时, 返回资源的有效区间
+	Validity *Validity `json:",omitempty"`
+	// 分页查询时, 用于获取下一页; 为空表示没有更多数据
+	Continue string `json:",omitempty"`
 }
 
 func (q *Query) SetCacheMap(cacheMap CacheMap) {
@@ -45,36 +89,79 @@ func (q *Query) SetCacheMap(cacheMap CacheMap) {
 
 func (q *Query) QueryResource(w http.ResponseWriter, r *http.Request) {
 	var req QueryResRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	defer r.Body.Close()
+	reqCodec, err := codec.FromContentHeaders(r.Header)
 	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	err = reqCodec.Decode(r.Body, &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
 		return
 	}
-	defer r.Body.Close()
+
+	p := policy.FromContext(r.Context())
+	clusterID, allowed := p.ScopeCluster(req.ClusterID)
+	if !allowed {
+		writeError(w, http.StatusForbidden, "cluster %q is not allowed", req.ClusterID)
+		return
+	}
+	req.ClusterID = clusterID
 
 	resp := &ResInfo{
 		IsFind: false,
 		Object: nil,
 	}
 	if req.ListAll {
+		switch req.ResType {
+		case resource.PodType:
+			resp.Object, resp.Continue, err = q.ListPodWithOptions(req.ClusterID, req.listOptions())
+		case resource.ServiceType:
+			resp.Object, resp.Continue, err = q.ListServiceWithOptions(req.ClusterID, req.listOptions())
+		case resource.NodeType:
+			resp.Object, resp.Continue, err = q.ListNodeWithOptions(req.ClusterID, req.listOptions())
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		resp.IsFind = true
-		if req.ResType == resource.PodType {
-			resp.Object = q.ListPod(req.ClusterID)
-		} else if req.ResType == resource.ServiceType {
-			resp.Object = q.ListService(req.ClusterID)
+	} else if req.Timestamp > 0 {
+		if err = q.queryResourceAt(&req, resp); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
 		}
 	} else {
 		if req.ResType == resource.PodType {
-			resp.Object, resp.IsFind = q.GetPodByNSAndName(req.ClusterID, req.ResNamespace, req.ResName)
+			if len(req.IP) > 0 {
+				resp.Object, resp.IsFind = q.GetPodByIP(req.ClusterID, req.IP)
+			} else if len(req.ContainerID) > 0 {
+				resp.Object, resp.IsFind = q.GetPodByContainerId(req.ClusterID, req.ContainerID)
+			} else {
+				resp.Object, resp.IsFind = q.GetPodByNSAndName(req.ClusterID, req.ResNamespace, req.ResName)
+			}
+		} else if req.ResType == resource.NodeType {
+			resp.Object, resp.IsFind = q.GetNodeByIP(req.ClusterID, req.IP)
 		} else {
 			resp.Object, resp.IsFind = q.GetServiceByIP(req.ClusterID, req.IP)
 		}
 	}
 
-	data, err := json.Marshal(resp)
+	if resp.IsFind {
+		resp.Object, resp.IsFind = scopeObject(p, resp.Object)
+	}
+	if !resp.IsFind {
+		// 避免返回类型为*Pod的nil, gob无法编码接口中的nil指针
+		resp.Object = nil
+	}
+	respCodec := codec.Negotiate(r.Header)
+	data, err := respCodec.Marshal(resp)
 	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-
+	respCodec.SetContentHeaders(w.Header())
 	w.WriteHeader(http.StatusOK)
 	w.Write(data)
 }
@@ -92,17 +179,55 @@ func (q *Query) GetPodByContainerId(clusterID string, containerId string) (*Pod,
 			return nil, false
 		}
 		for _, handler := range handlers {
-			if podRef, find := handler.(*PodList).ContainerID2Pod.Load(containerId); find {
+			if podRef, find := handler.(*PodList).Index().ContainerID2Pod.Load(containerId); find {
 				return podRef.(*Pod), find
 			}
 		}
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		podRef, find := handler.(*PodList).ContainerID2Pod.Load(containerId)
-		return podRef.(*Pod), find
+		if podRef, find := handler.(*PodList).Index().ContainerID2Pod.Load(containerId); find {
+			return podRef.(*Pod), true
+		}
+	}
+
+	return nil, false
+}
+
+// handlersOf clusterID为空时返回全部集群的handler
+func (q *Query) handlersOf(clusterID string, resType resource.ResType) []resource.ResHandler {
+	if len(clusterID) > 0 {
+		if handler, find := q.GetCache(clusterID, resType); find {
+			return []resource.ResHandler{handler}
+		}
+		return nil
+	}
+	handlers, find := q.GetCaches(resType)
+	if !find {
+		return nil
 	}
+	return handlers
+}
 
+// GetContainerByID containerID为短ID或不含运行时前缀的完整ID
+func (q *Query) GetContainerByID(clusterID string, containerID string) (*Container, bool) {
+	if len(containerID) < shortContainerIDLen {
+		return nil, false
+	}
+	shortID := shortContainerID(containerID)
+
+	for _, handler := range q.handlersOf(clusterID, resource.PodType) {
+		podList, ok := handler.(*PodList)
+		if !ok {
+			continue
+		}
+		if containerRef, find := podList.Index().ContainerID2Container.Load(shortID); find {
+			container := containerRef.(*Container)
+			if container.MatchID(containerID) {
+				return container, true
+			}
+		}
+	}
 	return nil, false
 }
 
@@ -111,8 +236,9 @@ func (q *Query) GetPodByNSAndName(clusterID string, namespace string, name strin
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		podRef, find := handler.(*PodList).PodMap.Load(namespace + "/" + name)
-		return podRef.(*Pod), find
+		if podRef, find := handler.(*PodList).Index().PodMap.Load(namespace + "/" + name); find {
+			return podRef.(*Pod), true
+		}
 	}
 
 	return nil, false
@@ -123,8 +249,9 @@ func (q *Query) GetPodByUID(clusterID string, UID resource.ResUID) (*Pod, bool)
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		podRef, find := handler.(*PodList).UIDMap.Load(UID)
-		return podRef.(*Pod), find
+		if podRef, find := handler.(*PodList).Index().UIDMap.Load(UID); find {
+			return podRef.(*Pod), true
+		}
 	}
 
 	return nil, false
@@ -138,15 +265,15 @@ func (q *Query) ListService(clusterID string) (services []*Service) {
 		}
 
 		for _, handler := range handlers {
-			handler.(*ServiceList).ServiceMap.Range(func(_, serviceRef interface{}) bool {
+			handler.(*ServiceList).Index().ServiceMap.Range(func(_, serviceRef interface{}) bool {
 				services = append(services, serviceRef.(*Service))
 				return true
 			})
 		}
 		return services
 	}
-	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		handler.(*PodList).PodMap.Range(func(_, serviceRef interface{}) bool {
+	if handler, find := q.GetCache(clusterID, resource.ServiceType); find {
+		handler.(*ServiceList).Index().ServiceMap.Range(func(_, serviceRef interface{}) bool {
 			services = append(services, serviceRef.(*Service))
 			return true
 		})
@@ -162,7 +289,7 @@ func (q *Query) ListPod(clusterID string) (pods []*Pod) {
 			return nil
 		}
 		for _, handler := range handlers {
-			handler.(*PodList).PodMap.Range(func(_, podRef any) bool {
+			handler.(*PodList).Index().PodMap.Range(func(_, podRef any) bool {
 				pods = append(pods, podRef.(*Pod))
 				return true
 			})
@@ -170,7 +297,7 @@ func (q *Query) ListPod(clusterID string) (pods []*Pod) {
 		return pods
 	}
 	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		handler.(*PodList).PodMap.Range(func(_, podRef any) bool {
+		handler.(*PodList).Index().PodMap.Range(func(_, podRef any) bool {
 			pods = append(pods, podRef.(*Pod))
 			return true
 		})
@@ -189,15 +316,16 @@ func (q *Query) GetServiceByIP(clusterID string, serviceIP string) (*Service, bo
 			return nil, false
 		}
 		for _, handler := range handlers {
-			if serviceRef, find := handler.(*ServiceList).IP2ServiceMap.Load(serviceIP); find {
+			if serviceRef, find := handler.(*ServiceList).Index().IP2ServiceMap.Load(serviceIP); find {
 				return serviceRef.(*Service), find
 			}
 		}
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.ServiceType); find {
-		serviceRef, find := handler.(*ServiceList).IP2ServiceMap.Load(serviceIP)
-		return serviceRef.(*Service), find
+		if serviceRef, find := handler.(*ServiceList).Index().IP2ServiceMap.Load(serviceIP); find {
+			return serviceRef.(*Service), true
+		}
 	}
 
 	return nil, false
@@ -213,15 +341,16 @@ func (q *Query) GetPodByIP(clusterID string, podIP string) (*Pod, bool) {
 			return nil, false
 		}
 		for _, handler := range handlers {
-			if podRef, find := handler.(*PodList).IP2PodMap.Load(podIP); find {
+			if podRef, find := handler.(*PodList).Index().IP2PodMap.Load(podIP); find {
 				return podRef.(*Pod), find
 			}
 		}
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.PodType); find {
-		podRef, find := handler.(*PodList).IP2PodMap.Load(podIP)
-		return podRef.(*Pod), find
+		if podRef, find := handler.(*PodList).Index().IP2PodMap.Load(podIP); find {
+			return podRef.(*Pod), true
+		}
 	}
 	return nil, false
 }
@@ -236,15 +365,127 @@ func (q *Query) GetNodeByIP(clusterID string, IP string) (*Node, bool) {
 			return nil, false
 		}
 		for _, handler := range handlers {
-			if nodeRef, find := handler.(*NodeList).IP2Node.Load(IP); find {
+			if nodeRef, find := handler.(*NodeList).Index().IP2Node.Load(IP); find {
 				return nodeRef.(*Node), find
 			}
 		}
 		return nil, false
 	}
 	if handler, find := q.GetCache(clusterID, resource.NodeType); find {
-		nodeRef, find := handler.(*NodeList).IP2Node.Load(IP)
-		return nodeRef.(*Node), find
+		if nodeRef, find := handler.(*NodeList).Index().IP2Node.Load(IP); find {
+			return nodeRef.(*Node), true
+		}
 	}
 	return nil, false
 }
+
+// GetPodOwnerReferences 根据工作负载缓存解析Pod的完整控制链,返回最上层的控制者
+// 如 Pod -> ReplicaSet -> Deployment 返回Deployment, Pod -> Job -> CronJob 返回CronJob
+// 未监控对应工作负载时, guessDeployment为true则退化为根据ReplicaSet名称推测Deployment
+func (q *Query) GetPodOwnerReferences(clusterID string, pod *Pod, guessDeployment bool) []OwnerReferences {
+	var ownerRefs []OwnerReferences
+	for _, relation := range pod.Relations {
+		if relation.ReType != resource.R_OWNER {
+			continue
+		}
+
+		owner := OwnerReferences{
+			UID:  string(relation.ResUID),
+			Kind: relation.StringAttr[resource.OwnerType],
+			Name: relation.StringAttr[resource.OwnerName],
+		}
+		resolved, isResolved := q.resolveOwner(clusterID, owner)
+		if !isResolved && owner.Kind == "ReplicaSet" && guessDeployment {
+			resolved = guessDeploymentFromReplicaSet(owner)
+		}
+		ownerRefs = append(ownerRefs, resolved)
+	}
+	return ownerRefs
+}
+
+// maxOwnerDepth 防止异常数据导致的循环引用
+const maxOwnerDepth = 8
+
+func (q *Query) resolveOwner(clusterID string, owner OwnerReferences) (OwnerReferences, bool) {
+	var isResolved bool
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+		resType, find := resource.ResTypeFromKind(owner.Kind)
+		if !find {
+			return owner, isResolved
+		}
+		workload, find := q.GetWorkloadByUID(clusterID, resType, resource.ResUID(owner.UID))
+		if !find {
+			return owner, isResolved
+		}
+		isResolved = true
+		owner.Name = workload.Name
+
+		relation, hasOwner := workload.Owner()
+		if !hasOwner {
+			return owner, isResolved
+		}
+		owner = OwnerReferences{
+			UID:  string(relation.ResUID),
+			Kind: relation.StringAttr[resource.OwnerType],
+			Name: relation.StringAttr[resource.OwnerName],
+		}
+	}
+	return owner, isResolved
+}
+
+func (q *Query) GetWorkloadByUID(clusterID string, resType resource.ResType, UID resource.ResUID) (*Workload, bool) {
+	if len(UID) == 0 {
+		return nil, false
+	}
+	if len(clusterID) == 0 {
+		handlers, find := q.GetCaches(resType)
+		if !find {
+			return nil, false
+		}
+		for _, handler := range handlers {
+			if workloadList, ok := handler.(*WorkloadList); ok {
+				if workload, find := workloadList.GetWorkloadByUID(UID); find {
+					return workload, true
+				}
+			}
+		}
+		return nil, false
+	}
+	if handler, find := q.GetCache(clusterID, resType); find {
+		if workloadList, ok := handler.(*WorkloadList); ok {
+			return workloadList.GetWorkloadByUID(UID)
+		}
+	}
+	return nil, false
+}
+
+func (q *Query) GetNamespaceByName(clusterID string, name string) (*Namespace, bool) {
+	if len(name) == 0 {
+		return nil, false
+	}
+	if len(clusterID) == 0 {
+		handlers, find := q.GetCaches(resource.NamespaceType)
+		if !find {
+			return nil, false
+		}
+		for _, handler := range handlers {
+			if namespaceList, ok := handler.(*NamespaceList); ok {
+				if namespace, find := namespaceList.GetNamespaceByName(name); find {
+					return namespace, true
+				}
+			}
+		}
+		return nil, false
+	}
+	if handler, find := q.GetCache(clusterID, resource.NamespaceType); find {
+		if namespaceList, ok := handler.(*NamespaceList); ok {
+			return namespaceList.GetNamespaceByName(name)
+		}
+	}
+	return nil, false
+}
+
+// GetPodNamespace 返回Pod所在的Namespace, 用于根据Namespace标签归属Pod
+func (q *Query) GetPodNamespace(clusterID string, pod *Pod) (*Namespace, bool) {
+	return q.GetNamespaceByName(clusterID, pod.NS())
+}
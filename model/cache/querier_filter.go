@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ListOptions 列表查询的过滤和分页条件, 零值表示不过滤
+type ListOptions struct {
+	Namespace string
+	// K8s风格的标签选择器, 如 app=foo,tier in (web,api)
+	LabelSelector string
+
+	// Pod所在的节点名称; 查询Node时为节点名称
+	NodeName string
+	// Pod状态, 如 Running / Pending
+	Phase string
+	// Pod的控制者, 匹配直接控制者或解析后的最上层控制者
+	OwnerKind string
+	OwnerName string
+
+	// 单页返回的最大数量, 0表示不分页
+	Limit int
+	// 上一页返回的Continue, 为空表示从第一页开始
+	Continue string
+}
+
+type listFilter struct {
+	*ListOptions
+	selector labels.Selector
+	// 上一页最后一个资源的排序键
+	after string
+}
+
+func newListFilter(opts *ListOptions) (*listFilter, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	filter := &listFilter{
+		ListOptions: opts,
+		selector:    labels.Everything(),
+	}
+	if len(opts.LabelSelector) > 0 {
+		selector, err := labels.Parse(opts.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector: %w", err)
+		}
+		filter.selector = selector
+	}
+	if len(opts.Continue) > 0 {
+		after, err := base64.RawURLEncoding.DecodeString(opts.Continue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid continue token: %w", err)
+		}
+		filter.after = string(after)
+	}
+	return filter, nil
+}
+
+func (f *listFilter) matchLabels(resLabels map[string]string) bool {
+	return f.selector.Matches(labels.Set(resLabels))
+}
+
+func (f *listFilter) matchNamespace(namespace string) bool {
+	return len(f.Namespace) == 0 || f.Namespace == namespace
+}
+
+func (f *listFilter) matchOwner(owners ...[]OwnerReferences) bool {
+	if len(f.OwnerKind) == 0 && len(f.OwnerName) == 0 {
+		return true
+	}
+	for _, ownerRefs := range owners {
+		for _, owner := range ownerRefs {
+			if (len(f.OwnerKind) == 0 || f.OwnerKind == owner.Kind) &&
+				(len(f.OwnerName) == 0 || f.OwnerName == owner.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type sortKeyItem[T any] struct {
+	key string
+	obj T
+}
+
+// paginate 按排序键排序后返回after之后的一页, 以及下一页的Continue
+func paginate[T any](items []sortKeyItem[T], filter *listFilter) ([]T, string) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+	start := sort.Search(len(items), func(i int) bool {
+		return items[i].key > filter.after
+	})
+	items = items[start:]
+
+	var continueToken string
+	if filter.Limit > 0 && len(items) > filter.Limit {
+		items = items[:filter.Limit]
+		continueToken = base64.RawURLEncoding.EncodeToString([]byte(items[len(items)-1].key))
+	}
+
+	result := make([]T, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.obj)
+	}
+	return result, continueToken
+}
+
+func (q *Query) listHandlers(clusterID string, resType resource.ResType) []resource.ResHandler {
+	if len(clusterID) == 0 {
+		handlers, _ := q.GetCaches(resType)
+		return handlers
+	}
+	if handler, find := q.GetCache(clusterID, resType); find {
+		return []resource.ResHandler{handler}
+	}
+	return nil
+}
+
+// ListPodWithOptions 按条件查询Pod, 返回结果和下一页的Continue
+func (q *Query) ListPodWithOptions(clusterID string, opts *ListOptions) ([]*Pod, string, error) {
+	filter, err := newListFilter(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []sortKeyItem[*Pod]
+	for _, handler := range q.listHandlers(clusterID, resource.PodType) {
+		podList, ok := handler.(*PodList)
+		if !ok {
+			continue
+		}
+		podList.Index().PodMap.Range(func(_, podRef any) bool {
+			pod := podRef.(*Pod)
+			if !filter.matchNamespace(pod.NS()) ||
+				(len(filter.NodeName) > 0 && filter.NodeName != pod.NodeName()) ||
+				(len(filter.Phase) > 0 && filter.Phase != pod.Phase()) ||
+				!filter.matchLabels(pod.Labels()) {
+				return true
+			}
+			if !filter.matchOwner(pod.GetOwnerReferences(false), q.GetPodOwnerReferences(podList.ClusterID, pod, true)) {
+				return true
+			}
+			items = append(items, sortKeyItem[*Pod]{
+				key: podList.ClusterID + "/" + pod.NS() + "/" + pod.Name,
+				obj: pod,
+			})
+			return true
+		})
+	}
+	pods, continueToken := paginate(items, filter)
+	return pods, continueToken, nil
+}
+
+// ListServiceWithOptions 按条件查询Service, 支持Namespace和标签过滤
+func (q *Query) ListServiceWithOptions(clusterID string, opts *ListOptions) ([]*Service, string, error) {
+	filter, err := newListFilter(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []sortKeyItem[*Service]
+	for _, handler := range q.listHandlers(clusterID, resource.ServiceType) {
+		serviceList, ok := handler.(*ServiceList)
+		if !ok {
+			continue
+		}
+		serviceList.Index().ServiceMap.Range(func(_, serviceRef any) bool {
+			service := serviceRef.(*Service)
+			if !filter.matchNamespace(service.NS()) || !filter.matchLabels(service.Labels()) {
+				return true
+			}
+			items = append(items, sortKeyItem[*Service]{
+				key: serviceList.ClusterID + "/" + service.NS() + "/" + service.Name,
+				obj: service,
+			})
+			return true
+		})
+	}
+	services, continueToken := paginate(items, filter)
+	return services, continueToken, nil
+}
+
+// ListNodeWithOptions 按条件查询Node, 支持节点名称和标签过滤
+func (q *Query) ListNodeWithOptions(clusterID string, opts *ListOptions) ([]*Node, string, error) {
+	filter, err := newListFilter(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var items []sortKeyItem[*Node]
+	for _, handler := range q.listHandlers(clusterID, resource.NodeType) {
+		nodeList, ok := handler.(*NodeList)
+		if !ok {
+			continue
+		}
+		nodeList.Index().UIDMap.Range(func(_, nodeRef any) bool {
+			node := nodeRef.(*Node)
+			if (len(filter.NodeName) > 0 && filter.NodeName != node.Name) || !filter.matchLabels(node.Labels()) {
+				return true
+			}
+			items = append(items, sortKeyItem[*Node]{
+				key: nodeList.ClusterID + "/" + node.Name,
+				obj: node,
+			})
+			return true
+		})
+	}
+	nodes, continueToken := paginate(items, filter)
+	return nodes, continueToken, nil
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPodWithOptions(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := NewPodList(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	tiers := []string{"web", "api", "db"}
+	for i := 0; i < 6; i++ {
+		pod := testWorkload(resource.PodType, fmt.Sprintf("uid-%d", i), fmt.Sprintf("pod-%d", i),
+			ownerRelation("rs-uid", "ReplicaSet", "shop-5d8f7c"))
+		pod.StringAttr[resource.PodPhase] = POD_PHASE_RUNNING
+		pod.StringAttr[resource.PodHostName] = fmt.Sprintf("node-%d", i%2)
+		pod.ExtraAttr[resource.PodLabelsAttr] = map[string]string{
+			"app":  "shop",
+			"tier": tiers[i%3],
+		}
+		podList.AddResource(pod)
+	}
+
+	pods, continueToken, err := q.ListPodWithOptions("", &ListOptions{LabelSelector: "app=shop,tier in (web,api)"})
+	assert.NoError(t, err)
+	assert.Empty(t, continueToken)
+	assert.Len(t, pods, 4)
+
+	pods, _, err = q.ListPodWithOptions("", &ListOptions{NodeName: "node-1", OwnerKind: "Deployment", OwnerName: "shop"})
+	assert.NoError(t, err)
+	assert.Len(t, pods, 3)
+
+	_, _, err = q.ListPodWithOptions("", &ListOptions{LabelSelector: "tier in web"})
+	assert.Error(t, err)
+
+	var names []string
+	opts := &ListOptions{Namespace: "default", Limit: 4}
+	for {
+		pods, continueToken, err = q.ListPodWithOptions("", opts)
+		assert.NoError(t, err)
+		for _, pod := range pods {
+			names = append(names, pod.Name)
+		}
+		if len(continueToken) == 0 {
+			break
+		}
+		opts.Continue = continueToken
+	}
+	assert.Equal(t, []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4", "pod-5"}, names)
+}
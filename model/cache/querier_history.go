@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// GetPodByIPAt 查询ts时刻持有podIP的Pod, 包括保留期内已删除的Pod
+// 未设置保留时长时, 等价于GetPodByIP
+func (q *Query) GetPodByIPAt(clusterID string, podIP string, ts time.Time) (*Pod, bool) {
+	entry, find := q.podByIPEntryAt(clusterID, podIP, ts)
+	if !find {
+		return nil, false
+	}
+	return entry.Object.(*Pod), true
+}
+
+// GetPodByContainerIdAt 查询ts时刻运行containerId的Pod, 包括保留期内已删除的Pod
+func (q *Query) GetPodByContainerIdAt(clusterID string, containerId string, ts time.Time) (*Pod, bool) {
+	entry, find := q.podByContainerIdEntryAt(clusterID, containerId, ts)
+	if !find {
+		return nil, false
+	}
+	return entry.Object.(*Pod), true
+}
+
+// GetServiceByIPAt 查询ts时刻持有serviceIP的Service, 包括保留期内已删除的Service
+func (q *Query) GetServiceByIPAt(clusterID string, serviceIP string, ts time.Time) (*Service, bool) {
+	entry, find := q.serviceByIPEntryAt(clusterID, serviceIP, ts)
+	if !find {
+		return nil, false
+	}
+	return entry.Object.(*Service), true
+}
+
+// GetNodeByIPAt 查询ts时刻持有IP的Node, 包括保留期内已删除的Node
+func (q *Query) GetNodeByIPAt(clusterID string, IP string, ts time.Time) (*Node, bool) {
+	entry, find := q.nodeByIPEntryAt(clusterID, IP, ts)
+	if !find {
+		return nil, false
+	}
+	return entry.Object.(*Node), true
+}
+
+func (q *Query) podByIPEntryAt(clusterID string, podIP string, ts time.Time) (*HistoryEntry, bool) {
+	entry, find, enabled := q.lookupHistory(clusterID, resource.PodType, podIP, ts, func(handler resource.ResHandler) *History {
+		if podList, ok := handler.(*PodList); ok {
+			return podList.IPHistory
+		}
+		return nil
+	})
+	if !enabled {
+		pod, find := q.GetPodByIP(clusterID, podIP)
+		return currentEntry(pod, find)
+	}
+	return entry, find
+}
+
+func (q *Query) podByContainerIdEntryAt(clusterID string, containerId string, ts time.Time) (*HistoryEntry, bool) {
+	shortId := containerId
+	if len(shortId) > 12 {
+		shortId = shortId[:12]
+	}
+	entry, find, enabled := q.lookupHistory(clusterID, resource.PodType, shortId, ts, func(handler resource.ResHandler) *History {
+		if podList, ok := handler.(*PodList); ok {
+			return podList.ContainerIDHistory
+		}
+		return nil
+	})
+	if !enabled {
+		pod, find := q.GetPodByContainerId(clusterID, containerId)
+		return currentEntry(pod, find)
+	}
+	return entry, find
+}
+
+func (q *Query) serviceByIPEntryAt(clusterID string, serviceIP string, ts time.Time) (*HistoryEntry, bool) {
+	entry, find, enabled := q.lookupHistory(clusterID, resource.ServiceType, serviceIP, ts, func(handler resource.ResHandler) *History {
+		if serviceList, ok := handler.(*ServiceList); ok {
+			return serviceList.IPHistory
+		}
+		return nil
+	})
+	if !enabled {
+		service, find := q.GetServiceByIP(clusterID, serviceIP)
+		return currentEntry(service, find)
+	}
+	return entry, find
+}
+
+func (q *Query) nodeByIPEntryAt(clusterID string, IP string, ts time.Time) (*HistoryEntry, bool) {
+	entry, find, enabled := q.lookupHistory(clusterID, resource.NodeType, IP, ts, func(handler resource.ResHandler) *History {
+		if nodeList, ok := handler.(*NodeList); ok {
+			return nodeList.IPHistory
+		}
+		return nil
+	})
+	if !enabled {
+		node, find := q.GetNodeByIP(clusterID, IP)
+		return currentEntry(node, find)
+	}
+	return entry, find
+}
+
+// currentEntry 未保留历史时, 使用当前资源构造查询结果, 有效区间未知
+func currentEntry[T interface{ UID() resource.ResUID }](obj T, find bool) (*HistoryEntry, bool) {
+	if !find {
+		return nil, false
+	}
+	return &HistoryEntry{UID: obj.UID(), Object: obj}, true
+}
+
+// lookupHistory enabled为false表示缓存均未保留历史, 此时由调用方退化为查询当前资源
+func (q *Query) lookupHistory(
+	clusterID string,
+	resType resource.ResType,
+	key string,
+	ts time.Time,
+	getHistory func(handler resource.ResHandler) *History,
+) (entry *HistoryEntry, find bool, enabled bool) {
+	var handlers []resource.ResHandler
+	if len(clusterID) == 0 {
+		handlers, _ = q.GetCaches(resType)
+	} else if handler, find := q.GetCache(clusterID, resType); find {
+		handlers = []resource.ResHandler{handler}
+	}
+
+	for _, handler := range handlers {
+		if handler == nil {
+			continue
+		}
+		history := getHistory(handler)
+		if history == nil {
+			continue
+		}
+		enabled = true
+		if len(key) == 0 {
+			continue
+		}
+		if entry, find = history.Lookup(key, ts); find {
+			return entry, true, true
+		}
+	}
+	return nil, false, enabled
+}
+
+// queryResourceAt 只有Pod, Service和Node保留历史, 其他类型返回错误
+func (q *Query) queryResourceAt(req *QueryResRequest, resp *ResInfo) error {
+	ts := time.UnixMilli(req.Timestamp)
+
+	var entry *HistoryEntry
+	switch req.ResType {
+	case resource.PodType:
+		if len(req.ContainerID) > 0 {
+			entry, resp.IsFind = q.podByContainerIdEntryAt(req.ClusterID, req.ContainerID, ts)
+		} else {
+			entry, resp.IsFind = q.podByIPEntryAt(req.ClusterID, req.IP, ts)
+		}
+	case resource.NodeType:
+		entry, resp.IsFind = q.nodeByIPEntryAt(req.ClusterID, req.IP, ts)
+	case resource.ServiceType:
+		entry, resp.IsFind = q.serviceByIPEntryAt(req.ClusterID, req.IP, ts)
+	default:
+		return fmt.Errorf("resource type %s does not support query by timestamp", req.ResType.Kind())
+	}
+
+	if resp.IsFind {
+		resp.Object = entry.Object
+		if entry.FirstSeen > 0 {
+			validity := entry.Validity
+			resp.Validity = &validity
+		}
+	}
+	return nil
+}
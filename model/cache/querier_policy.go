@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"github.com/CloudDetail/metadata/model/policy"
+)
+
+// scopeObject 按照调用方的Policy过滤查询结果并脱敏, 不修改缓存中的资源
+// 单个资源不允许访问时返回false, 列表只保留允许访问的资源
+func scopeObject(p *policy.Policy, obj any) (any, bool) {
+	if p == nil || obj == nil {
+		return obj, true
+	}
+	switch o := obj.(type) {
+	case *Pod:
+		return scopePod(p, o)
+	case []*Pod:
+		return scopeList(p, o, scopePod), true
+	case *Service:
+		return scopeService(p, o)
+	case []*Service:
+		return scopeList(p, o, scopeService), true
+	case *Node:
+		return scopeNode(p, o)
+	case []*Node:
+		return scopeList(p, o, scopeNode), true
+	case *ResolvedEndpoint:
+		return scopeEndpoint(p, o)
+	}
+	return obj, true
+}
+
+func scopePod(p *policy.Policy, pod *Pod) (*Pod, bool) {
+	if pod == nil || pod.Resource == nil {
+		return pod, true
+	}
+	if !p.AllowResource(pod.Resource) {
+		return nil, false
+	}
+	return &Pod{Resource: p.Redact(pod.Resource)}, true
+}
+
+func scopeService(p *policy.Policy, service *Service) (*Service, bool) {
+	if service == nil || service.Resource == nil {
+		return service, true
+	}
+	if !p.AllowResource(service.Resource) {
+		return nil, false
+	}
+	copied := *service
+	copied.Resource = p.Redact(service.Resource)
+	return &copied, true
+}
+
+func scopeNode(p *policy.Policy, node *Node) (*Node, bool) {
+	if node == nil || node.Resource == nil {
+		return node, true
+	}
+	return &Node{Resource: p.Redact(node.Resource)}, true
+}
+
+// scopeEndpoint 匹配到的任一对象不允许访问时返回false
+func scopeEndpoint(p *policy.Policy, endpoint *ResolvedEndpoint) (*ResolvedEndpoint, bool) {
+	if endpoint == nil {
+		return endpoint, true
+	}
+	var ok bool
+	copied := *endpoint
+	if copied.Pod, ok = scopePod(p, endpoint.Pod); !ok {
+		return nil, false
+	}
+	if copied.Service, ok = scopeService(p, endpoint.Service); !ok {
+		return nil, false
+	}
+	copied.Node, _ = scopeNode(p, endpoint.Node)
+	return &copied, true
+}
+
+func scopeList[T any](p *policy.Policy, items []*T, scope func(*policy.Policy, *T) (*T, bool)) []*T {
+	if items == nil {
+		return nil
+	}
+	scoped := make([]*T, 0, len(items))
+	for _, item := range items {
+		if item, ok := scope(p, item); ok {
+			scoped = append(scoped, item)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// RESTPrefix 资源查询接口的路由前缀
+//
+//	GET /api/v1/clusters/{cluster}/pods?ip=&containerId=&labelSelector=&namespace=&nodeName=&phase=&ownerKind=&ownerName=&limit=&continue=
+//	GET /api/v1/clusters/{cluster}/pods/{namespace}/{name}
+//	GET /api/v1/clusters/{cluster}/services?ip=&labelSelector=&namespace=&limit=&continue=
+//	GET /api/v1/clusters/{cluster}/services/{namespace}/{name}
+//	GET /api/v1/clusters/{cluster}/nodes?ip=&labelSelector=&limit=&continue=
+//	GET /api/v1/clusters/{cluster}/nodes/{name}
+//	GET /api/v1/clusters/{cluster}/containers/{containerId}
+//	GET /api/v1/clusters/{cluster}/endpoints?ip=&port=&protocol=
+//
+// {cluster}为 "-" 时查询全部集群; ip和containerId查询支持timestamp参数(unix毫秒)按时间查询
+const RESTPrefix = "/api/v1/clusters/"
+
+// AllClusters 在REST路由中表示查询全部集群
+const AllClusters = "-"
+
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ListResponse struct {
+	Items    any    `json:"items"`
+	Continue string `json:"continue,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		data, _ = json.Marshal(ErrorResponse{Code: statusCode, Message: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, format string, args ...any) {
+	writeJSON(w, statusCode, ErrorResponse{Code: statusCode, Message: fmt.Sprintf(format, args...)})
+}
+
+func (q *Query) QueryREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method %s is not allowed", r.Method)
+		return
+	}
+
+	// {cluster}/{resource}[/...]
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, RESTPrefix), "/"), "/")
+	if len(parts) < 2 || len(parts[0]) == 0 {
+		writeError(w, http.StatusNotFound, "unknown path %s", r.URL.Path)
+		return
+	}
+	clusterID := parts[0]
+	if clusterID == AllClusters {
+		clusterID = ""
+	}
+	p := policy.FromContext(r.Context())
+	clusterID, allowed := p.ScopeCluster(clusterID)
+	if !allowed {
+		writeError(w, http.StatusForbidden, "cluster %q is not allowed", parts[0])
+		return
+	}
+	args := parts[2:]
+	params := r.URL.Query()
+
+	var ts time.Time
+	if timestamp := params.Get("timestamp"); len(timestamp) > 0 {
+		millis, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid timestamp %q: %v", timestamp, err)
+			return
+		}
+		ts = time.UnixMilli(millis)
+	}
+
+	switch parts[1] {
+	case "pods":
+		q.restPods(w, p, clusterID, args, params, ts)
+	case "services":
+		q.restServices(w, p, clusterID, args, params, ts)
+	case "nodes":
+		q.restNodes(w, p, clusterID, args, params, ts)
+	case "containers":
+		if len(args) != 1 {
+			writeError(w, http.StatusNotFound, "unknown path %s", r.URL.Path)
+			return
+		}
+		entry, find := q.podByContainerIdEntryAt(clusterID, args[0], timeOrNow(ts))
+		writeEntry(w, p, entry, find, "pod with container %s not found", args[0])
+	case "endpoints":
+		q.restEndpoints(w, p, clusterID, params)
+	default:
+		writeError(w, http.StatusNotFound, "unknown resource %s", parts[1])
+	}
+}
+
+func timeOrNow(ts time.Time) time.Time {
+	if ts.IsZero() {
+		return time.Now()
+	}
+	return ts
+}
+
+func restListOptions(params map[string][]string) (*ListOptions, error) {
+	get := func(key string) string {
+		if values := params[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	opts := &ListOptions{
+		Namespace:     get("namespace"),
+		LabelSelector: get("labelSelector"),
+		NodeName:      get("nodeName"),
+		Phase:         get("phase"),
+		OwnerKind:     get("ownerKind"),
+		OwnerName:     get("ownerName"),
+		Continue:      get("continue"),
+	}
+	if limit := get("limit"); len(limit) > 0 {
+		var err error
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil || opts.Limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	return opts, nil
+}
+
+// writeEntry 返回按时间查询的结果, 有效区间通过响应头返回
+func writeEntry(w http.ResponseWriter, p *policy.Policy, entry *HistoryEntry, find bool, format string, args ...any) {
+	var obj any
+	if find {
+		obj, find = scopeObject(p, entry.Object)
+	}
+	if !find {
+		writeError(w, http.StatusNotFound, format, args...)
+		return
+	}
+	if entry.FirstSeen > 0 {
+		w.Header().Set("X-Valid-From", strconv.FormatInt(entry.FirstSeen, 10))
+		if entry.DeletedAt > 0 {
+			w.Header().Set("X-Valid-Until", strconv.FormatInt(entry.DeletedAt, 10))
+		}
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func writeObject[T any](w http.ResponseWriter, p *policy.Policy, obj T, find bool, format string, args ...any) {
+	var scoped any
+	if find {
+		scoped, find = scopeObject(p, obj)
+	}
+	if !find {
+		writeError(w, http.StatusNotFound, format, args...)
+		return
+	}
+	writeJSON(w, http.StatusOK, scoped)
+}
+
+func (q *Query) restPods(w http.ResponseWriter, p *policy.Policy, clusterID string, args []string, params map[string][]string, ts time.Time) {
+	switch len(args) {
+	case 0:
+		if ip := firstParam(params, "ip"); len(ip) > 0 {
+			entry, find := q.podByIPEntryAt(clusterID, ip, timeOrNow(ts))
+			writeEntry(w, p, entry, find, "pod with ip %s not found", ip)
+			return
+		}
+		if containerID := firstParam(params, "containerId"); len(containerID) > 0 {
+			entry, find := q.podByContainerIdEntryAt(clusterID, containerID, timeOrNow(ts))
+			writeEntry(w, p, entry, find, "pod with container %s not found", containerID)
+			return
+		}
+		opts, err := restListOptions(params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pods, continueToken, err := q.ListPodWithOptions(clusterID, opts)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, ListResponse{Items: nonNil(scopeList(p, pods, scopePod)), Continue: continueToken})
+	case 2:
+		pod, find := q.GetPodByNSAndName(clusterID, args[0], args[1])
+		writeObject(w, p, pod, find, "pod %s/%s not found", args[0], args[1])
+	default:
+		writeError(w, http.StatusNotFound, "unknown pod path %s", strings.Join(args, "/"))
+	}
+}
+
+func (q *Query) restServices(w http.ResponseWriter, p *policy.Policy, clusterID string, args []string, params map[string][]string, ts time.Time) {
+	switch len(args) {
+	case 0:
+		if ip := firstParam(params, "ip"); len(ip) > 0 {
+			entry, find := q.serviceByIPEntryAt(clusterID, ip, timeOrNow(ts))
+			writeEntry(w, p, entry, find, "service with ip %s not found", ip)
+			return
+		}
+		opts, err := restListOptions(params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		services, continueToken, err := q.ListServiceWithOptions(clusterID, opts)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, ListResponse{Items: nonNil(scopeList(p, services, scopeService)), Continue: continueToken})
+	case 2:
+		service, find := q.GetServiceByNSAndName(clusterID, args[0], args[1])
+		writeObject(w, p, service, find, "service %s/%s not found", args[0], args[1])
+	default:
+		writeError(w, http.StatusNotFound, "unknown service path %s", strings.Join(args, "/"))
+	}
+}
+
+func (q *Query) restNodes(w http.ResponseWriter, p *policy.Policy, clusterID string, args []string, params map[string][]string, ts time.Time) {
+	switch len(args) {
+	case 0:
+		if ip := firstParam(params, "ip"); len(ip) > 0 {
+			entry, find := q.nodeByIPEntryAt(clusterID, ip, timeOrNow(ts))
+			writeEntry(w, p, entry, find, "node with ip %s not found", ip)
+			return
+		}
+		opts, err := restListOptions(params)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		nodes, continueToken, err := q.ListNodeWithOptions(clusterID, opts)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, ListResponse{Items: nonNil(scopeList(p, nodes, scopeNode)), Continue: continueToken})
+	case 1:
+		nodes, _, _ := q.ListNodeWithOptions(clusterID, &ListOptions{NodeName: args[0]})
+		writeObject(w, p, firstOrNil(nodes), len(nodes) > 0, "node %s not found", args[0])
+	default:
+		writeError(w, http.StatusNotFound, "unknown node path %s", strings.Join(args, "/"))
+	}
+}
+
+func (q *Query) restEndpoints(w http.ResponseWriter, p *policy.Policy, clusterID string, params map[string][]string) {
+	ip := firstParam(params, "ip")
+	if len(ip) == 0 {
+		writeError(w, http.StatusBadRequest, "ip is required")
+		return
+	}
+	var port int
+	if portStr := firstParam(params, "port"); len(portStr) > 0 {
+		var err error
+		port, err = strconv.Atoi(portStr)
+		if err != nil || port < 0 || port > 65535 {
+			writeError(w, http.StatusBadRequest, "invalid port %q", portStr)
+			return
+		}
+	}
+	endpoint, find := q.ResolveEndpoint(clusterID, ip, port, firstParam(params, "protocol"))
+	writeObject(w, p, endpoint, find, "endpoint %s:%d not found", ip, port)
+}
+
+func firstParam(params map[string][]string, key string) string {
+	if values := params[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func firstOrNil[T any](items []*T) *T {
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// nonNil 空列表返回[]而不是null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func (q *Query) GetServiceByNSAndName(clusterID string, namespace string, name string) (*Service, bool) {
+	if len(namespace) == 0 || len(name) == 0 {
+		return nil, false
+	}
+	for _, handler := range q.listHandlers(clusterID, resource.ServiceType) {
+		if serviceList, ok := handler.(*ServiceList); ok {
+			if serviceRef, find := serviceList.Index().ServiceMap.Load(namespace + "/" + name); find {
+				return serviceRef.(*Service), true
+			}
+		}
+	}
+	return nil, false
+}
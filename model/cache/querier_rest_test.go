@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/codec"
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryREST(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := NewPodList(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	pod := testWorkload(resource.PodType, "uid-1", "pod-1", nil)
+	pod.StringAttr[resource.PodIP] = "10.0.0.1"
+	pod.StringAttr[resource.ContainerIDsAttr] = "abcdef123456"
+	podList.AddResource(pod)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "pod by ip", path: "/api/v1/clusters/-/pods?ip=10.0.0.1", wantCode: http.StatusOK, wantBody: `"name":"pod-1"`},
+		{name: "pod by name", path: "/api/v1/clusters/-/pods/default/pod-1", wantCode: http.StatusOK, wantBody: `"name":"pod-1"`},
+		{name: "pod by container", path: "/api/v1/clusters/-/containers/abcdef123456", wantCode: http.StatusOK, wantBody: `"name":"pod-1"`},
+		{name: "list pods", path: "/api/v1/clusters/-/pods?namespace=default", wantCode: http.StatusOK, wantBody: `"items":[{`},
+		{name: "pod not found", path: "/api/v1/clusters/-/pods?ip=10.0.0.2", wantCode: http.StatusNotFound, wantBody: `"code":404`},
+		{name: "bad selector", path: "/api/v1/clusters/-/pods?labelSelector=a+in+b", wantCode: http.StatusBadRequest, wantBody: `"code":400`},
+		{name: "bad timestamp", path: "/api/v1/clusters/-/pods?ip=10.0.0.1&timestamp=now", wantCode: http.StatusBadRequest},
+		{name: "unknown resource", path: "/api/v1/clusters/-/secrets", wantCode: http.StatusNotFound},
+		{name: "node not found", path: "/api/v1/clusters/-/nodes/node-1", wantCode: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPost, path: "/api/v1/clusters/-/pods", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if len(method) == 0 {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			q.QueryREST(w, httptest.NewRequest(method, tt.path, nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestQueryResourceBadBody(t *testing.T) {
+	q := &Query{CacheMap: NewSingleClusterCacheList()}
+	w := httptest.NewRecorder()
+	q.QueryResource(w, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":400`)
+}
+
+func TestQueryResourceCodec(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := NewPodList(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	pod := testWorkload(resource.PodType, "uid-1", "pod-1", nil)
+	pod.StringAttr[resource.PodIP] = "10.0.0.1"
+	podList.AddResource(pod)
+
+	reqCodec := codec.Codec{Encoding: codec.Gob, Compression: codec.Zstd}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		body, err := reqCodec.Marshal(QueryResRequest{ResType: resource.PodType, IP: ip})
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, "/query", bytes.NewReader(body))
+		reqCodec.SetContentHeaders(r.Header)
+		reqCodec.SetAcceptHeaders(r.Header)
+
+		w := httptest.NewRecorder()
+		q.QueryResource(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		respCodec, err := codec.FromContentHeaders(w.Header())
+		require.NoError(t, err)
+		assert.Equal(t, reqCodec, respCodec)
+		var resp ResInfo
+		require.NoError(t, respCodec.Unmarshal(w.Body.Bytes(), &resp))
+		if ip == "10.0.0.1" {
+			assert.True(t, resp.IsFind)
+			assert.Equal(t, "pod-1", resp.Object.(*Pod).Name)
+		} else {
+			assert.False(t, resp.IsFind)
+		}
+	}
+}
+
+func TestQueryRESTPolicy(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	podList := NewPodList(resource.PodType, nil)
+	podList.SetExporter(nonExporter{})
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	q := &Query{CacheMap: cacheMap}
+
+	for _, name := range []string{"team-a", "team-b"} {
+		pod := testWorkload(resource.PodType, "uid-"+name, "pod-"+name, nil)
+		pod.StringAttr[resource.NamespaceAttr] = name
+		pod.StringAttr[resource.PodIP] = "10.0.0." + name[len(name)-1:]
+		pod.ExtraAttr[resource.PodLabelsAttr] = map[string]string{"app": "web", "customer": "acme"}
+		podList.AddResource(pod)
+	}
+
+	p := policy.New().WithClusters("cluster-a").WithNamespaces("team-a").WithStripKeys("customer")
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		q.QueryREST(w, req.WithContext(policy.WithPolicy(req.Context(), p)))
+		return w
+	}
+
+	w := get("/api/v1/clusters/-/pods")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"pod-team-a"`)
+	assert.NotContains(t, w.Body.String(), "pod-team-b")
+	assert.NotContains(t, w.Body.String(), "customer")
+
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/clusters/-/pods/team-b/pod-team-b").Code)
+	assert.Equal(t, http.StatusForbidden, get("/api/v1/clusters/cluster-b/pods").Code)
+
+	// 缓存中的资源不被修改
+	pod, find := q.GetPodByNSAndName("", "team-a", "pod-team-a")
+	require.True(t, find)
+	assert.Equal(t, "acme", pod.Labels()["customer"])
+}
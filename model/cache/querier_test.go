@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+type nonExporter struct{}
+
+func (nonExporter) SetupResourcesRef(*resource.Resources)        {}
+func (nonExporter) ExportResourceEvents(*resource.ResourceEvent) {}
+
+func testWorkload(resType resource.ResType, uid string, name string, owner *resource.Relation) *resource.Resource {
+	res := &resource.Resource{
+		ResUID:     resource.ResUID(uid),
+		ResType:    resType,
+		Name:       name,
+		Relations:  []resource.Relation{},
+		StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: "default"},
+		Int64Attr:  map[resource.AttrKey]int64{},
+		ExtraAttr:  map[resource.AttrKey]map[string]string{},
+	}
+	if owner != nil {
+		res.Relations = append(res.Relations, *owner)
+	}
+	return res
+}
+
+func ownerRelation(uid string, kind string, name string) *resource.Relation {
+	return &resource.Relation{
+		ResUID: resource.ResUID(uid),
+		ReType: resource.R_OWNER,
+		StringAttr: map[resource.AttrKey]string{
+			resource.OwnerType: kind,
+			resource.OwnerName: name,
+		},
+	}
+}
+
+func TestGetPodOwnerReferences(t *testing.T) {
+	cacheMap := NewSingleClusterCacheList()
+	for _, resType := range resource.WorkloadTypes {
+		cacheMap.AddResHandler("", resType, NewWorkloadList(resType, nil))
+	}
+	rsList, _ := cacheMap.GetCache("", resource.ReplicaSetType)
+	deployList, _ := cacheMap.GetCache("", resource.DeploymentType)
+	jobList, _ := cacheMap.GetCache("", resource.JobType)
+	cronJobList, _ := cacheMap.GetCache("", resource.CronJobType)
+	for _, handler := range []resource.ResHandler{rsList, deployList, jobList, cronJobList} {
+		handler.SetExporter(nonExporter{})
+	}
+
+	deployList.AddResource(testWorkload(resource.DeploymentType, "deploy-uid", "my-app-v2", nil))
+	rsList.AddResource(testWorkload(resource.ReplicaSetType, "rs-uid", "my-app-v2-5d8f7c",
+		ownerRelation("deploy-uid", "Deployment", "my-app-v2")))
+	cronJobList.AddResource(testWorkload(resource.CronJobType, "cron-uid", "backup", nil))
+	jobList.AddResource(testWorkload(resource.JobType, "job-uid", "backup-27893160",
+		ownerRelation("cron-uid", "CronJob", "backup")))
+
+	q := &Query{CacheMap: cacheMap}
+	// Pod.GetOwnerReferences通过全局的Querier解析
+	defer func(cacheMap CacheMap) { Querier.CacheMap = cacheMap }(Querier.CacheMap)
+	Querier.CacheMap = cacheMap
+
+	tests := []struct {
+		name  string
+		owner *resource.Relation
+		want  OwnerReferences
+	}{
+		{
+			name:  "pod -> replicaset -> deployment",
+			owner: ownerRelation("rs-uid", "ReplicaSet", "my-app-v2-5d8f7c"),
+			want:  OwnerReferences{UID: "deploy-uid", Kind: "Deployment", Name: "my-app-v2"},
+		},
+		{
+			name:  "pod -> job -> cronjob",
+			owner: ownerRelation("job-uid", "Job", "backup-27893160"),
+			want:  OwnerReferences{UID: "cron-uid", Kind: "CronJob", Name: "backup"},
+		},
+		{
+			name:  "unknown replicaset falls back to guess",
+			owner: ownerRelation("unknown-rs", "ReplicaSet", "other-app-7c9d"),
+			want:  OwnerReferences{UID: "unknown-rs", Kind: "Deployment", Name: "other-app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &Pod{Resource: testWorkload(resource.PodType, "pod-uid", "pod", tt.owner)}
+			got := q.GetPodOwnerReferences("", pod, true)
+			assert.Equal(t, []OwnerReferences{tt.want}, got)
+			assert.Equal(t, []OwnerReferences{tt.want}, pod.GetOwnerReferences(true))
+		})
+	}
+
+	// 未配置查询缓存时只能推测Deployment
+	Querier.CacheMap = nil
+	pod := &Pod{Resource: testWorkload(resource.PodType, "pod-uid", "pod",
+		ownerRelation("rs-uid", "ReplicaSet", "my-app-v2-5d8f7c"))}
+	assert.Equal(t, []OwnerReferences{{UID: "rs-uid", Kind: "Deployment", Name: "my-app-v2"}}, pod.GetOwnerReferences(true))
+	assert.Equal(t, []OwnerReferences{{UID: "rs-uid", Kind: "ReplicaSet", Name: "my-app-v2-5d8f7c"}}, pod.GetOwnerReferences(false))
+}
+
+func TestClusterCacheMapAddResHandler(t *testing.T) {
+	cacheMap := NewClusterCacheList()
+	podListA := NewPodList(resource.PodType, nil)
+	podListB := NewPodList(resource.PodType, nil)
+	cacheMap.AddResHandler("cluster-a", resource.PodType, podListA)
+	cacheMap.AddResHandler("cluster-a", resource.NodeType, NewNodeList(resource.NodeType, nil))
+	cacheMap.AddResHandler("cluster-b", resource.PodType, podListB)
+
+	handler, find := cacheMap.GetCache("cluster-a", resource.PodType)
+	assert.True(t, find)
+	assert.Same(t, podListA, handler)
+	_, find = cacheMap.GetCache("cluster-a", resource.NodeType)
+	assert.True(t, find)
+	handlers, _ := cacheMap.GetCaches(resource.PodType)
+	assert.Len(t, handlers, 2)
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+const defaultProtocol = "TCP"
+
+// allProtocols 未指定协议时依次尝试
+var allProtocols = []string{"TCP", "UDP", "SCTP"}
+
+// EndpointMatchType ResolveEndpoint的匹配方式
+type EndpointMatchType string
+
+const (
+	MatchPodIP      EndpointMatchType = "pod_ip"
+	MatchHostPort   EndpointMatchType = "host_port"
+	MatchNodePort   EndpointMatchType = "node_port"
+	MatchClusterIP  EndpointMatchType = "cluster_ip"
+	MatchExternalIP EndpointMatchType = "external_ip"
+	MatchNodeIP     EndpointMatchType = "node_ip"
+)
+
+// ResolvedEndpoint IP和端口解析到的对象
+type ResolvedEndpoint struct {
+	MatchType EndpointMatchType `json:"matchType"`
+	Pod       *Pod              `json:"pod,omitempty"`
+	Service   *Service          `json:"service,omitempty"`
+	// 匹配host_port时为Pod所在的Node
+	Node *Node `json:"node,omitempty"`
+	// 访问Service时转发到的目标端口, 未知或为命名端口时为0
+	TargetPort int `json:"targetPort,omitempty"`
+}
+
+func hostPortKey(ip string, port string, protocol string) string {
+	return net.JoinHostPort(ip, port) + "/" + protocol
+}
+
+// resolveProtocols protocol为空时匹配全部协议
+func resolveProtocols(protocol string) []string {
+	if len(protocol) == 0 {
+		return allProtocols
+	}
+	return []string{strings.ToUpper(protocol)}
+}
+
+func matchProtocol(protocols []string, expected []string) bool {
+	for _, protocol := range protocols {
+		for _, e := range expected {
+			if protocol == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResolveEndpoint 解析ip:port访问的对象, 依次匹配:
+// 非hostNetwork的PodIP, 占用节点端口的Pod, NodePort, Service ClusterIP, ExternalIP/LoadBalancer IP, Node
+// port为0时跳过需要端口的匹配; protocol为空时匹配全部协议
+func (q *Query) ResolveEndpoint(clusterID string, ip string, port int, protocol string) (*ResolvedEndpoint, bool) {
+	if len(ip) == 0 {
+		return nil, false
+	}
+	protocols := resolveProtocols(protocol)
+	portStr := strconv.Itoa(port)
+
+	podLists := q.handlersOf(clusterID, resource.PodType)
+	serviceLists := q.handlersOf(clusterID, resource.ServiceType)
+	nodeLists := q.handlersOf(clusterID, resource.NodeType)
+
+	for _, handler := range podLists {
+		podList, ok := handler.(*PodList)
+		if !ok {
+			continue
+		}
+		if podRef, find := podList.Index().IP2PodMap.Load(ip); find {
+			if pod := podRef.(*Pod); !pod.IsHostNetWork() {
+				return &ResolvedEndpoint{MatchType: MatchPodIP, Pod: pod}, true
+			}
+		}
+	}
+
+	if port > 0 {
+		for _, handler := range podLists {
+			podList, ok := handler.(*PodList)
+			if !ok {
+				continue
+			}
+			for _, p := range protocols {
+				podRef, find := podList.Index().HostPort2Pod.Load(hostPortKey(ip, portStr, p))
+				if !find {
+					continue
+				}
+				endpoint := &ResolvedEndpoint{MatchType: MatchHostPort, Pod: podRef.(*Pod), TargetPort: port}
+				endpoint.Node, _ = q.GetNodeByIP(podList.ClusterID, ip)
+				return endpoint, true
+			}
+		}
+
+		for _, handler := range nodeLists {
+			nodeList, ok := handler.(*NodeList)
+			if !ok || nodeList.GetNodeByIP(ip) == nil {
+				continue
+			}
+			serviceHandler, find := q.GetCache(nodeList.ClusterID, resource.ServiceType)
+			if !find {
+				continue
+			}
+			serviceList, ok := serviceHandler.(*ServiceList)
+			if !ok {
+				continue
+			}
+			for _, p := range protocols {
+				serviceRef, find := serviceList.Index().NodePort2Service.Load(portStr + "/" + p)
+				if !find {
+					continue
+				}
+				service := serviceRef.(*Service)
+				endpoint := &ResolvedEndpoint{MatchType: MatchNodePort, Service: service}
+				if svcPort, find := service.ExtraAttr[resource.ServiceNodePorts][portStr]; find {
+					endpoint.TargetPort, _ = service.targetPort(svcPort, protocols)
+				}
+				return endpoint, true
+			}
+		}
+	}
+
+	for _, handler := range serviceLists {
+		serviceList, ok := handler.(*ServiceList)
+		if !ok {
+			continue
+		}
+		serviceRef, find := serviceList.Index().IP2ServiceMap.Load(ip)
+		if !find {
+			continue
+		}
+		service := serviceRef.(*Service)
+		if service.isClusterIP(ip) {
+			endpoint := &ResolvedEndpoint{MatchType: MatchClusterIP, Service: service}
+			if port > 0 {
+				endpoint.TargetPort, _ = service.targetPort(portStr, protocols)
+			}
+			return endpoint, true
+		}
+		if service.isExternalIP(ip) {
+			if port == 0 {
+				return &ResolvedEndpoint{MatchType: MatchExternalIP, Service: service}, true
+			}
+			if targetPort, find := service.targetPort(portStr, protocols); find {
+				return &ResolvedEndpoint{MatchType: MatchExternalIP, Service: service, TargetPort: targetPort}, true
+			}
+		}
+	}
+
+	for _, handler := range nodeLists {
+		nodeList, ok := handler.(*NodeList)
+		if !ok {
+			continue
+		}
+		if node := nodeList.GetNodeByIP(ip); node != nil {
+			return &ResolvedEndpoint{MatchType: MatchNodeIP, Node: node}, true
+		}
+	}
+	return nil, false
+}
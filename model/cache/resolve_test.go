@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func testResolveQuery() (*Query, *PodList) {
+	podList := NewPodList(resource.PodType, nil).(*PodList)
+	podList.SetExporter(nonExporter{})
+	serviceList := NewServiceList(resource.ServiceType, nil).(*ServiceList)
+	serviceList.SetExporter(nonExporter{})
+	nodeList := NewNodeList(resource.NodeType, nil).(*NodeList)
+	nodeList.SetExporter(nonExporter{})
+
+	web := testWorkload(resource.PodType, "pod-1", "web-0", nil)
+	web.StringAttr[resource.PodIP] = "10.0.0.1"
+	web.StringAttr[resource.PodHostIP] = "192.168.0.1"
+	web.StringAttr[resource.PodHostPorts] = "8443/TCP"
+	podList.AddResource(web)
+
+	agent := testWorkload(resource.PodType, "pod-2", "agent-0", nil)
+	agent.StringAttr[resource.PodIP] = "192.168.0.1"
+	agent.StringAttr[resource.PodHostIP] = "192.168.0.1"
+	agent.StringAttr[resource.PodHostPorts] = "9100/TCP,8125/UDP"
+	agent.Int64Attr[resource.PodHostNetwork] = 1
+	podList.AddResource(agent)
+
+	service := testWorkload(resource.ServiceType, "svc-1", "web", nil)
+	service.StringAttr[resource.ServiceIP] = "10.96.0.10"
+	service.StringAttr[resource.ServiceExternalIPs] = "35.1.2.3"
+	service.ExtraAttr[resource.ServicePorts2TargetPorts] = map[string]string{"80": "8080", "53": "5353"}
+	service.ExtraAttr[resource.ServiceNodePorts] = map[string]string{"30080": "80"}
+	service.ExtraAttr[resource.ServicePortProtocols] = map[string]string{"80": "TCP", "53": "UDP"}
+	serviceList.AddResource(service)
+
+	node := testWorkload(resource.NodeType, "node-1", "node-1", nil)
+	node.StringAttr[resource.NodeInternalIP] = "192.168.0.1"
+	nodeList.AddResource(node)
+
+	cacheMap := NewSingleClusterCacheList()
+	cacheMap.AddResHandler("", resource.PodType, podList)
+	cacheMap.AddResHandler("", resource.ServiceType, serviceList)
+	cacheMap.AddResHandler("", resource.NodeType, nodeList)
+	return &Query{CacheMap: cacheMap}, podList
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	q, podList := testResolveQuery()
+
+	tests := []struct {
+		name       string
+		ip         string
+		port       int
+		protocol   string
+		matchType  EndpointMatchType
+		target     string
+		targetPort int
+	}{
+		{"pod ip", "10.0.0.1", 8080, "", MatchPodIP, "web-0", 0},
+		{"host port", "192.168.0.1", 8443, "tcp", MatchHostPort, "web-0", 8443},
+		{"host network", "192.168.0.1", 8125, "UDP", MatchHostPort, "agent-0", 8125},
+		{"node port", "192.168.0.1", 30080, "TCP", MatchNodePort, "web", 8080},
+		{"cluster ip", "10.96.0.10", 80, "", MatchClusterIP, "web", 8080},
+		{"cluster ip without port", "10.96.0.10", 0, "", MatchClusterIP, "web", 0},
+		{"external ip", "35.1.2.3", 53, "UDP", MatchExternalIP, "web", 5353},
+		{"node ip", "192.168.0.1", 22, "TCP", MatchNodeIP, "node-1", 0},
+		// 协议不匹配时不使用占用的节点端口
+		{"host port protocol mismatch", "192.168.0.1", 8125, "TCP", MatchNodeIP, "node-1", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, find := q.ResolveEndpoint("", tt.ip, tt.port, tt.protocol)
+			if !assert.True(t, find) {
+				return
+			}
+			assert.Equal(t, tt.matchType, endpoint.MatchType)
+			assert.Equal(t, tt.targetPort, endpoint.TargetPort)
+			switch {
+			case endpoint.Pod != nil:
+				assert.Equal(t, tt.target, endpoint.Pod.Name)
+			case endpoint.Service != nil:
+				assert.Equal(t, tt.target, endpoint.Service.Name)
+			default:
+				assert.Equal(t, tt.target, endpoint.Node.Name)
+			}
+		})
+	}
+
+	endpoint, _ := q.ResolveEndpoint("", "192.168.0.1", 8443, "")
+	assert.Equal(t, "node-1", endpoint.Node.Name)
+
+	// ExternalIP未声明的端口
+	_, find := q.ResolveEndpoint("", "35.1.2.3", 443, "TCP")
+	assert.False(t, find)
+	_, find = q.ResolveEndpoint("", "10.1.1.1", 80, "")
+	assert.False(t, find)
+
+	podList.DeleteResource(podList.ResList[0])
+	endpoint, _ = q.ResolveEndpoint("", "192.168.0.1", 8443, "TCP")
+	assert.Equal(t, MatchNodeIP, endpoint.MatchType)
+}
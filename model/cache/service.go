@@ -4,6 +4,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CloudDetail/metadata/model/resource"
 )
@@ -14,75 +16,129 @@ var _ resource.ResHandler = &ServiceList{}
 // 如果同时处理Pod资源,会维护Service和Pod的关系
 type ServiceList struct {
 	*resource.Resources
+	index atomic.Pointer[ServiceIndex]
+	// 保留已删除Service的历史, 用于按时间查询; 未设置保留时长时为nil
+	IPHistory *History
+
+	IsPodWatch bool
+	// Namespace -> podMap,serviceMap
+	// only enable when IsPodWatch is true
+	nsScopePodServiceMap sync.Map
+
+	// 根据EndpointSlice维护Endpoints, 与IsPodWatch互斥
+	IsEndpointSliceWatch bool
+	// Namespace/ServiceName -> *ServiceSlices
+	// only enable when IsEndpointSliceWatch is true
+	serviceSlicesMap sync.Map
+	// 保护serviceSlicesMap, 同时串行化Service的变更和根据EndpointSlice刷新Endpoints,
+	// 避免刷新时基于旧的Service覆盖新的Service
+	sliceMux sync.Mutex
+}
+
+// ServiceIndex ServiceList的查询表, Reset时重建后整体替换
+type ServiceIndex struct {
 	// Service UID -> *Service
 	UIDMap sync.Map
 	// Namespace/Name -> *Service
 	ServiceMap sync.Map
 	// IP -> *Service
 	IP2ServiceMap sync.Map
+	// NodePort/Protocol -> *Service
+	NodePort2Service sync.Map
+}
 
-	IsPodWatch bool
-	// Namespace -> podMap,serviceMap
-	// only enable when IsPodWatch is true
-	nsScopePodServiceMap sync.Map
+func (idx *ServiceIndex) store(service *Service) {
+	idx.UIDMap.Store(service.ResUID, service)
+	idx.ServiceMap.Store(service.NS()+"/"+service.Name, service)
+	for _, ip := range service.IPs() {
+		idx.IP2ServiceMap.Store(ip, service)
+	}
+	for _, key := range service.nodePortKeys() {
+		idx.NodePort2Service.Store(key, service)
+	}
 }
 
 func NewServiceList(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+	return newServiceList(resList, 0)
+}
+
+// ServiceListWithRetention 返回的模版创建的ServiceList保留retention内已删除Service的历史, 用于按时间查询
+func ServiceListWithRetention(retention time.Duration) resource.HandlerTemplate {
+	return func(_ resource.ResType, resList []*resource.Resource) resource.ResHandler {
+		return newServiceList(resList, retention)
+	}
+}
+
+func newServiceList(resList []*resource.Resource, retention time.Duration) *ServiceList {
 	sl := &ServiceList{
 		Resources: &resource.Resources{
 			ResList: resList,
 			ResType: resource.ServiceType,
 		},
 		IsPodWatch: false,
+		IPHistory:  NewHistory(retention),
 	}
+	sl.index.Store(sl.buildIndex(resList))
 
 	if resList == nil {
 		sl.Resources.ResList = []*resource.Resource{}
-		return sl
 	}
+	return sl
+}
 
+// buildIndex 根据resList重建查询表并记录历史
+func (sl *ServiceList) buildIndex(resList []*resource.Resource) *ServiceIndex {
+	idx := &ServiceIndex{}
+	now := time.Now()
 	for _, res := range resList {
 		service := &Service{Resource: res}
-		// 更新Service索引
-		sl.updateServiceSearch(service)
+		idx.store(service)
+		sl.recordHistory(service, now)
 	}
-	return sl
+	return idx
+}
+
+// Index 当前的查询表
+func (sl *ServiceList) Index() *ServiceIndex {
+	return sl.index.Load()
 }
 
+// EnablePodMatch 根据Service的Selector和Pod的Label匹配Endpoints
 func (sl *ServiceList) EnablePodMatch() {
 	sl.IsPodWatch = true
+	sl.IsEndpointSliceWatch = false
 }
 
-func (sl *ServiceList) Reset(resList []*resource.Resource) {
-	sl.ServiceMap = sync.Map{}
-	sl.IP2ServiceMap = sync.Map{}
-
-	newServiceMap := sync.Map{}
-	newIP2ServiceMap := sync.Map{}
-	newUIDMap := sync.Map{}
+// EnableEndpointSliceMatch 根据EndpointSlice维护Endpoints
+// 支持无Selector的Service和手动维护的Endpoints, 并记录每个Endpoint的就绪状态
+func (sl *ServiceList) EnableEndpointSliceMatch() {
+	sl.IsEndpointSliceWatch = true
+	sl.IsPodWatch = false
+}
 
+func (sl *ServiceList) Reset(resList []*resource.Resource) {
+	alive := make(map[resource.ResUID]struct{}, len(resList))
 	for _, res := range resList {
-		service := &Service{Resource: res}
-		// 更新Service索引
-		newServiceMap.Store(service.NS()+"/"+service.Name, service)
-		newIP2ServiceMap.Store(service.IP(), service)
-		newUIDMap.Store(service.UID(), service)
-		// 接受Reset事件必然不是meta-agent, 不做 Pod/Service关系的处理
-	}
-
-	// !!! 这里的赋值包含了锁拷贝,
-	// newxxxMap必须只在当前线程内使用 才是线程安全的
-	sl.ServiceMap = newServiceMap
-	sl.IP2ServiceMap = newIP2ServiceMap
-	sl.UIDMap = newUIDMap
+		alive[res.ResUID] = struct{}{}
+	}
+	sl.IPHistory.DeleteMissing(alive, time.Now())
+
+	// 接受Reset事件必然不是meta-agent, 不做 Pod/Service关系的处理
+	// 重建后整体替换, 期间的查询仍使用旧的查询表
+	sl.index.Store(sl.buildIndex(resList))
 	sl.Resources.Reset(resList)
 }
 
 // updateServiceSearch 更新Service资源常规的索引表
 func (sl *ServiceList) updateServiceSearch(service *Service) {
-	sl.UIDMap.Store(service.ResUID, service)
-	sl.ServiceMap.Store(service.NS()+"/"+service.Name, service)
-	sl.IP2ServiceMap.Store(service.IP(), service)
+	sl.Index().store(service)
+	sl.recordHistory(service, time.Now())
+}
+
+func (sl *ServiceList) recordHistory(service *Service, now time.Time) {
+	for _, ip := range service.IPs() {
+		sl.IPHistory.Record(ip, service.ResUID, service, now)
+	}
 }
 
 func (sl *ServiceList) AddResource(res *resource.Resource) {
@@ -92,17 +148,27 @@ func (sl *ServiceList) AddResource(res *resource.Resource) {
 			return
 		}
 		sl.addPod(res)
-	case resource.ServiceType:
-		service := &Service{
-			Resource: res,
+	case resource.EndpointSliceType:
+		if !sl.IsEndpointSliceWatch {
+			return
 		}
+		sl.updateSlice(res)
+	case resource.ServiceType:
+		sl.sliceMux.Lock()
+		defer sl.sliceMux.Unlock()
+		sl.addService(&Service{Resource: res})
+	}
+}
 
-		sl.updateServiceSearch(service)
-		if sl.IsPodWatch {
-			sl.checkRelation(service)
-		}
-		sl.Resources.AddResource(res)
+// addService 调用方需持有sliceMux
+func (sl *ServiceList) addService(service *Service) {
+	sl.updateServiceSearch(service)
+	if sl.IsPodWatch {
+		sl.checkRelation(service)
+	} else if sl.IsEndpointSliceWatch {
+		sl.applySlices(service)
 	}
+	sl.Resources.AddResource(service.Resource)
 }
 
 func (sl *ServiceList) addPod(res *resource.Resource) {
@@ -142,26 +208,43 @@ func (sl *ServiceList) UpdateResource(res *resource.Resource) {
 			return
 		}
 		sl.updatePod(res)
+	case resource.EndpointSliceType:
+		if !sl.IsEndpointSliceWatch {
+			return
+		}
+		sl.updateSlice(res)
 	case resource.ServiceType:
 		service := &Service{
 			Resource: res,
 		}
 
-		oldServiceRef, find := sl.UIDMap.Load(service.ResUID)
+		sl.sliceMux.Lock()
+		defer sl.sliceMux.Unlock()
+		idx := sl.Index()
+		oldServiceRef, find := idx.UIDMap.Load(service.ResUID)
 		if !find {
-			sl.AddResource(res)
+			sl.addService(service)
 			return
 		}
 
 		oldService := oldServiceRef.(*Service)
 
-		if oldService.IP() != service.IP() {
-			sl.IP2ServiceMap.Delete(oldService.IP())
-			sl.IP2ServiceMap.Store(service.IP(), service)
+		newIPs := service.IPs()
+		for _, ip := range oldService.IPs() {
+			if !containsIP(newIPs, ip) {
+				deleteIfOwnedBy(&idx.IP2ServiceMap, ip, oldService.ResUID)
+				sl.IPHistory.Delete(ip, oldService.ResUID, time.Now())
+			}
 		}
+		for _, key := range oldService.nodePortKeys() {
+			deleteIfOwnedBy(&idx.NodePort2Service, key, oldService.ResUID)
+		}
+		sl.updateServiceSearch(service)
 
 		if sl.IsPodWatch {
 			sl.checkRelation(service)
+		} else if sl.IsEndpointSliceWatch {
+			sl.applySlices(service)
 		}
 		sl.Resources.UpdateResource(res)
 	}
@@ -274,12 +357,31 @@ func (sl *ServiceList) DeleteResource(res *resource.Resource) {
 			}
 			return true
 		})
+	case resource.EndpointSliceType:
+		if !sl.IsEndpointSliceWatch {
+			return
+		}
+		sl.deleteSlice(res)
 	case resource.ServiceType:
 		service := &Service{
 			Resource: res,
 		}
 
+		sl.sliceMux.Lock()
+		idx := sl.Index()
+		if oldServiceRef, find := idx.UIDMap.LoadAndDelete(service.ResUID); find {
+			oldService := oldServiceRef.(*Service)
+			idx.ServiceMap.Delete(oldService.NS() + "/" + oldService.Name)
+			for _, ip := range oldService.IPs() {
+				deleteIfOwnedBy(&idx.IP2ServiceMap, ip, oldService.ResUID)
+				sl.IPHistory.Delete(ip, oldService.ResUID, time.Now())
+			}
+			for _, key := range oldService.nodePortKeys() {
+				deleteIfOwnedBy(&idx.NodePort2Service, key, oldService.ResUID)
+			}
+		}
 		sl.Resources.DeleteResource(res)
+		sl.sliceMux.Unlock()
 
 		psMapRef, find := sl.nsScopePodServiceMap.Load(service.NS())
 		if !find {
@@ -329,6 +431,99 @@ func (sl *ServiceList) checkRelation(service *Service) {
 	})
 }
 
+// ServiceSlices 同一个Service关联的全部EndpointSlice
+type ServiceSlices struct {
+	// EndpointSlice UID -> *resource.Resource
+	Slices map[resource.ResUID]*resource.Resource
+}
+
+func (ss *ServiceSlices) list() []*resource.Resource {
+	slices := make([]*resource.Resource, 0, len(ss.Slices))
+	for _, slice := range ss.Slices {
+		slices = append(slices, slice)
+	}
+	return slices
+}
+
+func sliceServiceKey(slice *resource.Resource) string {
+	return slice.StringAttr[resource.NamespaceAttr] + "/" + slice.StringAttr[resource.EndpointSliceServiceName]
+}
+
+func (sl *ServiceList) updateSlice(slice *resource.Resource) {
+	if len(slice.StringAttr[resource.EndpointSliceServiceName]) == 0 {
+		// 不属于任何Service的EndpointSlice
+		return
+	}
+	key := sliceServiceKey(slice)
+
+	sl.sliceMux.Lock()
+	defer sl.sliceMux.Unlock()
+	ssRef, _ := sl.serviceSlicesMap.LoadOrStore(key, &ServiceSlices{
+		Slices: map[resource.ResUID]*resource.Resource{},
+	})
+	ss := ssRef.(*ServiceSlices)
+	ss.Slices[slice.ResUID] = slice
+
+	sl.refreshServiceEndpoints(key, ss)
+}
+
+func (sl *ServiceList) deleteSlice(slice *resource.Resource) {
+	key := sliceServiceKey(slice)
+
+	sl.sliceMux.Lock()
+	defer sl.sliceMux.Unlock()
+	ssRef, find := sl.serviceSlicesMap.Load(key)
+	if !find {
+		return
+	}
+	ss := ssRef.(*ServiceSlices)
+	delete(ss.Slices, slice.ResUID)
+	if len(ss.Slices) == 0 {
+		sl.serviceSlicesMap.Delete(key)
+	}
+
+	sl.refreshServiceEndpoints(key, ss)
+}
+
+// refreshServiceEndpoints 使用EndpointSlice重建Service的Endpoints, 并发送更新事件
+// ResList中的Service可能正在被查询或编码, 在副本上修改后替换; 调用方需持有sliceMux
+func (sl *ServiceList) refreshServiceEndpoints(key string, ss *ServiceSlices) {
+	serviceRef, find := sl.Index().ServiceMap.Load(key)
+	if !find {
+		// Service尚未同步, 在Service添加时再应用
+		return
+	}
+	service := serviceRef.(*Service).copyForUpdate()
+	service.SetEndpointsFromSlices(ss.list())
+	sl.updateServiceSearch(service)
+	sl.Resources.UpdateResource(service.Resource)
+}
+
+// applySlices 新增或更新Service时, 使用已经缓存的EndpointSlice填充Endpoints, 调用方需持有sliceMux
+func (sl *ServiceList) applySlices(service *Service) {
+	ssRef, find := sl.serviceSlicesMap.Load(service.NS() + "/" + service.Name)
+	if !find {
+		service.SetEndpointsFromSlices(nil)
+		return
+	}
+	service.SetEndpointsFromSlices(ssRef.(*ServiceSlices).list())
+}
+
+// CachedResources 返回不在ResList中的缓存资源, 用于对账EndpointSlice
+func (sl *ServiceList) CachedResources(resType resource.ResType) []*resource.Resource {
+	if resType != resource.EndpointSliceType {
+		return nil
+	}
+	sl.sliceMux.Lock()
+	defer sl.sliceMux.Unlock()
+	var slices []*resource.Resource
+	sl.serviceSlicesMap.Range(func(_, ssRef any) bool {
+		slices = append(slices, ssRef.(*ServiceSlices).list()...)
+		return true
+	})
+	return slices
+}
+
 type Service struct {
 	*resource.Resource
 
@@ -344,6 +539,13 @@ func (s *Service) IP() string {
 	return s.StringAttr[resource.ServiceIP]
 }
 
+// IPs Service的全部IP, 包括双栈的ClusterIPs, ExternalIPs和LoadBalancer Ingress IP, 第一个为ServiceIP
+func (s *Service) IPs() []string {
+	ips := appendIPs(nil, s.IP())
+	ips = appendIPs(ips, splitList(s.StringAttr[resource.ServiceIPs])...)
+	return appendIPs(ips, splitList(s.StringAttr[resource.ServiceExternalIPs])...)
+}
+
 func (s *Service) EndPoints() []string {
 	endpoints := s.StringAttr[resource.ServiceEndpoints]
 	if len(endpoints) == 0 {
@@ -363,6 +565,45 @@ func (s *Service) SvcPorts() map[uint16]uint16 {
 	return res
 }
 
+// portProtocols Service端口使用的协议, 未记录时为TCP
+func (s *Service) portProtocols(port string) []string {
+	protocols := splitList(s.ExtraAttr[resource.ServicePortProtocols][port])
+	if len(protocols) == 0 {
+		return []string{defaultProtocol}
+	}
+	return protocols
+}
+
+// nodePortKeys NodePort/协议
+func (s *Service) nodePortKeys() []string {
+	var keys []string
+	for nodePort, port := range s.ExtraAttr[resource.ServiceNodePorts] {
+		for _, protocol := range s.portProtocols(port) {
+			keys = append(keys, nodePort+"/"+protocol)
+		}
+	}
+	return keys
+}
+
+// targetPort 返回Service端口对应的目标端口, 未声明该端口或协议不匹配时返回false
+// 目标端口为未解析的命名端口时返回0
+func (s *Service) targetPort(port string, protocols []string) (int, bool) {
+	target, find := s.ExtraAttr[resource.ServicePorts2TargetPorts][port]
+	if !find || !matchProtocol(s.portProtocols(port), protocols) {
+		return 0, false
+	}
+	targetPort, _ := strconv.Atoi(target)
+	return targetPort, true
+}
+
+func (s *Service) isClusterIP(ip string) bool {
+	return ip == s.IP() || containsIP(splitList(s.StringAttr[resource.ServiceIPs]), ip)
+}
+
+func (s *Service) isExternalIP(ip string) bool {
+	return containsIP(splitList(s.StringAttr[resource.ServiceExternalIPs]), ip)
+}
+
 func isNum(s string) bool {
 	_, err := strconv.ParseInt(s, 10, 64)
 	return err == nil
@@ -403,6 +644,106 @@ func (s *Service) DeleteEndpoint(oldPod *Pod) {
 	s.StringAttr[resource.ServiceEndpoints] = strings.Join(s.endPoints, ",")
 }
 
+// copyForUpdate 复制SetEndpointsFromSlices会修改的字段, 其余字段与原Service共享
+func (s *Service) copyForUpdate() *Service {
+	copied := *s.Resource
+	copied.StringAttr = make(map[resource.AttrKey]string, len(s.StringAttr))
+	for key, value := range s.StringAttr {
+		copied.StringAttr[key] = value
+	}
+	copied.ExtraAttr = make(map[resource.AttrKey]map[string]string, len(s.ExtraAttr))
+	for key, value := range s.ExtraAttr {
+		copied.ExtraAttr[key] = value
+	}
+	if svc2port, find := s.ExtraAttr[resource.ServicePorts2TargetPorts]; find {
+		targetPorts := make(map[string]string, len(svc2port))
+		for svcPort, target := range svc2port {
+			targetPorts[svcPort] = target
+		}
+		copied.ExtraAttr[resource.ServicePorts2TargetPorts] = targetPorts
+	}
+	return &Service{Resource: &copied, endPoints: s.endPoints}
+}
+
+// SetEndpointsFromSlices 使用EndpointSlice替换Service现有的R_ENDPOINT关系
+// ServiceEndpoints只记录就绪的Endpoint, R_ENDPOINT关系包含全部Endpoint及其状态
+// 直接修改Service, 已经在ResList中的Service需要先通过copyForUpdate复制
+func (s *Service) SetEndpointsFromSlices(slices []*resource.Resource) {
+	relations := make([]resource.Relation, 0, len(s.Relations))
+	for _, relation := range s.Relations {
+		if relation.ReType != resource.R_ENDPOINT {
+			relations = append(relations, relation)
+		}
+	}
+
+	var readyEndpoints []string
+	name2port := make(map[string]string)
+	for _, slice := range slices {
+		for _, relation := range slice.Relations {
+			relations = append(relations, relation)
+			if relation.StringAttr[resource.EndpointReady] == "true" {
+				readyEndpoints = append(readyEndpoints, relation.StringAttr[resource.PodIP])
+			}
+		}
+		for name, port := range slice.ExtraAttr[resource.EndpointSlicePorts] {
+			name2port[name] = port
+		}
+	}
+	s.Relations = relations
+	s.endPoints = readyEndpoints
+	s.StringAttr[resource.ServiceEndpoints] = strings.Join(readyEndpoints, ",")
+
+	// EndpointSlice中的端口名称与Service端口名称一致, 用于解析命名的targetPort
+	svc2port := s.ExtraAttr[resource.ServicePorts2TargetPorts]
+	port2name := s.ExtraAttr[resource.ServicePortNames]
+	for svcPort, target := range svc2port {
+		if isNum(target) {
+			continue
+		}
+		if port, ok := name2port[port2name[svcPort]]; ok {
+			svc2port[svcPort] = port
+		}
+	}
+}
+
+type Endpoint struct {
+	IP          string
+	TargetUID   resource.ResUID
+	TargetKind  string
+	NodeName    string
+	Ready       bool
+	Serving     bool
+	Terminating bool
+}
+
+// EndpointStates 返回全部Endpoint及其状态
+// 基于Selector匹配时, 只包含非Pending的Pod, 状态均视为就绪
+func (s *Service) EndpointStates() []Endpoint {
+	var endpoints []Endpoint
+	for _, relation := range s.Relations {
+		if relation.ReType != resource.R_ENDPOINT {
+			continue
+		}
+		endpoint := Endpoint{
+			IP:         relation.StringAttr[resource.PodIP],
+			TargetUID:  relation.ResUID,
+			TargetKind: relation.StringAttr[resource.EndpointTargetKind],
+			NodeName:   relation.StringAttr[resource.EndpointNodeName],
+			Ready:      true,
+			Serving:    true,
+		}
+		if ready, find := relation.StringAttr[resource.EndpointReady]; find {
+			endpoint.Ready = ready == "true"
+		}
+		if serving, find := relation.StringAttr[resource.EndpointServing]; find {
+			endpoint.Serving = serving == "true"
+		}
+		endpoint.Terminating = relation.StringAttr[resource.EndpointTerminating] == "true"
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
 func (s *Service) MatchedPods() []*resource.ResUID {
 	podUIDs := []*resource.ResUID{}
 	for _, relation := range s.Relations {
@@ -413,6 +754,10 @@ func (s *Service) MatchedPods() []*resource.ResUID {
 	return podUIDs
 }
 
+func (s *Service) Labels() map[string]string {
+	return s.Resource.ExtraAttr[resource.ServiceLabelsAttr]
+}
+
 func (s *Service) Selectors() map[string]string {
 	return s.Resource.ExtraAttr[resource.ServiceSelectorsAttr]
 }
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func testService(uid string, name string) *resource.Resource {
+	return &resource.Resource{
+		ResUID:    resource.ResUID(uid),
+		ResType:   resource.ServiceType,
+		Name:      name,
+		Relations: []resource.Relation{},
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: "default",
+			resource.ServiceIP:     "10.96.0.10",
+		},
+		Int64Attr: map[resource.AttrKey]int64{},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.ServicePorts2TargetPorts: {"80": "http"},
+			resource.ServicePortNames:         {"80": "web"},
+		},
+	}
+}
+
+func testEndpoint(podUID string, ip string, ready string) resource.Relation {
+	return resource.Relation{
+		ResUID: resource.ResUID(podUID),
+		ReType: resource.R_ENDPOINT,
+		StringAttr: map[resource.AttrKey]string{
+			resource.PodIP:               ip,
+			resource.EndpointReady:       ready,
+			resource.EndpointServing:     ready,
+			resource.EndpointTerminating: "false",
+			resource.EndpointTargetKind:  "Pod",
+		},
+	}
+}
+
+func testEndpointSlice(uid string, serviceName string, endpoints ...resource.Relation) *resource.Resource {
+	return &resource.Resource{
+		ResUID:    resource.ResUID(uid),
+		ResType:   resource.EndpointSliceType,
+		Name:      uid,
+		Relations: endpoints,
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr:            "default",
+			resource.EndpointSliceServiceName: serviceName,
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.EndpointSlicePorts: {"web": "8080"},
+		},
+	}
+}
+
+func TestServiceListWithEndpointSlice(t *testing.T) {
+	sl := NewServiceList(resource.ServiceType, nil).(*ServiceList)
+	sl.SetExporter(nonExporter{})
+	sl.EnableEndpointSliceMatch()
+
+	// EndpointSlice先于Service到达
+	sl.AddResource(testEndpointSlice("slice-1", "web",
+		testEndpoint("pod-1", "172.16.0.1", "true"),
+		testEndpoint("pod-2", "172.16.0.2", "false"),
+	))
+	sl.AddResource(testService("svc-uid", "web"))
+
+	serviceRef, find := sl.Index().ServiceMap.Load("default/web")
+	assert.True(t, find)
+	service := serviceRef.(*Service)
+	assert.Equal(t, []string{"172.16.0.1"}, service.EndPoints())
+	assert.Equal(t, map[uint16]uint16{80: 8080}, service.SvcPorts())
+
+	states := service.EndpointStates()
+	assert.Len(t, states, 2)
+	assert.Equal(t, resource.ResUID("pod-2"), states[1].TargetUID)
+	assert.False(t, states[1].Ready)
+
+	loadService := func() *Service {
+		serviceRef, _ := sl.Index().ServiceMap.Load("default/web")
+		return serviceRef.(*Service)
+	}
+	sl.AddResource(testEndpointSlice("slice-2", "web",
+		testEndpoint("pod-3", "172.16.0.3", "true"),
+	))
+	assert.ElementsMatch(t, []string{"172.16.0.1", "172.16.0.3"}, loadService().EndPoints())
+	assert.Same(t, loadService().Resource, sl.ResList[0])
+	// 已经读取的Service不会被修改
+	assert.Equal(t, []string{"172.16.0.1"}, service.EndPoints())
+	assert.Len(t, service.EndpointStates(), 2)
+
+	sl.DeleteResource(testEndpointSlice("slice-1", "web"))
+	assert.Equal(t, []string{"172.16.0.3"}, loadService().EndPoints())
+	assert.Len(t, loadService().EndpointStates(), 1)
+	svc, find := sl.Index().UIDMap.Load(resource.ResUID("svc-uid"))
+	assert.True(t, find)
+	assert.Same(t, loadService(), svc)
+}
+
+func TestServiceUpdateDuringSliceRefresh(t *testing.T) {
+	sl := NewServiceList(resource.ServiceType, nil).(*ServiceList)
+	sl.SetExporter(nonExporter{})
+	sl.EnableEndpointSliceMatch()
+	sl.AddResource(testService("svc-uid", "web"))
+
+	// 刷新Endpoints时不能用旧的Service覆盖期间到达的更新
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			sl.UpdateResource(testEndpointSlice("slice-1", "web",
+				testEndpoint("pod-1", "172.16.0.1", "true"),
+			))
+		}
+	}()
+	updated := testService("svc-uid", "web")
+	updated.StringAttr[resource.ServiceIP] = "10.96.0.20"
+	for i := 0; i < 100; i++ {
+		sl.UpdateResource(updated)
+	}
+	<-done
+
+	serviceRef, find := sl.Index().ServiceMap.Load("default/web")
+	assert.True(t, find)
+	assert.Equal(t, "10.96.0.20", serviceRef.(*Service).IP())
+	assert.Equal(t, []string{"172.16.0.1"}, serviceRef.(*Service).EndPoints())
+	_, find = sl.Index().IP2ServiceMap.Load("10.96.0.10")
+	assert.False(t, find)
+}
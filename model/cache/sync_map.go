@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// deleteIfOwnedBy 仅当索引仍指向指定UID的资源时才删除
+func deleteIfOwnedBy(m *sync.Map, key string, UID resource.ResUID) {
+	ref, find := m.Load(key)
+	if !find {
+		return
+	}
+	if res, ok := ref.(interface{ UID() resource.ResUID }); ok && res.UID() != UID {
+		return
+	}
+	m.Delete(key)
+}
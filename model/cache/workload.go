@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+var _ resource.ResHandler = &WorkloadList{}
+
+// WorkloadList 处理ReplicaSet/Deployment/StatefulSet/DaemonSet/Job/CronJob等工作负载资源
+// 每种工作负载类型使用独立的WorkloadList
+type WorkloadList struct {
+	*resource.Resources
+	index atomic.Pointer[WorkloadIndex]
+}
+
+// WorkloadIndex WorkloadList的查询表, Reset时重建后整体替换
+type WorkloadIndex struct {
+	// Workload UID -> *Workload
+	UIDMap sync.Map
+	// Namespace/Name -> *Workload
+	WorkloadMap sync.Map
+}
+
+func (idx *WorkloadIndex) store(workload *Workload) {
+	idx.UIDMap.Store(workload.ResUID, workload)
+	idx.WorkloadMap.Store(workload.NS()+"/"+workload.Name, workload)
+}
+
+func NewWorkloadList(resType resource.ResType, resList []*resource.Resource) resource.ResHandler {
+	wl := &WorkloadList{
+		Resources: &resource.Resources{
+			ResType: resType,
+			ResList: resList,
+		},
+	}
+	wl.index.Store(newWorkloadIndex(resList))
+
+	if resList == nil {
+		wl.Resources.ResList = []*resource.Resource{}
+	}
+	return wl
+}
+
+func newWorkloadIndex(resList []*resource.Resource) *WorkloadIndex {
+	idx := &WorkloadIndex{}
+	for _, res := range resList {
+		idx.store(&Workload{Resource: res})
+	}
+	return idx
+}
+
+// Index 当前的查询表
+func (wl *WorkloadList) Index() *WorkloadIndex {
+	return wl.index.Load()
+}
+
+func (wl *WorkloadList) Reset(resList []*resource.Resource) {
+	// 重建后整体替换, 期间的查询仍使用旧的查询表
+	wl.index.Store(newWorkloadIndex(resList))
+	wl.Resources.Reset(resList)
+}
+
+func (wl *WorkloadList) AddResource(res *resource.Resource) {
+	wl.Index().store(&Workload{Resource: res})
+	wl.Resources.AddResource(res)
+}
+
+func (wl *WorkloadList) UpdateResource(res *resource.Resource) {
+	wl.Index().store(&Workload{Resource: res})
+	wl.Resources.UpdateResource(res)
+}
+
+func (wl *WorkloadList) DeleteResource(res *resource.Resource) {
+	idx := wl.Index()
+	oldRef, find := idx.UIDMap.LoadAndDelete(res.ResUID)
+	if find {
+		old := oldRef.(*Workload)
+		idx.WorkloadMap.Delete(old.NS() + "/" + old.Name)
+	}
+	wl.Resources.DeleteResource(res)
+}
+
+func (wl *WorkloadList) GetWorkloadByUID(UID resource.ResUID) (*Workload, bool) {
+	ref, find := wl.Index().UIDMap.Load(UID)
+	if !find {
+		return nil, false
+	}
+	return ref.(*Workload), true
+}
+
+type Workload struct {
+	*resource.Resource
+}
+
+func (w *Workload) NS() string {
+	return w.StringAttr[resource.NamespaceAttr]
+}
+
+func (w *Workload) Kind() string {
+	switch w.ResType {
+	case resource.ReplicaSetType:
+		return "ReplicaSet"
+	case resource.DeploymentType:
+		return "Deployment"
+	case resource.StatefulSetType:
+		return "StatefulSet"
+	case resource.DaemonSetType:
+		return "DaemonSet"
+	case resource.JobType:
+		return "Job"
+	case resource.CronJobType:
+		return "CronJob"
+	}
+	return ""
+}
+
+func (w *Workload) Labels() map[string]string {
+	return w.ExtraAttr[resource.WorkloadLabelsAttr]
+}
+
+func (w *Workload) Selectors() map[string]string {
+	return w.ExtraAttr[resource.WorkloadSelectorsAttr]
+}
+
+func (w *Workload) Replicas() int64 {
+	return w.Int64Attr[resource.WorkloadReplicas]
+}
+
+func (w *Workload) ReadyReplicas() int64 {
+	return w.Int64Attr[resource.WorkloadReadyReplicas]
+}
+
+// Owner 返回工作负载的控制者, 如ReplicaSet所属的Deployment, Job所属的CronJob
+func (w *Workload) Owner() (resource.Relation, bool) {
+	for _, relation := range w.Relations {
+		if relation.ReType == resource.R_OWNER {
+			return relation, true
+		}
+	}
+	return resource.Relation{}, false
+}
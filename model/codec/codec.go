@@ -0,0 +1,200 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding 序列化方式
+type Encoding string
+
+const (
+	// JSON 默认编码, 兼容未升级的实例
+	JSON Encoding = "json"
+	// Gob 紧凑的二进制编码, AttrKey作为整数写入, 仅用于Go实现的实例之间
+	Gob Encoding = "gob"
+)
+
+// Compression 压缩方式
+type Compression string
+
+const (
+	NoCompression Compression = ""
+	Gzip          Compression = "gzip"
+	Zstd          Compression = "zstd"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeGob  = "application/x-gob"
+)
+
+// Codec 负责/push, /fetch, /query数据的编解码, 零值为不压缩的JSON
+type Codec struct {
+	Encoding    Encoding
+	Compression Compression
+}
+
+var Default = Codec{Encoding: JSON}
+
+func ParseEncoding(encoding string) (Encoding, error) {
+	switch Encoding(strings.ToLower(encoding)) {
+	case "", JSON:
+		return JSON, nil
+	case Gob:
+		return Gob, nil
+	}
+	return "", fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+func ParseCompression(compression string) (Compression, error) {
+	switch Compression(strings.ToLower(compression)) {
+	case NoCompression, "none", "identity":
+		return NoCompression, nil
+	case Gzip:
+		return Gzip, nil
+	case Zstd:
+		return Zstd, nil
+	}
+	return "", fmt.Errorf("unsupported compression %q", compression)
+}
+
+func (c Codec) ContentType() string {
+	if c.Encoding == Gob {
+		return ContentTypeGob
+	}
+	return ContentTypeJSON
+}
+
+func (c Codec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := c.compressWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if c.Encoding == Gob {
+		err = gob.NewEncoder(writer).Encode(v)
+	} else {
+		err = json.NewEncoder(writer).Encode(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Codec) Unmarshal(data []byte, v any) error {
+	return c.Decode(bytes.NewReader(data), v)
+}
+
+func (c Codec) Decode(r io.Reader, v any) error {
+	reader, err := c.decompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if c.Encoding == Gob {
+		return gob.NewDecoder(reader).Decode(v)
+	}
+	return json.NewDecoder(reader).Decode(v)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (c Codec) compressWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.Compression {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+func (c Codec) decompressReader(r io.Reader) (io.ReadCloser, error) {
+	switch c.Compression {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// SetContentHeaders 设置发送数据的Content-Type和Content-Encoding
+func (c Codec) SetContentHeaders(header http.Header) {
+	header.Set("Content-Type", c.ContentType())
+	if c.Compression != NoCompression {
+		header.Set("Content-Encoding", string(c.Compression))
+	}
+}
+
+// SetAcceptHeaders 设置期望接收的数据格式, 由对端通过Negotiate选择
+func (c Codec) SetAcceptHeaders(header http.Header) {
+	header.Set("Accept", c.ContentType())
+	if c.Compression != NoCompression {
+		header.Set("Accept-Encoding", string(c.Compression))
+	}
+}
+
+// FromContentHeaders 根据Content-Type和Content-Encoding解析数据格式, 未设置时为JSON
+func FromContentHeaders(header http.Header) (Codec, error) {
+	c := Default
+	if contentType := header.Get("Content-Type"); len(contentType) > 0 {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return c, err
+		}
+		if mediaType == ContentTypeGob {
+			c.Encoding = Gob
+		}
+	}
+	compression, err := ParseCompression(header.Get("Content-Encoding"))
+	if err != nil {
+		return c, err
+	}
+	c.Compression = compression
+	return c, nil
+}
+
+// Negotiate 根据Accept和Accept-Encoding选择返回的数据格式, 不支持的格式回退为不压缩的JSON
+func Negotiate(header http.Header) Codec {
+	c := Default
+	for _, accept := range strings.Split(header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == ContentTypeGob {
+			c.Encoding = Gob
+			break
+		}
+	}
+	for _, accept := range strings.Split(header.Get("Accept-Encoding"), ",") {
+		// 忽略q值, 按照客户端给出的顺序选择第一个支持的压缩方式
+		name, _, _ := strings.Cut(strings.TrimSpace(accept), ";")
+		compression, err := ParseCompression(name)
+		if err == nil && compression != NoCompression {
+			c.Compression = compression
+			break
+		}
+	}
+	return c
+}
@@ -0,0 +1,78 @@
+package codec
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	syncReq := &resource.SyncRequest{
+		Events: []*resource.ResourceEvent{{
+			ClusterID:    "cluster-a",
+			ResourceType: resource.PodType,
+			Operation:    resource.ResetOP,
+			Res: []*resource.Resource{{
+				ResUID:     "uid-1",
+				ResType:    resource.PodType,
+				Name:       "pod-1",
+				StringAttr: map[resource.AttrKey]string{resource.PodIP: "10.0.0.1"},
+				Int64Attr:  map[resource.AttrKey]int64{resource.PodHostNetwork: 1},
+				ExtraAttr: map[resource.AttrKey]map[string]string{
+					resource.PodLabelsAttr: {"app": "web"},
+				},
+			}},
+		}},
+		CheckPoint: &resource.CheckPoint{AgentIndex: 1, EventIndex: 2},
+	}
+
+	for _, encoding := range []Encoding{JSON, Gob} {
+		for _, compression := range []Compression{NoCompression, Gzip, Zstd} {
+			c := Codec{Encoding: encoding, Compression: compression}
+			t.Run(string(encoding)+"/"+string(compression), func(t *testing.T) {
+				data, err := c.Marshal(syncReq)
+				require.NoError(t, err)
+
+				header := http.Header{}
+				c.SetContentHeaders(header)
+				parsed, err := FromContentHeaders(header)
+				require.NoError(t, err)
+				assert.Equal(t, c, parsed)
+
+				var decoded resource.SyncRequest
+				require.NoError(t, parsed.Unmarshal(data, &decoded))
+				assert.Equal(t, syncReq.CheckPoint, decoded.CheckPoint)
+				require.Len(t, decoded.Events, 1)
+				assert.Equal(t, syncReq.Events[0].Res[0], decoded.Events[0].Res[0])
+			})
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		encode string
+		want   Codec
+	}{
+		{name: "default", want: Codec{Encoding: JSON}},
+		{name: "gob zstd", accept: ContentTypeGob, encode: "zstd", want: Codec{Encoding: Gob, Compression: Zstd}},
+		{name: "browser", accept: "text/html, application/json;q=0.9", encode: "br, gzip;q=0.8", want: Codec{Encoding: JSON, Compression: Gzip}},
+		{name: "unsupported", accept: "application/x-protobuf", encode: "br", want: Codec{Encoding: JSON}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Accept", tt.accept)
+			header.Set("Accept-Encoding", tt.encode)
+			assert.Equal(t, tt.want, Negotiate(header))
+		})
+	}
+
+	_, err := FromContentHeaders(http.Header{"Content-Encoding": {"br"}})
+	assert.Error(t, err)
+}
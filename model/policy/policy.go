@@ -0,0 +1,250 @@
+package policy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// Policy 限制调用方可以查询和获取的集群和Namespace, 并在数据离开进程前移除或哈希指定的标签
+// nil表示不做任何限制
+type Policy struct {
+	clusterIDs map[string]struct{}
+	namespaces map[string]struct{}
+
+	stripKeys keyMatcher
+	hashKeys  keyMatcher
+}
+
+// labelAttrs 需要脱敏的标签类属性, 包括与标签取值相同的selector
+var labelAttrs = []resource.AttrKey{
+	resource.PodLabelsAttr,
+	resource.ServiceLabelsAttr,
+	resource.ServiceSelectorsAttr,
+	resource.NodeLabelsAttr,
+	resource.WorkloadLabelsAttr,
+	resource.WorkloadSelectorsAttr,
+	resource.NamespaceLabelsAttr,
+	resource.NamespaceAnnotationsAttr,
+}
+
+func New() *Policy {
+	return &Policy{}
+}
+
+// WithClusters 只允许访问指定的集群, 为空时不限制
+func (p *Policy) WithClusters(clusterIDs ...string) *Policy {
+	p.clusterIDs = toSet(clusterIDs)
+	return p
+}
+
+// WithNamespaces 只允许访问指定Namespace下的资源, 为空时不限制; Node等集群级资源不受限制
+func (p *Policy) WithNamespaces(namespaces ...string) *Policy {
+	p.namespaces = toSet(namespaces)
+	return p
+}
+
+// WithStripKeys 移除标签中的指定key, 以*结尾时按前缀匹配
+func (p *Policy) WithStripKeys(keys ...string) *Policy {
+	p.stripKeys = newKeyMatcher(keys)
+	return p
+}
+
+// WithHashKeys 将标签中指定key的值替换为哈希, 以*结尾时按前缀匹配
+func (p *Policy) WithHashKeys(keys ...string) *Policy {
+	p.hashKeys = newKeyMatcher(keys)
+	return p
+}
+
+func (p *Policy) AllowCluster(clusterID string) bool {
+	if p == nil || len(p.clusterIDs) == 0 {
+		return true
+	}
+	_, find := p.clusterIDs[clusterID]
+	return find
+}
+
+// ScopeCluster 检查请求的集群; 请求全部集群(clusterID为空)而只允许访问一个集群时, 返回该集群
+func (p *Policy) ScopeCluster(clusterID string) (string, bool) {
+	if p.AllowCluster(clusterID) {
+		return clusterID, true
+	}
+	if len(clusterID) == 0 && len(p.clusterIDs) == 1 {
+		for allowed := range p.clusterIDs {
+			return allowed, true
+		}
+	}
+	return clusterID, false
+}
+
+func (p *Policy) AllowNamespace(namespace string) bool {
+	if p == nil || len(p.namespaces) == 0 || len(namespace) == 0 {
+		return true
+	}
+	_, find := p.namespaces[namespace]
+	return find
+}
+
+func (p *Policy) AllowResource(res *resource.Resource) bool {
+	if res.ResType == resource.NamespaceType {
+		return p.AllowNamespace(res.Name)
+	}
+	return p.AllowNamespace(res.Namespace())
+}
+
+func (p *Policy) needRedact() bool {
+	return p != nil && (!p.stripKeys.empty() || !p.hashKeys.empty())
+}
+
+// Redact 返回脱敏后的资源, 不修改原资源; 不需要脱敏时返回res本身
+func (p *Policy) Redact(res *resource.Resource) *resource.Resource {
+	if res == nil || !p.needRedact() {
+		return res
+	}
+	var extraAttr map[resource.AttrKey]map[string]string
+	for _, attr := range labelAttrs {
+		labels, find := res.ExtraAttr[attr]
+		if !find {
+			continue
+		}
+		redacted, changed := p.redactLabels(labels)
+		if !changed {
+			continue
+		}
+		if extraAttr == nil {
+			extraAttr = make(map[resource.AttrKey]map[string]string, len(res.ExtraAttr))
+			for key, value := range res.ExtraAttr {
+				extraAttr[key] = value
+			}
+		}
+		extraAttr[attr] = redacted
+	}
+	if extraAttr == nil {
+		return res
+	}
+	copied := *res
+	copied.ExtraAttr = extraAttr
+	return &copied
+}
+
+func (p *Policy) redactLabels(labels map[string]string) (map[string]string, bool) {
+	var redacted map[string]string
+	for key, value := range labels {
+		strip := p.stripKeys.match(key)
+		hash := !strip && p.hashKeys.match(key)
+		if !strip && !hash {
+			continue
+		}
+		if redacted == nil {
+			redacted = make(map[string]string, len(labels))
+			for k, v := range labels {
+				redacted[k] = v
+			}
+		}
+		if strip {
+			delete(redacted, key)
+		} else {
+			redacted[key] = hashValue(value)
+		}
+	}
+	return redacted, redacted != nil
+}
+
+// FilterResources 返回允许访问的资源, 并完成脱敏
+func (p *Policy) FilterResources(resList []*resource.Resource) []*resource.Resource {
+	if p == nil {
+		return resList
+	}
+	filtered := make([]*resource.Resource, 0, len(resList))
+	for _, res := range resList {
+		if p.AllowResource(res) {
+			filtered = append(filtered, p.Redact(res))
+		}
+	}
+	return filtered
+}
+
+// FilterEvent 返回允许访问的事件, 事件中不包含允许访问的资源时返回nil; Reset事件始终保留
+func (p *Policy) FilterEvent(event *resource.ResourceEvent) *resource.ResourceEvent {
+	if p == nil {
+		return event
+	}
+	if !p.AllowCluster(event.ClusterID) {
+		return nil
+	}
+	resList := p.FilterResources(event.Res)
+	if len(resList) == 0 && event.Operation != resource.ResetOP {
+		return nil
+	}
+	copied := *event
+	copied.Res = resList
+	return &copied
+}
+
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+type keyMatcher struct {
+	keys     map[string]struct{}
+	prefixes []string
+}
+
+func newKeyMatcher(keys []string) keyMatcher {
+	var m keyMatcher
+	for _, key := range keys {
+		if prefix, isPrefix := strings.CutSuffix(key, "*"); isPrefix {
+			m.prefixes = append(m.prefixes, prefix)
+			continue
+		}
+		if m.keys == nil {
+			m.keys = map[string]struct{}{}
+		}
+		m.keys[key] = struct{}{}
+	}
+	return m
+}
+
+func (m keyMatcher) empty() bool {
+	return len(m.keys) == 0 && len(m.prefixes) == 0
+}
+
+func (m keyMatcher) match(key string) bool {
+	if _, find := m.keys[key]; find {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func toSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+type policyKey struct{}
+
+// WithPolicy 将调用方的Policy传递给/query, /fetch等处理函数
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+// FromContext 未配置时返回nil
+func FromContext(ctx context.Context) *Policy {
+	p, _ := ctx.Value(policyKey{}).(*Policy)
+	return p
+}
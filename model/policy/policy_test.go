@@ -0,0 +1,90 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPod(namespace string, labels map[string]string) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(namespace + "-pod"),
+		ResType:    resource.PodType,
+		Name:       "pod",
+		StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: namespace},
+		ExtraAttr:  map[resource.AttrKey]map[string]string{resource.PodLabelsAttr: labels},
+	}
+}
+
+func TestScope(t *testing.T) {
+	var unrestricted *policy.Policy
+	assert.True(t, unrestricted.AllowCluster("any"))
+	assert.True(t, unrestricted.AllowNamespace("any"))
+
+	p := policy.New().WithClusters("cluster-a").WithNamespaces("team-a")
+	assert.True(t, p.AllowCluster("cluster-a"))
+	assert.False(t, p.AllowCluster("cluster-b"))
+
+	clusterID, ok := p.ScopeCluster("")
+	assert.True(t, ok)
+	assert.Equal(t, "cluster-a", clusterID)
+	_, ok = policy.New().WithClusters("cluster-a", "cluster-b").ScopeCluster("")
+	assert.False(t, ok)
+
+	assert.True(t, p.AllowResource(testPod("team-a", nil)))
+	assert.False(t, p.AllowResource(testPod("team-b", nil)))
+	// 集群级资源不受Namespace限制, Namespace资源按名称判断
+	assert.True(t, p.AllowResource(&resource.Resource{ResType: resource.NodeType, Name: "node-1"}))
+	assert.False(t, p.AllowResource(&resource.Resource{ResType: resource.NamespaceType, Name: "team-b"}))
+}
+
+func TestRedact(t *testing.T) {
+	p := policy.New().WithStripKeys("customer", "example.com/*").WithHashKeys("tenant")
+	pod := testPod("default", map[string]string{
+		"app":               "web",
+		"customer":          "acme",
+		"example.com/owner": "alice",
+		"tenant":            "acme",
+	})
+
+	redacted := p.Redact(pod)
+	labels := redacted.ExtraAttr[resource.PodLabelsAttr]
+	assert.Equal(t, "web", labels["app"])
+	assert.NotContains(t, labels, "customer")
+	assert.NotContains(t, labels, "example.com/owner")
+	assert.NotEqual(t, "acme", labels["tenant"])
+	assert.Equal(t, p.Redact(pod).ExtraAttr[resource.PodLabelsAttr]["tenant"], labels["tenant"])
+
+	// 原资源不被修改
+	assert.Equal(t, "acme", pod.ExtraAttr[resource.PodLabelsAttr]["customer"])
+	// 不需要脱敏时返回原资源
+	clean := testPod("default", map[string]string{"app": "web"})
+	assert.Same(t, clean, p.Redact(clean))
+}
+
+func TestFilterEvent(t *testing.T) {
+	p := policy.New().WithClusters("cluster-a").WithNamespaces("team-a")
+
+	assert.Nil(t, p.FilterEvent(&resource.ResourceEvent{
+		ClusterID: "cluster-b",
+		Operation: resource.AddOP,
+		Res:       []*resource.Resource{testPod("team-a", nil)},
+	}))
+	assert.Nil(t, p.FilterEvent(&resource.ResourceEvent{
+		ClusterID: "cluster-a",
+		Operation: resource.AddOP,
+		Res:       []*resource.Resource{testPod("team-b", nil)},
+	}))
+
+	reset := p.FilterEvent(&resource.ResourceEvent{
+		ClusterID: "cluster-a",
+		Operation: resource.ResetOP,
+		Res:       []*resource.Resource{testPod("team-a", nil), testPod("team-b", nil)},
+	})
+	require.NotNil(t, reset)
+	require.Len(t, reset.Res, 1)
+	assert.Equal(t, "team-a", reset.Res[0].Namespace())
+}
@@ -16,16 +16,66 @@ const (
 	PodHostNetwork   AttrKey = 0x0016 // bool
 	Name2Port        AttrKey = 0x0017 // extra map[string]string
 
+	// R_CONTAINER Relation
+	ContainerName         AttrKey = 0x0018 // string
+	ContainerImage        AttrKey = 0x0019 // string
+	ContainerImageID      AttrKey = 0x001A // string
+	ContainerType         AttrKey = 0x001B // string container / init / ephemeral
+	ContainerRestartCount AttrKey = 0x001C // string
+	ContainerReady        AttrKey = 0x001D // string true / false
+	ContainerState        AttrKey = 0x001E // string waiting / running / terminated
+	ContainerStateReason  AttrKey = 0x001F // string CrashLoopBackOff / OOMKilled / ...
+
 	// K8sService
 	ServiceSelectorsAttr     AttrKey = 0x0020 // extra map[string]string
 	ServiceIP                AttrKey = 0x0021 // string
 	ServiceEndpoints         AttrKey = 0x0022 // string ip1,ip2,...
 	ServicePorts2TargetPorts AttrKey = 0x0023 // string name:port-targetPort-nodePort,name2:port-targetPort-nodePort
+	ServicePortNames         AttrKey = 0x0024 // extra map[string]string port -> name
+
+	// K8sEndpointSlice
+	EndpointSliceServiceName AttrKey = 0x0025 // string
+	EndpointSlicePorts       AttrKey = 0x0026 // extra map[string]string name -> port
+
+	// R_ENDPOINT Relation
+	EndpointReady       AttrKey = 0x0027 // string true / false
+	EndpointServing     AttrKey = 0x0028 // string true / false
+	EndpointTerminating AttrKey = 0x0029 // string true / false
+	EndpointNodeName    AttrKey = 0x002A // string
+	EndpointTargetKind  AttrKey = 0x002B // string Pod / ...
+
+	ServiceLabelsAttr AttrKey = 0x002C // extra map[string]string
 
 	// Node
 	NodeInternalIP AttrKey = 0x0030
 	NodeExternalIP AttrKey = 0x0031
 	NodeHostName   AttrKey = 0x0032
+	NodeLabelsAttr AttrKey = 0x0033 // extra map[string]string
+
+	// Workload: ReplicaSet/Deployment/StatefulSet/DaemonSet/Job/CronJob
+	WorkloadLabelsAttr        AttrKey = 0x0040 // extra map[string]string
+	WorkloadSelectorsAttr     AttrKey = 0x0041 // extra map[string]string
+	WorkloadReplicas          AttrKey = 0x0042 // int64 desired replicas
+	WorkloadReadyReplicas     AttrKey = 0x0043 // int64
+	WorkloadAvailableReplicas AttrKey = 0x0044 // int64
+	CronJobSchedule           AttrKey = 0x0045 // string
+
+	// Namespace
+	NamespaceLabelsAttr      AttrKey = 0x0050 // extra map[string]string
+	NamespaceAnnotationsAttr AttrKey = 0x0051 // extra map[string]string
+	NamespacePhase           AttrKey = 0x0052 // string Active / Terminating
+	NamespaceCreationTime    AttrKey = 0x0053 // int64 unix timestamp(second)
+
+	// 双栈和多地址, 单地址的PodIP/ServiceIP/NodeInternalIP等属性保持不变
+	PodIPs             AttrKey = 0x0060 // string ip1,ip2,... status.podIPs
+	ServiceIPs         AttrKey = 0x0061 // string ip1,ip2,... spec.clusterIPs
+	ServiceExternalIPs AttrKey = 0x0062 // string ip1,ip2,... spec.externalIPs和LoadBalancer Ingress IP
+	NodeIPs            AttrKey = 0x0063 // string ip1,ip2,... 全部InternalIP和ExternalIP
+
+	// 根据IP和端口解析访问的对象
+	PodHostPorts         AttrKey = 0x0064 // string port/protocol,... 占用节点的端口, hostNetwork时为全部容器端口
+	ServiceNodePorts     AttrKey = 0x0065 // extra map[string]string nodePort -> port
+	ServicePortProtocols AttrKey = 0x0066 // extra map[string]string port -> TCP,UDP,...
 
 	// OwnerAttribute
 	OwnerName AttrKey = 0x0111
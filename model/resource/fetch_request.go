@@ -2,4 +2,39 @@ package resource
 
 type FetchRequest struct {
 	ResourceTypes []ResType
+	// 不为空时只获取该集群的资源
+	ClusterID string `json:",omitempty"`
+
+	// 断线重连时携带上次处理的事件序号, 服务端事件日志仍覆盖时只推送遗漏的事件, 否则推送全量数据
+	Epoch        string `json:",omitempty"`
+	LastSequence uint64 `json:",omitempty"`
+}
+
+// FetchProgress 记录fetcher已经处理的事件序号
+type FetchProgress struct {
+	Epoch    string
+	Sequence uint64
+}
+
+// Accept 判断是否需要处理syncReq并更新进度, 重复推送的事件返回false
+// 服务端不支持序号(Epoch为空)时始终返回true
+func (p *FetchProgress) Accept(syncReq *SyncRequest) bool {
+	if len(syncReq.Epoch) == 0 {
+		return true
+	}
+	if syncReq.Epoch == p.Epoch && syncReq.Sequence <= p.Sequence {
+		return false
+	}
+	p.Epoch = syncReq.Epoch
+	p.Sequence = syncReq.Sequence
+	return true
+}
+
+// Request 生成携带当前进度的FetchRequest
+func (p *FetchProgress) Request(resTypes []ResType) *FetchRequest {
+	return &FetchRequest{
+		ResourceTypes: resTypes,
+		Epoch:         p.Epoch,
+		LastSequence:  p.Sequence,
+	}
 }
@@ -5,6 +5,8 @@ type RelationType int
 const (
 	R_OWNER    RelationType = 0x0001
 	R_ENDPOINT RelationType = 0x0003
+	// Pod中的容器, ResUID为不含运行时前缀的完整容器ID
+	R_CONTAINER RelationType = 0x0004
 )
 
 type Relation struct {
@@ -21,3 +21,32 @@ type Resource struct {
 	// Selector for services
 	ExtraAttr map[AttrKey]map[string]string `json:"extraInfo"`
 }
+
+func (r *Resource) UID() ResUID {
+	return r.ResUID
+}
+
+// Namespace 返回资源所在的Namespace, Node等集群级资源返回空
+func (r *Resource) Namespace() string {
+	return r.StringAttr[NamespaceAttr]
+}
+
+var labelsAttrs = map[ResType]AttrKey{
+	PodType:       PodLabelsAttr,
+	ServiceType:   ServiceLabelsAttr,
+	NodeType:      NodeLabelsAttr,
+	NamespaceType: NamespaceLabelsAttr,
+}
+
+// Labels 返回资源的标签
+func (r *Resource) Labels() map[string]string {
+	if key, find := labelsAttrs[r.ResType]; find {
+		return r.ExtraAttr[key]
+	}
+	for _, workloadType := range WorkloadTypes {
+		if r.ResType == workloadType {
+			return r.ExtraAttr[WorkloadLabelsAttr]
+		}
+	}
+	return nil
+}
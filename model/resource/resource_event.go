@@ -19,12 +19,33 @@ type ResourceEvent struct {
 	Operation    ResOperation
 }
 
+// Malformed 从网络接收的事件可能不完整: 事件或其中的资源为nil, 或Add/Update/Delete事件不包含资源
+func (e *ResourceEvent) Malformed() bool {
+	if e == nil {
+		return true
+	}
+	for _, res := range e.Res {
+		if res == nil {
+			return true
+		}
+	}
+	switch e.Operation {
+	case AddOP, UpdateOP, DeleteOP:
+		return len(e.Res) == 0
+	}
+	return false
+}
+
 type SyncRequest struct {
 	Events []*ResourceEvent
 	// 上次更新时间
 	LastCheckPoint *CheckPoint
 	// 本次更新结束时间
 	CheckPoint *CheckPoint
+
+	// 仅用于/fetch: 服务端事件日志的标识和本次推送的最后一个事件序号
+	Epoch    string `json:",omitempty"`
+	Sequence uint64 `json:",omitempty"`
 }
 
 // IsSyncCheck 是否是同步检查信号
@@ -1,9 +1,81 @@
 package resource
 
+import (
+	"strconv"
+	"strings"
+)
+
 type ResType int
 
 const (
 	PodType     ResType = 0x0001
 	ServiceType ResType = 0x0002
 	NodeType    ResType = 0x0003
+
+	NamespaceType ResType = 0x0004
+	// EndpointSlice 仅用于更新Service的Endpoints, 不单独导出
+	EndpointSliceType ResType = 0x0005
+
+	// Workload
+	ReplicaSetType  ResType = 0x0011
+	DeploymentType  ResType = 0x0012
+	StatefulSetType ResType = 0x0013
+	DaemonSetType   ResType = 0x0014
+	JobType         ResType = 0x0015
+	CronJobType     ResType = 0x0016
 )
+
+// WorkloadTypes 所有工作负载类型
+var WorkloadTypes = []ResType{
+	ReplicaSetType,
+	DeploymentType,
+	StatefulSetType,
+	DaemonSetType,
+	JobType,
+	CronJobType,
+}
+
+var kind2ResType = map[string]ResType{
+	"Pod":         PodType,
+	"Service":     ServiceType,
+	"Node":        NodeType,
+	"Namespace":   NamespaceType,
+	"ReplicaSet":  ReplicaSetType,
+	"Deployment":  DeploymentType,
+	"StatefulSet": StatefulSetType,
+	"DaemonSet":   DaemonSetType,
+	"Job":         JobType,
+	"CronJob":     CronJobType,
+}
+
+// ResTypeFromKind 将K8s资源的Kind转换为ResType
+func ResTypeFromKind(kind string) (ResType, bool) {
+	resType, find := kind2ResType[kind]
+	return resType, find
+}
+
+// ParseResType 解析资源类型, 支持不区分大小写的Kind(如pod, Deployment)或数值
+func ParseResType(name string) (ResType, bool) {
+	for kind, resType := range kind2ResType {
+		if strings.EqualFold(kind, name) {
+			return resType, true
+		}
+	}
+	if value, err := strconv.Atoi(name); err == nil {
+		return ResType(value), true
+	}
+	return 0, false
+}
+
+// Kind 返回ResType对应的K8s Kind, 未知类型返回数值
+func (t ResType) Kind() string {
+	if t == EndpointSliceType {
+		return "EndpointSlice"
+	}
+	for kind, resType := range kind2ResType {
+		if resType == t {
+			return kind
+		}
+	}
+	return strconv.Itoa(int(t))
+}
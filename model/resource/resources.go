@@ -26,6 +26,27 @@ func NewResources(resType ResType, resList []*Resource) *Resources {
 	return resources
 }
 
+// ResourcesRef 返回底层的Resources, 用于获取内嵌了Resources的ResHandler的资源列表
+func (rs *Resources) ResourcesRef() *Resources {
+	return rs
+}
+
+// Len 返回ResList中的资源数量
+func (rs *Resources) Len() int {
+	rs.ExportMux.RLock()
+	defer rs.ExportMux.RUnlock()
+	return len(rs.ResList)
+}
+
+// Snapshot 返回ResList的副本
+func (rs *Resources) Snapshot() []*Resource {
+	rs.ExportMux.RLock()
+	defer rs.ExportMux.RUnlock()
+	resList := make([]*Resource, len(rs.ResList))
+	copy(resList, rs.ResList)
+	return resList
+}
+
 func (rs *Resources) SetClusterID(clusterID string) {
 	rs.ClusterID = clusterID
 }
@@ -41,13 +62,10 @@ func (rs *Resources) SetExporter(exporter Exporter) {
 func (rs *Resources) updateResList(res *Resource) (isUpdated bool) {
 	rs.ExportMux.Lock()
 	defer rs.ExportMux.Unlock()
-	for _, item := range rs.ResList {
+	for i, item := range rs.ResList {
 		if item.ResUID == res.ResUID {
-			item.ResVersion = res.ResVersion
-			item.Relations = res.Relations
-			item.StringAttr = res.StringAttr
-			item.Int64Attr = res.Int64Attr
-			item.ExtraAttr = res.ExtraAttr
+			// 替换为新的对象, 旧对象可能正在被查询或编码, 不能原地修改
+			rs.ResList[i] = res
 			return true
 		}
 	}
@@ -77,7 +95,10 @@ func (rs *Resources) UpdateResource(res *Resource) {
 }
 
 func (rs *Resources) Reset(res []*Resource) {
-	rs.ResList = res
+	rs.ExportMux.Lock()
+	// ResList会被原地修改, 不能与Reset事件共享底层数组
+	rs.ResList = append(make([]*Resource, 0, len(res)), res...)
+	rs.ExportMux.Unlock()
 
 	log.Printf("reset resources: [%s](%d) and send reset event to exporter", rs.ClusterID, rs.ResType)
 	rs.ExportResourceEvents(&ResourceEvent{
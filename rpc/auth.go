@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509"
+	"log"
+
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoutes gRPC方法对应的HTTP路由, 凭证的路由权限对两种传输方式同时生效
+var methodRoutes = map[string]string{
+	"/" + ServiceName + "/Sync":  "/push",
+	"/" + ServiceName + "/Fetch": "/fetch",
+}
+
+// AuthStreamInterceptor 使用与HTTPServer相同的Authenticator认证gRPC调用方, 并传递调用方的Policy
+// authenticator为nil时不认证, 只传递defaultPolicy
+func AuthStreamInterceptor(authenticator server.Authenticator, defaultPolicy *policy.Policy) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := stream.Context()
+		if authenticator == nil {
+			return handler(srv, &authStream{ServerStream: stream, ctx: policy.WithPolicy(ctx, defaultPolicy)})
+		}
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				token = server.BearerToken(values[0])
+			}
+		}
+		var peerCerts []*x509.Certificate
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				peerCerts = tlsInfo.State.PeerCertificates
+			}
+		}
+
+		credential, err := authenticator.Authenticate(token, peerCerts)
+		if err != nil {
+			log.Printf("reject grpc call on [%s]: %v", info.FullMethod, err)
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		route, find := methodRoutes[info.FullMethod]
+		if !find {
+			route = info.FullMethod
+		}
+		if !credential.AllowRoute(route) {
+			return status.Errorf(codes.PermissionDenied, "%s is not allowed for %s", route, credential.Name)
+		}
+		ctx = server.WithCredential(ctx, credential)
+		ctx = policy.WithPolicy(ctx, server.PolicyOf(credential, defaultPolicy))
+		return handler(srv, &authStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// WithBearerToken 每次调用都携带Authorization: Bearer <token>
+// 明文连接同样会发送token, 生产环境需要同时开启TLS
+func WithBearerToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(bearerToken(token))
+}
+
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
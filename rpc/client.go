@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const DefaultPushTimeout = 30 * time.Second
+
+// Dial 连接MetaSource的gRPC服务, 未指定opts时使用明文连接
+func Dial(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(CodecName)))
+	return grpc.NewClient(target, opts...)
+}
+
+// SyncPusher 通过Sync双向流推送同步请求, 每条请求等待服务端的回复
+// 流出错或超时后关闭, 下次推送时重新建立
+type SyncPusher struct {
+	conn *grpc.ClientConn
+	// 单次推送等待回复的超时时间
+	Timeout time.Duration
+
+	mux    sync.Mutex
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+}
+
+func NewSyncPusher(conn *grpc.ClientConn) *SyncPusher {
+	return &SyncPusher{
+		conn:    conn,
+		Timeout: DefaultPushTimeout,
+	}
+}
+
+type pushResult struct {
+	resp *resource.SyncResponse
+	err  error
+}
+
+func (p *SyncPusher) Push(syncReq *resource.SyncRequest) (*resource.SyncResponse, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.stream == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := p.conn.NewStream(ctx, syncStreamDesc, "/"+ServiceName+"/Sync")
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		p.stream, p.cancel = stream, cancel
+	}
+
+	result := make(chan pushResult, 1)
+	stream := p.stream
+	go func() {
+		if err := stream.SendMsg(syncReq); err != nil {
+			result <- pushResult{err: err}
+			return
+		}
+		resp := new(resource.SyncResponse)
+		err := stream.RecvMsg(resp)
+		result <- pushResult{resp: resp, err: err}
+	}()
+
+	timeout := time.NewTimer(p.Timeout)
+	defer timeout.Stop()
+	select {
+	case r := <-result:
+		if r.err != nil {
+			p.resetStream()
+			return nil, r.err
+		}
+		return r.resp, nil
+	case <-timeout.C:
+		p.resetStream()
+		return nil, fmt.Errorf("sync timeout after %s", p.Timeout)
+	}
+}
+
+func (p *SyncPusher) resetStream() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.stream, p.cancel = nil, nil
+}
+
+// Close 关闭当前的流, 不会关闭conn
+func (p *SyncPusher) Close() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.resetStream()
+}
+
+// Fetch 通过Fetch流持续接收服务端推送的数据, 直到ctx结束或连接断开
+func Fetch(ctx context.Context, conn *grpc.ClientConn, request *resource.FetchRequest, handle func(syncReq *resource.SyncRequest)) error {
+	stream, err := conn.NewStream(ctx, fetchStreamDesc, "/"+ServiceName+"/Fetch")
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		syncReq := new(resource.SyncRequest)
+		if err := stream.RecvMsg(syncReq); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		handle(syncReq)
+	}
+}
@@ -0,0 +1,132 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/rpc"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/CloudDetail/metadata/source/metasource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func testPod(uid string) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(uid),
+		ResType:    resource.PodType,
+		Name:       uid,
+		StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: "default"},
+	}
+}
+
+func startServer(t *testing.T, rpcServer *rpc.Server, opts ...grpc.ServerOption) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(opts...)
+	rpcServer.Register(srv)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	return listener.Addr().String()
+}
+
+func TestSync(t *testing.T) {
+	ms := metasource.NewMetaSource()
+	addr := startServer(t, &rpc.Server{Syncer: ms})
+
+	exporter, err := export.NewGRPCExporter(addr, export.HTTPExporterOptions{})
+	require.NoError(t, err)
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(exporter)
+	podList.AddResource(testPod("pod-1"))
+
+	require.Eventually(t, func() bool {
+		handlerMap, find := ms.ClusterMaps.Load("")
+		if !find {
+			return false
+		}
+		handler, find := handlerMap.(*metasource.ClusterHandlerMap).GetHandler(resource.PodType)
+		return find && len(handler.(*resource.Resources).Snapshot()) == 1
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(t, int64(1), ms.AgentCounter.Load())
+}
+
+func TestFetch(t *testing.T) {
+	fetchServer := export.NewFetcherServer()
+	podList := resource.NewResources(resource.PodType, nil)
+	podList.SetExporter(fetchServer)
+	podList.AddResource(testPod("pod-1"))
+	addr := startServer(t, &rpc.Server{Fetcher: fetchServer})
+
+	conn, err := rpc.Dial(addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan *resource.SyncRequest, 10)
+	go rpc.Fetch(ctx, conn, &resource.FetchRequest{ResourceTypes: []resource.ResType{resource.PodType}},
+		func(syncReq *resource.SyncRequest) { received <- syncReq })
+
+	initReq := <-received
+	require.Len(t, initReq.Events, 1)
+	assert.Equal(t, resource.ResetOP, initReq.Events[0].Operation)
+	assert.Equal(t, "pod-1", initReq.Events[0].Res[0].Name)
+
+	podList.AddResource(testPod("pod-2"))
+	select {
+	case syncReq := <-received:
+		assert.Equal(t, resource.AddOP, syncReq.Events[0].Operation)
+		assert.Equal(t, "pod-2", syncReq.Events[0].Res[0].Name)
+	case <-ctx.Done():
+		t.Fatal("add event not received")
+	}
+}
+
+func TestUnimplemented(t *testing.T) {
+	addr := startServer(t, &rpc.Server{})
+	conn, err := rpc.Dial(addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = rpc.NewSyncPusher(conn).Push(&resource.SyncRequest{})
+	assert.Error(t, err)
+}
+
+func TestSyncAuth(t *testing.T) {
+	authenticator := server.NewStaticAuthenticator(&configs.AuthConfig{
+		Credentials: []configs.CredentialConfig{
+			{Name: "agent", Token: "agent-token", ClusterIDs: []string{"cluster-a"}},
+		},
+	})
+	addr := startServer(t, &rpc.Server{Syncer: metasource.NewMetaSource()},
+		grpc.StreamInterceptor(rpc.AuthStreamInterceptor(authenticator, nil)))
+
+	push := func(token string, clusterID string) error {
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if len(token) > 0 {
+			opts = append(opts, rpc.WithBearerToken(token))
+		}
+		conn, err := rpc.Dial(addr, opts...)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = rpc.NewSyncPusher(conn).Push(&resource.SyncRequest{
+			Events:     []*resource.ResourceEvent{{ClusterID: clusterID, ResourceType: resource.PodType, Operation: resource.ResetOP}},
+			CheckPoint: &resource.CheckPoint{AgentIndex: 1, EventIndex: 1},
+		})
+		return err
+	}
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(push("", "cluster-a")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(push("agent-token", "cluster-b")))
+	assert.NoError(t, push("agent-token", "cluster-a"))
+}
@@ -0,0 +1,53 @@
+package rpc
+
+import (
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Server 将Sync和Fetch请求转发给对应的处理者, 未设置处理者的方法返回Unimplemented
+type Server struct {
+	Syncer  SyncHandler
+	Fetcher FetchHandler
+}
+
+// Register 将服务注册到grpc.Server
+func (s *Server) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+func (s *Server) Sync(stream grpc.ServerStream) error {
+	if s.Syncer == nil {
+		return status.Error(codes.Unimplemented, "sync is not enabled")
+	}
+	for {
+		syncReq := new(resource.SyncRequest)
+		if err := stream.RecvMsg(syncReq); err != nil {
+			return err
+		}
+		credential := server.CredentialFromContext(stream.Context())
+		if clusterID, denied := credential.DeniedCluster(syncReq.Events); denied {
+			return status.Errorf(codes.PermissionDenied, "cluster %q is not allowed for %s", clusterID, credential.Name)
+		}
+		if err := stream.SendMsg(s.Syncer.HandleSyncRequest(syncReq)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) Fetch(request *resource.FetchRequest, stream grpc.ServerStream) error {
+	if s.Fetcher == nil {
+		return status.Error(codes.Unimplemented, "fetch is not enabled")
+	}
+	var remoteAddr string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+	return s.Fetcher.FetchWithStream(stream.Context(), request, remoteAddr, func(data []byte) error {
+		return stream.SendMsg(&Frame{Data: data})
+	})
+}
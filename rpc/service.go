@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName gRPC服务名
+//
+//	Sync:  Agent -> Server 双向流, Agent发送resource.SyncRequest, Server对每条请求回复resource.SyncResponse
+//	       与/push使用相同的CheckPoint语义
+//	Fetch: Server -> Fetcher 单向流, Fetcher发送resource.FetchRequest, Server持续推送resource.SyncRequest
+//	       与/fetch相同, 首条消息为全量数据
+//
+// 消息使用JSON编码, 不依赖protoc生成代码
+const ServiceName = "metadata.MetaSync"
+
+// CodecName 注册到gRPC的编码名, 对应content-type application/grpc+json
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// Frame 已经编码好的消息, 用于多个Fetcher共享同一次序列化的结果
+type Frame struct {
+	Data []byte
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	if frame, ok := v.(*Frame); ok {
+		return frame.Data, nil
+	}
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	if frame, ok := v.(*Frame); ok {
+		frame.Data = append(frame.Data[:0], data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+// SyncHandler 处理Agent推送的同步请求, 由MetaSource实现
+type SyncHandler interface {
+	HandleSyncRequest(syncReq *resource.SyncRequest) *resource.SyncResponse
+}
+
+// FetchHandler 向Fetcher持续推送已编码的resource.SyncRequest, 直到ctx结束或send返回错误, 由FetcherServer实现
+type FetchHandler interface {
+	FetchWithStream(ctx context.Context, request *resource.FetchRequest, remoteAddr string, send func(data []byte) error) error
+}
+
+type metaSyncServer interface {
+	Sync(stream grpc.ServerStream) error
+	Fetch(request *resource.FetchRequest, stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*metaSyncServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Sync",
+			Handler:       syncHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Fetch",
+			Handler:       fetchHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+var (
+	syncStreamDesc  = &serviceDesc.Streams[0]
+	fetchStreamDesc = &serviceDesc.Streams[1]
+)
+
+func syncHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(metaSyncServer).Sync(stream)
+}
+
+func fetchHandler(srv any, stream grpc.ServerStream) error {
+	request := new(resource.FetchRequest)
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+	return srv.(metaSyncServer).Fetch(request, stream)
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/CloudDetail/metadata/model/policy"
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Credential 通过认证的调用方及其权限
+type Credential struct {
+	Name string
+	// 允许访问的路由, 为空时不限制
+	Routes []string
+	// 允许推送的ClusterID, 为空时不限制
+	ClusterIDs []string
+	// 可以查询和获取的数据范围, 为nil时使用服务的默认Policy
+	Policy *policy.Policy
+}
+
+// AllowRoute 未开启认证时credential为nil, 不做限制
+func (c *Credential) AllowRoute(route string) bool {
+	if c == nil || len(c.Routes) == 0 {
+		return true
+	}
+	for _, allowed := range c.Routes {
+		if allowed == route {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowCluster 未开启认证时credential为nil, 不做限制
+func (c *Credential) AllowCluster(clusterID string) bool {
+	if c == nil || len(c.ClusterIDs) == 0 {
+		return true
+	}
+	for _, allowed := range c.ClusterIDs {
+		if allowed == clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+// DeniedCluster 返回events中第一个不允许推送的ClusterID
+func (c *Credential) DeniedCluster(events []*resource.ResourceEvent) (string, bool) {
+	for _, event := range events {
+		if event == nil {
+			// 不完整的事件由处理方跳过
+			continue
+		}
+		if !c.AllowCluster(event.ClusterID) {
+			return event.ClusterID, true
+		}
+	}
+	return "", false
+}
+
+// Authenticator 根据Bearer Token和已校验的客户端证书识别调用方
+// 无法识别时返回ErrUnauthenticated, 可以替换为自定义实现
+type Authenticator interface {
+	Authenticate(token string, peerCerts []*x509.Certificate) (*Credential, error)
+}
+
+// StaticAuthenticator 使用配置文件中的凭证认证
+type StaticAuthenticator struct {
+	credentials []configs.CredentialConfig
+	// 与credentials一一对应, 同一凭证始终返回相同的Policy
+	policies []*policy.Policy
+}
+
+func NewStaticAuthenticator(cfg *configs.AuthConfig) *StaticAuthenticator {
+	a := &StaticAuthenticator{credentials: cfg.Credentials}
+	for _, credential := range cfg.Credentials {
+		a.policies = append(a.policies, NewPolicy(credential.Policy))
+	}
+	return a
+}
+
+func (a *StaticAuthenticator) Authenticate(token string, peerCerts []*x509.Certificate) (*Credential, error) {
+	for i, cfg := range a.credentials {
+		if len(cfg.Token) > 0 && len(token) > 0 &&
+			subtle.ConstantTimeCompare([]byte(cfg.Token), []byte(token)) == 1 {
+			return a.credential(i), nil
+		}
+	}
+	if len(peerCerts) > 0 {
+		commonName := peerCerts[0].Subject.CommonName
+		for i, cfg := range a.credentials {
+			if len(cfg.CommonName) > 0 && cfg.CommonName == commonName {
+				return a.credential(i), nil
+			}
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+func (a *StaticAuthenticator) credential(i int) *Credential {
+	cfg := a.credentials[i]
+	return &Credential{
+		Name:       cfg.Name,
+		Routes:     cfg.Routes,
+		ClusterIDs: cfg.ClusterIDs,
+		Policy:     a.policies[i],
+	}
+}
+
+// NewPolicy cfg为nil时返回nil, 不做限制
+func NewPolicy(cfg *configs.PolicyConfig) *policy.Policy {
+	if cfg == nil {
+		return nil
+	}
+	return policy.New().
+		WithClusters(cfg.ClusterIDs...).
+		WithNamespaces(cfg.Namespaces...).
+		WithStripKeys(cfg.StripKeys...).
+		WithHashKeys(cfg.HashKeys...)
+}
+
+// PolicyOf 返回调用方的Policy, 凭证未单独配置时使用defaultPolicy
+func PolicyOf(credential *Credential, defaultPolicy *policy.Policy) *policy.Policy {
+	if credential != nil && credential.Policy != nil {
+		return credential.Policy
+	}
+	return defaultPolicy
+}
+
+type credentialKey struct{}
+
+// WithCredential 将认证结果传递给路由的处理函数
+func WithCredential(ctx context.Context, credential *Credential) context.Context {
+	return context.WithValue(ctx, credentialKey{}, credential)
+}
+
+// CredentialFromContext 未开启认证时返回nil
+func CredentialFromContext(ctx context.Context) *Credential {
+	credential, _ := ctx.Value(credentialKey{}).(*Credential)
+	return credential
+}
+
+// BearerToken 解析Authorization: Bearer <token>
+func BearerToken(authorization string) string {
+	scheme, token, find := strings.Cut(authorization, " ")
+	if !find || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// SetBearerToken token为空时不设置
+func SetBearerToken(header http.Header, token string) {
+	if len(token) > 0 {
+		header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// authorize 在路由处理前认证调用方并检查路由权限, 并传递调用方的Policy
+func authorize(authenticator Authenticator, defaultPolicy *policy.Policy, route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var peerCerts []*x509.Certificate
+		if r.TLS != nil {
+			peerCerts = r.TLS.PeerCertificates
+		}
+		credential, err := authenticator.Authenticate(BearerToken(r.Header.Get("Authorization")), peerCerts)
+		if err != nil {
+			log.Printf("reject request on [%s] from %s: %v", route, r.RemoteAddr, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !credential.AllowRoute(route) {
+			log.Printf("reject request on [%s] from [%s]: route not allowed", route, credential.Name)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		ctx := WithCredential(r.Context(), credential)
+		ctx = policy.WithPolicy(ctx, PolicyOf(credential, defaultPolicy))
+		handler(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,67 @@
+package server_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	srv := server.NewHTTPServer(":0")
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(server.CredentialFromContext(r.Context()).Name))
+	}
+	srv.RegisterHandler("/push", handler)
+	srv.RegisterHandler("/query", handler)
+	// 注册路由之后再配置认证同样生效
+	srv.WithAuthenticator(server.NewStaticAuthenticator(&configs.AuthConfig{
+		Credentials: []configs.CredentialConfig{
+			{Name: "agent", Token: "agent-token", Routes: []string{"/push"}, ClusterIDs: []string{"cluster-a"}},
+			{Name: "reader", Token: "reader-token", Routes: []string{"/query"}},
+			{Name: "node", CommonName: "node-agent"},
+		},
+	}))
+
+	call := func(path string, token string, cn string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		server.SetBearerToken(req.Header, token)
+		if len(cn) > 0 {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}},
+			}
+		}
+		recorder := httptest.NewRecorder()
+		srv.HandlerMap[path](recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("/push", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/push", "wrong-token", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("/push", "", "unknown").Code)
+	assert.Equal(t, http.StatusForbidden, call("/push", "reader-token", "").Code)
+
+	resp := call("/push", "agent-token", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "agent", resp.Body.String())
+
+	resp = call("/query", "", "node-agent")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "node", resp.Body.String())
+}
+
+func TestCredentialAllowCluster(t *testing.T) {
+	var disabled *server.Credential
+	assert.True(t, disabled.AllowCluster("any"))
+	assert.True(t, disabled.AllowRoute("/push"))
+
+	credential := &server.Credential{Name: "agent", ClusterIDs: []string{"cluster-a"}}
+	assert.True(t, credential.AllowCluster("cluster-a"))
+	assert.False(t, credential.AllowCluster("cluster-b"))
+}
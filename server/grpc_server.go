@@ -0,0 +1,57 @@
+package server
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// GRPCServer 提供gRPC Sync/Fetch服务, 与HTTPServer一同启动和停止
+type GRPCServer struct {
+	listenAddr string
+	Server     *grpc.Server
+}
+
+func NewGRPCServer(listenAddr string, opts ...grpc.ServerOption) *GRPCServer {
+	return &GRPCServer{
+		listenAddr: listenAddr,
+		Server:     grpc.NewServer(opts...),
+	}
+}
+
+func (s *GRPCServer) Start() error {
+	if len(s.Server.GetServiceInfo()) == 0 {
+		log.Printf("no grpc service registered, skip grpc server start")
+		return nil
+	}
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("start a grpc server for metadata transform at %s", s.listenAddr)
+	go func() {
+		if err := s.Server.Serve(listener); err != nil {
+			log.Printf("grpc server stop with error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 等待处理中的流结束, 超过ShutdownTimeout后强制关闭
+// Agent的Sync流不会主动结束, 因此需要限制等待时间
+func (s *GRPCServer) Stop() {
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout):
+		log.Printf("grpc server [%s] is not stopped in %s, force stop", s.listenAddr, ShutdownTimeout)
+		s.Server.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ReadinessCheck 返回nil表示已经可以提供服务, 否则返回未就绪的原因
+type ReadinessCheck func() error
+
+// WithHealthCheck 注册/healthz和/readyz, 供K8s探针使用
+// 探针通常不携带凭证, 因此这两个路由不经过认证
+func (s *HTTPServer) WithHealthCheck(ready ReadinessCheck) *HTTPServer {
+	s.registerPublicHandler("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	s.registerPublicHandler("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	return s
+}
+
+func (s *HTTPServer) registerPublicHandler(path string, handler http.HandlerFunc) {
+	log.Printf("register handler on addr[%s] for [%s]", s.listenAddr, path)
+	s.srvMux.Handle(path, handler)
+	s.HandlerMap[path] = handler
+}
+
+// StatusHandler 以JSON返回status的结果, 用于管理接口
+func StatusHandler(status func() any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status()); err != nil {
+			log.Printf("failed to write status: %v", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var readyErr = errors.New("informers are not synced")
+	srv := server.NewHTTPServer(":0").
+		WithHealthCheck(func() error { return readyErr }).
+		WithAuthenticator(server.NewStaticAuthenticator(&configs.AuthConfig{
+			Credentials: []configs.CredentialConfig{{Name: "admin", Token: "admin-token"}},
+		}))
+	srv.RegisterHandler("/admin/status", server.StatusHandler(func() any {
+		return map[string]bool{"synced": readyErr == nil}
+	}))
+
+	call := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		srv.HandlerMap[path](recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	// 探针不需要认证
+	assert.Equal(t, http.StatusOK, call("/healthz").Code)
+	resp := call("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), "informers are not synced")
+
+	readyErr = nil
+	assert.Equal(t, http.StatusOK, call("/readyz").Code)
+
+	// 管理接口需要认证
+	assert.Equal(t, http.StatusUnauthorized, call("/admin/status").Code)
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/status", nil)
+	server.SetBearerToken(req.Header, "admin-token")
+	srv.HandlerMap["/admin/status"](recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"synced":true}`, recorder.Body.String())
+}
+
+func TestStartHttpServerListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// 端口被占用时返回错误, 而不是只在后台记录日志
+	srv := server.NewHTTPServer(listener.Addr().String()).WithHealthCheck(func() error { return nil })
+	assert.Error(t, srv.StartHttpServer())
+	assert.NoError(t, srv.Stop())
+
+	srv = server.NewHTTPServer("127.0.0.1:0").WithHealthCheck(func() error { return nil })
+	require.NoError(t, srv.StartHttpServer())
+	assert.NoError(t, srv.Stop())
+}
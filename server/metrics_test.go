@@ -0,0 +1,26 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	srv := server.NewHTTPServer(":0").WithMetrics()
+	metrics.SourceEvents.WithLabelValues("pod", "add").Inc()
+	metrics.FetcherConnected.Set(2)
+
+	recorder := httptest.NewRecorder()
+	srv.HandlerMap["/metrics"](recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, `metadata_source_events_total{operation="add",res_type="pod"}`)
+	assert.Contains(t, body, "metadata_fetcher_connected 2")
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -2,8 +2,14 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/policy"
 )
 
 type HTTPServer struct {
@@ -14,6 +20,16 @@ type HTTPServer struct {
 
 	// 用于接入外部的Server
 	HandlerMap map[string]http.HandlerFunc
+
+	// 可选的gRPC服务, 随HTTPServer启动和停止
+	grpcServer *GRPCServer
+
+	// 为nil时使用HTTP
+	tlsConfig *tls.Config
+	// 为nil时不校验调用方
+	authenticator Authenticator
+	// 调用方的凭证未配置Policy时使用, 为nil时不做限制
+	defaultPolicy *policy.Policy
 }
 
 func NewHTTPServer(listenAddr string) *HTTPServer {
@@ -30,11 +46,68 @@ func (s *HTTPServer) SetListenAddr(listenAddr string) {
 
 func (s *HTTPServer) RegisterHandler(path string, handler http.HandlerFunc) {
 	log.Printf("register handler on addr[%s] for [%s]", s.listenAddr, path)
+	handler = s.withAuth(path, handler)
 	s.srvMux.Handle(path, handler)
 	s.HandlerMap[path] = handler
 }
 
+// withAuth 请求时检查是否配置了Authenticator, 不要求在注册路由之前配置
+func (s *HTTPServer) withAuth(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authenticator == nil {
+			if s.defaultPolicy != nil {
+				r = r.WithContext(policy.WithPolicy(r.Context(), s.defaultPolicy))
+			}
+			handler(w, r)
+			return
+		}
+		authorize(s.authenticator, s.defaultPolicy, route, handler)(w, r)
+	}
+}
+
+// WithTLSConfig 使用HTTPS提供服务
+func (s *HTTPServer) WithTLSConfig(tlsConfig *tls.Config) *HTTPServer {
+	s.tlsConfig = tlsConfig
+	return s
+}
+
+// WithAuthenticator 所有路由在处理前认证调用方, 并检查凭证允许访问的路由
+func (s *HTTPServer) WithAuthenticator(authenticator Authenticator) *HTTPServer {
+	s.authenticator = authenticator
+	return s
+}
+
+func (s *HTTPServer) Authenticator() Authenticator {
+	return s.authenticator
+}
+
+// WithDefaultPolicy 限制/query, /fetch, /watch返回的数据, 凭证单独配置的Policy优先
+func (s *HTTPServer) WithDefaultPolicy(p *policy.Policy) *HTTPServer {
+	s.defaultPolicy = p
+	return s
+}
+
+func (s *HTTPServer) DefaultPolicy() *policy.Policy {
+	return s.defaultPolicy
+}
+
+// WithMetrics 在/metrics以Prometheus格式暴露模块的运行指标
+func (s *HTTPServer) WithMetrics() *HTTPServer {
+	s.RegisterHandler("/metrics", metrics.Handler())
+	return s
+}
+
+func (s *HTTPServer) WithGRPCServer(grpcServer *GRPCServer) *HTTPServer {
+	s.grpcServer = grpcServer
+	return s
+}
+
 func (s *HTTPServer) StartHttpServer() error {
+	if s.grpcServer != nil {
+		if err := s.grpcServer.Start(); err != nil {
+			return err
+		}
+	}
 	if len(s.listenAddr) == 0 {
 		log.Printf("listenAddr is empty, skip http server start")
 		return nil
@@ -42,11 +115,30 @@ func (s *HTTPServer) StartHttpServer() error {
 		log.Printf("HandlerMap is empty, skip http server start")
 		return nil
 	}
-	s.server = &http.Server{Handler: s.srvMux}
+	// 同步监听, 端口被占用等错误返回给调用方
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		if s.grpcServer != nil {
+			s.grpcServer.Stop()
+		}
+		return err
+	}
+	srv := &http.Server{
+		Addr:      s.listenAddr,
+		Handler:   s.srvMux,
+		TLSConfig: s.tlsConfig,
+	}
+	s.server = srv
 	log.Printf("start a http server for metadata transform and query at :%s", s.listenAddr)
 
 	go func() {
-		err := http.ListenAndServe(s.listenAddr, s.srvMux)
+		var err error
+		if s.tlsConfig != nil {
+			// 证书已经在TLSConfig中配置
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
 		if err != nil && err != http.ErrServerClosed {
 			log.Printf("fetcher server stop with error: %v", err)
 		}
@@ -54,9 +146,22 @@ func (s *HTTPServer) StartHttpServer() error {
 	return nil
 }
 
+// ShutdownTimeout 停止时等待处理中请求的时间, 超时后强制关闭连接
+const ShutdownTimeout = 10 * time.Second
+
+// Stop 停止接受新的请求, 等待处理中的请求完成后返回
 func (s *HTTPServer) Stop() error {
-	if s.server != nil {
-		return s.server.Shutdown(context.Background())
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("http server [%s] is not stopped in %s, force close: %v", s.listenAddr, ShutdownTimeout, err)
+		return s.server.Close()
 	}
 	return nil
 }
@@ -44,6 +44,8 @@ type APIConfig struct {
 	// from user-defined file
 	AuthType     AuthType `mapstructure:"auth_type"`
 	AuthFilePath string
+	// kubeconfig中使用的context, 为空时使用current-context
+	Context string
 }
 
 // Validate validates the K8s API config
@@ -116,7 +118,7 @@ func createRestConfig(apiConf APIConfig) (*rest.Config, error) {
 			apiConf.AuthFilePath = DefaultKubeConfigPath
 		}
 		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: apiConf.AuthFilePath}
-		configOverrides := &clientcmd.ConfigOverrides{}
+		configOverrides := &clientcmd.ConfigOverrides{CurrentContext: apiConf.Context}
 		authConf, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 			loadingRules, configOverrides).ClientConfig()
 
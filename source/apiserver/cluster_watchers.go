@@ -0,0 +1,129 @@
+package apiserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
+)
+
+// ClusterWatchers 在一个进程中监控多个集群, 每个集群使用独立的Watchers, 共用HttpServer
+type ClusterWatchers struct {
+	Clusters   []*Watchers
+	HttpServer *server.HTTPServer
+	// 各集群共用的Exporter, 全部集群停止后统一停止
+	ExportResource resource.Exporter
+
+	// 成功启动的集群, 用于判断是否就绪
+	runningMux sync.RWMutex
+	running    []*Watchers
+}
+
+func NewClusterWatchers(clusters ...*Watchers) *ClusterWatchers {
+	return &ClusterWatchers{Clusters: clusters}
+}
+
+func (c *ClusterWatchers) WithHttpServer(s *server.HTTPServer) *ClusterWatchers {
+	c.HttpServer = s
+	return c
+}
+
+// WithExporters 各集群共用exporters
+func (c *ClusterWatchers) WithExporters(exporters ...resource.Exporter) *ClusterWatchers {
+	c.ExportResource = &export.Exporter{
+		Exporters: exporters,
+	}
+	for _, watchers := range c.Clusters {
+		watchers.WithExporter(c.ExportResource)
+	}
+	return c
+}
+
+func (c *ClusterWatchers) Handlers() map[string]http.HandlerFunc {
+	if c.HttpServer == nil {
+		return nil
+	}
+	return c.HttpServer.HandlerMap
+}
+
+// Run 启动HttpServer后并行启动各集群, 无法启动的集群记录日志后跳过
+func (c *ClusterWatchers) Run() error {
+	if c.HttpServer != nil {
+		if err := c.HttpServer.StartHttpServer(); err != nil {
+			return err
+		}
+	}
+
+	errs := make([]error, len(c.Clusters))
+	var wg sync.WaitGroup
+	for i, watchers := range c.Clusters {
+		wg.Add(1)
+		go func(i int, watchers *Watchers) {
+			defer wg.Done()
+			errs[i] = watchers.Run()
+		}(i, watchers)
+	}
+	wg.Wait()
+
+	c.runningMux.Lock()
+	defer c.runningMux.Unlock()
+	c.running = c.running[:0]
+	for i, watchers := range c.Clusters {
+		if errs[i] != nil {
+			log.Printf("[%s] failed to watch cluster: %v", watchers.ClusterID, errs[i])
+			continue
+		}
+		c.running = append(c.running, watchers)
+	}
+	if len(c.running) == 0 {
+		return fmt.Errorf("no cluster is watched")
+	}
+	return nil
+}
+
+// Stop 依次停止各集群的Informer, 全部停止后再停止共用的Exporter和HttpServer
+func (c *ClusterWatchers) Stop() error {
+	for _, watchers := range c.Clusters {
+		watchers.stopWatching()
+	}
+	export.StopExporter(c.ExportResource)
+	var err error
+	if c.HttpServer != nil {
+		if stopErr := c.HttpServer.Stop(); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+// Ready 成功启动的集群全部完成首次同步后就绪
+func (c *ClusterWatchers) Ready() error {
+	c.runningMux.RLock()
+	defer c.runningMux.RUnlock()
+	if len(c.running) == 0 {
+		return fmt.Errorf("no cluster is watched")
+	}
+	var notSynced []string
+	for _, watchers := range c.running {
+		if watchers.Ready() != nil {
+			notSynced = append(notSynced, watchers.ClusterID)
+		}
+	}
+	if len(notSynced) > 0 {
+		return fmt.Errorf("informers are not synced for clusters: %s", strings.Join(notSynced, ","))
+	}
+	return nil
+}
+
+func (c *ClusterWatchers) Status() []*WatchersStatus {
+	status := make([]*WatchersStatus, 0, len(c.Clusters))
+	for _, watchers := range c.Clusters {
+		status = append(status, watchers.Status())
+	}
+	return status
+}
@@ -0,0 +1,98 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.CronJobType, func() IWatcher { return &CronJobWatcher{} })
+}
+
+type CronJobWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *CronJobWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.CronJobType]
+}
+
+func (w *CronJobWatcher) Run() {
+	informer := w.factory.Batch().V1().CronJobs().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cronJob, ok := obj.(*batchv1.CronJob); ok {
+				res := createResourceFromCronJob(cronJob)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if cronJob, ok := newObj.(*batchv1.CronJob); ok {
+				res := createResourceFromCronJob(cronJob)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if cronJob, ok := unwrapTombstone(obj).(*batchv1.CronJob); ok {
+				res := createResourceFromCronJob(cronJob)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *CronJobWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *CronJobWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromCronJob(cronJob *batchv1.CronJob) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(cronJob.UID),
+		ResType:    resource.CronJobType,
+		ResVersion: resource.ResVersion(cronJob.ResourceVersion),
+		Name:       cronJob.Name,
+		Relations:  getOwnerRelations(cronJob.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr:   cronJob.Namespace,
+			resource.CronJobSchedule: cronJob.Spec.Schedule,
+		},
+		Int64Attr: map[resource.AttrKey]int64{},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr: cronJob.Labels,
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.DaemonSetType, func() IWatcher { return &DaemonSetWatcher{} })
+}
+
+type DaemonSetWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *DaemonSetWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.DaemonSetType]
+}
+
+func (w *DaemonSetWatcher) Run() {
+	informer := w.factory.Apps().V1().DaemonSets().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ds, ok := obj.(*appsv1.DaemonSet); ok {
+				res := createResourceFromDaemonSet(ds)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if ds, ok := newObj.(*appsv1.DaemonSet); ok {
+				res := createResourceFromDaemonSet(ds)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if ds, ok := unwrapTombstone(obj).(*appsv1.DaemonSet); ok {
+				res := createResourceFromDaemonSet(ds)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *DaemonSetWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *DaemonSetWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromDaemonSet(ds *appsv1.DaemonSet) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(ds.UID),
+		ResType:    resource.DaemonSetType,
+		ResVersion: resource.ResVersion(ds.ResourceVersion),
+		Name:       ds.Name,
+		Relations:  getOwnerRelations(ds.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: ds.Namespace,
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.WorkloadReplicas:          int64(ds.Status.DesiredNumberScheduled),
+			resource.WorkloadReadyReplicas:     int64(ds.Status.NumberReady),
+			resource.WorkloadAvailableReplicas: int64(ds.Status.NumberAvailable),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr:    ds.Labels,
+			resource.WorkloadSelectorsAttr: getMatchLabels(ds.Spec.Selector),
+		},
+	}
+}
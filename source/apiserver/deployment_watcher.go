@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.DeploymentType, func() IWatcher { return &DeploymentWatcher{} })
+}
+
+type DeploymentWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *DeploymentWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.DeploymentType]
+}
+
+func (w *DeploymentWatcher) Run() {
+	informer := w.factory.Apps().V1().Deployments().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				res := createResourceFromDeployment(deployment)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if deployment, ok := newObj.(*appsv1.Deployment); ok {
+				res := createResourceFromDeployment(deployment)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if deployment, ok := unwrapTombstone(obj).(*appsv1.Deployment); ok {
+				res := createResourceFromDeployment(deployment)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *DeploymentWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *DeploymentWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromDeployment(deployment *appsv1.Deployment) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(deployment.UID),
+		ResType:    resource.DeploymentType,
+		ResVersion: resource.ResVersion(deployment.ResourceVersion),
+		Name:       deployment.Name,
+		Relations:  getOwnerRelations(deployment.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: deployment.Namespace,
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.WorkloadReplicas:          getReplicas(deployment.Spec.Replicas),
+			resource.WorkloadReadyReplicas:     int64(deployment.Status.ReadyReplicas),
+			resource.WorkloadAvailableReplicas: int64(deployment.Status.AvailableReplicas),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr:    deployment.Labels,
+			resource.WorkloadSelectorsAttr: getMatchLabels(deployment.Spec.Selector),
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package apiserver
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.EndpointSliceType, func() IWatcher { return &EndpointSliceWatcher{} })
+}
+
+type EndpointSliceWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *EndpointSliceWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.EndpointSliceType]
+}
+
+func (w *EndpointSliceWatcher) Run() {
+	informer := w.factory.Discovery().V1().EndpointSlices().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+				res := createResourceFromEndpointSlice(slice)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if slice, ok := newObj.(*discoveryv1.EndpointSlice); ok {
+				res := createResourceFromEndpointSlice(slice)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if slice, ok := unwrapTombstone(obj).(*discoveryv1.EndpointSlice); ok {
+				res := createResourceFromEndpointSlice(slice)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *EndpointSliceWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *EndpointSliceWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+// createResourceFromEndpointSlice 每个Endpoint的每个地址对应一条R_ENDPOINT关系
+func createResourceFromEndpointSlice(slice *discoveryv1.EndpointSlice) *resource.Resource {
+	relations := make([]resource.Relation, 0, len(slice.Endpoints))
+	for _, endpoint := range slice.Endpoints {
+		var targetUID resource.ResUID
+		var targetKind string
+		if endpoint.TargetRef != nil {
+			targetUID = resource.ResUID(endpoint.TargetRef.UID)
+			targetKind = endpoint.TargetRef.Kind
+		}
+		var nodeName string
+		if endpoint.NodeName != nil {
+			nodeName = *endpoint.NodeName
+		}
+		for _, address := range endpoint.Addresses {
+			relations = append(relations, resource.Relation{
+				ResUID: targetUID,
+				ReType: resource.R_ENDPOINT,
+				StringAttr: map[resource.AttrKey]string{
+					resource.PodIP: address,
+					// ready为空时应视为就绪
+					resource.EndpointReady:       getStringForBoolPtr(endpoint.Conditions.Ready, true),
+					resource.EndpointServing:     getStringForBoolPtr(endpoint.Conditions.Serving, true),
+					resource.EndpointTerminating: getStringForBoolPtr(endpoint.Conditions.Terminating, false),
+					resource.EndpointNodeName:    nodeName,
+					resource.EndpointTargetKind:  targetKind,
+				},
+			})
+		}
+	}
+
+	name2port := make(map[string]string)
+	for _, port := range slice.Ports {
+		if port.Port == nil {
+			continue
+		}
+		var portName string
+		if port.Name != nil {
+			portName = *port.Name
+		}
+		name2port[portName] = strconv.Itoa(int(*port.Port))
+	}
+
+	return &resource.Resource{
+		ResUID:     resource.ResUID(slice.UID),
+		ResType:    resource.EndpointSliceType,
+		ResVersion: resource.ResVersion(slice.ResourceVersion),
+		Name:       slice.Name,
+		Relations:  relations,
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr:            slice.Namespace,
+			resource.EndpointSliceServiceName: slice.Labels[discoveryv1.LabelServiceName],
+		},
+		Int64Attr: map[resource.AttrKey]int64{},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.EndpointSlicePorts: name2port,
+		},
+	}
+}
+
+func getStringForBoolPtr(val *bool, defaultVal bool) string {
+	if val == nil {
+		return strconv.FormatBool(defaultVal)
+	}
+	return strconv.FormatBool(*val)
+}
@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.JobType, func() IWatcher { return &JobWatcher{} })
+}
+
+type JobWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *JobWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.JobType]
+}
+
+func (w *JobWatcher) Run() {
+	informer := w.factory.Batch().V1().Jobs().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if job, ok := obj.(*batchv1.Job); ok {
+				res := createResourceFromJob(job)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if job, ok := newObj.(*batchv1.Job); ok {
+				res := createResourceFromJob(job)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if job, ok := unwrapTombstone(obj).(*batchv1.Job); ok {
+				res := createResourceFromJob(job)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *JobWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *JobWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromJob(job *batchv1.Job) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(job.UID),
+		ResType:    resource.JobType,
+		ResVersion: resource.ResVersion(job.ResourceVersion),
+		Name:       job.Name,
+		Relations:  getOwnerRelations(job.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: job.Namespace,
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.WorkloadReplicas:      getReplicas(job.Spec.Parallelism),
+			resource.WorkloadReadyReplicas: int64(job.Status.Active),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr:    job.Labels,
+			resource.WorkloadSelectorsAttr: getMatchLabels(job.Spec.Selector),
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package apiserver
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubeContext kubeconfig中的一个context, 作为一个独立的集群监控
+type KubeContext struct {
+	// 默认为context名称
+	ClusterID string
+	Config    APIConfig
+}
+
+// LoadKubeContexts 读取kubeconfig文件, 或目录下全部kubeconfig文件中的每个context
+// 多个文件中出现同名context时只使用第一个, 按文件名排序
+func LoadKubeContexts(path string) ([]KubeContext, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+		sort.Strings(files)
+	}
+
+	var contexts []KubeContext
+	seen := map[string]string{}
+	for _, file := range files {
+		kubeConfig, err := clientcmd.LoadFromFile(file)
+		if err != nil {
+			if info.IsDir() {
+				log.Printf("skip invalid kubeconfig %s: %v", file, err)
+				continue
+			}
+			return nil, err
+		}
+		names := make([]string, 0, len(kubeConfig.Contexts))
+		for name := range kubeConfig.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if first, find := seen[name]; find {
+				log.Printf("skip context [%s] in %s, already loaded from %s", name, file, first)
+				continue
+			}
+			seen[name] = file
+			contexts = append(contexts, KubeContext{
+				ClusterID: name,
+				Config: APIConfig{
+					AuthType:     AuthTypeKubeConfig,
+					AuthFilePath: file,
+					Context:      name,
+				},
+			})
+		}
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no context found in %s", path)
+	}
+	return contexts, nil
+}
@@ -0,0 +1,45 @@
+package apiserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKubeConfig(t *testing.T, path string, contexts ...string) {
+	content := "apiVersion: v1\nkind: Config\nclusters:\n- name: c\n  cluster: {server: https://127.0.0.1:6443}\nusers:\n- name: u\n  user: {token: t}\ncontexts:\n"
+	for _, context := range contexts {
+		content += "- name: " + context + "\n  context: {cluster: c, user: u}\n"
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestLoadKubeContexts(t *testing.T) {
+	dir := t.TempDir()
+	writeKubeConfig(t, filepath.Join(dir, "a.yaml"), "cluster-b", "cluster-a")
+	writeKubeConfig(t, filepath.Join(dir, "b.yaml"), "cluster-a", "cluster-c")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte("{"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("{"), 0600))
+
+	contexts, err := LoadKubeContexts(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []KubeContext{
+		{ClusterID: "cluster-a", Config: APIConfig{AuthType: AuthTypeKubeConfig, AuthFilePath: filepath.Join(dir, "a.yaml"), Context: "cluster-a"}},
+		{ClusterID: "cluster-b", Config: APIConfig{AuthType: AuthTypeKubeConfig, AuthFilePath: filepath.Join(dir, "a.yaml"), Context: "cluster-b"}},
+		{ClusterID: "cluster-c", Config: APIConfig{AuthType: AuthTypeKubeConfig, AuthFilePath: filepath.Join(dir, "b.yaml"), Context: "cluster-c"}},
+	}, contexts)
+
+	_, err = LoadKubeContexts(filepath.Join(dir, "invalid.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNewWatchersIsolated(t *testing.T) {
+	a := NewWatchers(APIConfig{}, "cluster-a")
+	b := NewWatchers(APIConfig{}, "cluster-b")
+	assert.NotEmpty(t, a.Watchers)
+	for resType, watcher := range a.Watchers {
+		assert.NotSame(t, watcher, b.Watchers[resType])
+	}
+}
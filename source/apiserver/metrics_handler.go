@@ -0,0 +1,41 @@
+package apiserver
+
+import (
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// eventCounter 统计Informer分发的事件, 作为每种资源的第一个handler
+type eventCounter struct {
+	add    prometheus.Counter
+	update prometheus.Counter
+	delete prometheus.Counter
+	reset  prometheus.Counter
+}
+
+func newEventCounter(resType resource.ResType) *eventCounter {
+	kind := resType.Kind()
+	return &eventCounter{
+		add:    metrics.SourceEvents.WithLabelValues(kind, "add"),
+		update: metrics.SourceEvents.WithLabelValues(kind, "update"),
+		delete: metrics.SourceEvents.WithLabelValues(kind, "delete"),
+		reset:  metrics.SourceEvents.WithLabelValues(kind, "reset"),
+	}
+}
+
+func (c *eventCounter) AddResource(*resource.Resource)    { c.add.Inc() }
+func (c *eventCounter) UpdateResource(*resource.Resource) { c.update.Inc() }
+func (c *eventCounter) DeleteResource(*resource.Resource) { c.delete.Inc() }
+func (c *eventCounter) Reset([]*resource.Resource)        { c.reset.Inc() }
+func (c *eventCounter) SetClusterID(string)               {}
+func (c *eventCounter) SetExporter(resource.Exporter)     {}
+
+// withEventCounters 在每种资源的handler前插入eventCounter, 不修改原handlersMap
+func withEventCounters(handlersMap ResourceHandlersMap) ResourceHandlersMap {
+	counted := make(ResourceHandlersMap, len(handlersMap))
+	for resType, handlers := range handlersMap {
+		counted[resType] = append([]resource.ResHandler{newEventCounter(resType)}, handlers...)
+	}
+	return counted
+}
@@ -0,0 +1,113 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.NamespaceType, func() IWatcher { return &NamespaceWatcher{} })
+}
+
+type NamespaceWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers []resource.ResHandler
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *NamespaceWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.handlers = handlersMap[resource.NamespaceType]
+}
+
+func (w *NamespaceWatcher) Run() {
+	informer := w.factory.Core().V1().Namespaces().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if namespace, ok := obj.(*corev1.Namespace); ok {
+				res := createResourceFromNamespace(namespace)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if namespace, ok := newObj.(*corev1.Namespace); ok {
+				res := createResourceFromNamespace(namespace)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if namespace, ok := unwrapTombstone(obj).(*corev1.Namespace); ok {
+				res := createResourceFromNamespace(namespace)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *NamespaceWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *NamespaceWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromNamespace(namespace *corev1.Namespace) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(namespace.UID),
+		ResType:    resource.NamespaceType,
+		ResVersion: resource.ResVersion(namespace.ResourceVersion),
+		Name:       namespace.Name,
+		Relations:  []resource.Relation{},
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespacePhase: string(namespace.Status.Phase),
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.NamespaceCreationTime: namespace.CreationTimestamp.Unix(),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.NamespaceLabelsAttr:      namespace.Labels,
+			resource.NamespaceAnnotationsAttr: stripLastApplied(namespace.Annotations),
+		},
+	}
+}
+
+// stripLastApplied 去掉kubectl apply记录的完整配置, 避免增大推送和获取的数据
+// 返回副本, 不修改Informer中的对象
+func stripLastApplied(annotations map[string]string) map[string]string {
+	if _, find := annotations[corev1.LastAppliedConfigAnnotation]; !find {
+		return annotations
+	}
+	stripped := make(map[string]string, len(annotations)-1)
+	for key, value := range annotations {
+		if key != corev1.LastAppliedConfigAnnotation {
+			stripped[key] = value
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,26 @@
+package apiserver
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCreateResourceFromNamespaceStripLastApplied(t *testing.T) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "team-a",
+			Annotations: map[string]string{
+				corev1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"Namespace"}`,
+				"owner":                            "team-a",
+			},
+		},
+	}
+	res := createResourceFromNamespace(namespace)
+	assert.Equal(t, map[string]string{"owner": "team-a"}, res.ExtraAttr[resource.NamespaceAnnotationsAttr])
+	// 不修改Informer中的对象
+	assert.Len(t, namespace.Annotations, 2)
+}
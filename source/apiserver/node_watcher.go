@@ -2,6 +2,7 @@ package apiserver
 
 import (
 	"context"
+	"strings"
 
 	"github.com/CloudDetail/metadata/model/resource"
 	corev1 "k8s.io/api/core/v1"
@@ -11,7 +12,7 @@ import (
 )
 
 func init() {
-	addWatcher(resource.NodeType, &NodeWatcher{})
+	addWatcher(resource.NodeType, func() IWatcher { return &NodeWatcher{} })
 }
 
 type NodeWatcher struct {
@@ -21,6 +22,8 @@ type NodeWatcher struct {
 	factory informers.SharedInformerFactory
 
 	handlers []resource.ResHandler
+
+	informer cache.SharedIndexInformer
 }
 
 func (w *NodeWatcher) Init(ctx context.Context, client *kubernetes.Clientset, factory informers.SharedInformerFactory, namespace string, handlersMap ResourceHandlersMap) {
@@ -32,6 +35,7 @@ func (w *NodeWatcher) Init(ctx context.Context, client *kubernetes.Clientset, fa
 
 func (w *NodeWatcher) Run() {
 	informer := w.factory.Core().V1().Nodes().Informer()
+	w.informer = informer
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -51,7 +55,7 @@ func (w *NodeWatcher) Run() {
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			if node, ok := obj.(*corev1.Node); ok {
+			if node, ok := unwrapTombstone(obj).(*corev1.Node); ok {
 				res := createResourceFromNode(node)
 				for _, handler := range w.handlers {
 					handler.DeleteResource(res)
@@ -61,6 +65,14 @@ func (w *NodeWatcher) Run() {
 	})
 }
 
+func (w *NodeWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *NodeWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
 func createResourceFromNode(node *corev1.Node) *resource.Resource {
 	res := &resource.Resource{
 		ResUID:     resource.ResUID(node.UID),
@@ -72,17 +84,30 @@ func createResourceFromNode(node *corev1.Node) *resource.Resource {
 			// resource.NodeInternalIP:
 		},
 		Int64Attr: map[resource.AttrKey]int64{},
-		ExtraAttr: map[resource.AttrKey]map[string]string{},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.NodeLabelsAttr: node.Labels,
+		},
 	}
+	// 双栈时同一类型有多个地址, 单地址属性保留第一个, 全部地址记录在NodeIPs
+	var ips []string
 	for _, address := range node.Status.Addresses {
+		var key resource.AttrKey
 		if address.Type == corev1.NodeInternalIP {
-			res.StringAttr[resource.NodeInternalIP] = address.Address
+			key = resource.NodeInternalIP
+			ips = append(ips, address.Address)
 		} else if address.Type == corev1.NodeExternalIP {
-			res.StringAttr[resource.NodeExternalIP] = address.Address
+			key = resource.NodeExternalIP
+			ips = append(ips, address.Address)
 		} else if address.Type == corev1.NodeHostName {
-			res.StringAttr[resource.NodeHostName] = address.Address
+			key = resource.NodeHostName
+		} else {
+			continue
+		}
+		if _, find := res.StringAttr[key]; !find {
+			res.StringAttr[key] = address.Address
 		}
 	}
+	res.StringAttr[resource.NodeIPs] = strings.Join(ips, ",")
 
 	return res
 }
@@ -0,0 +1,25 @@
+package apiserver
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCreateResourceFromDualStackNode(t *testing.T) {
+	node := &corev1.Node{
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "172.16.0.1"},
+			{Type: corev1.NodeInternalIP, Address: "fd00:16::1"},
+			{Type: corev1.NodeHostName, Address: "node-1"},
+			{Type: corev1.NodeExternalIP, Address: "35.0.0.1"},
+		}},
+	}
+	res := createResourceFromNode(node)
+	assert.Equal(t, "172.16.0.1", res.StringAttr[resource.NodeInternalIP])
+	assert.Equal(t, "35.0.0.1", res.StringAttr[resource.NodeExternalIP])
+	assert.Equal(t, "node-1", res.StringAttr[resource.NodeHostName])
+	assert.Equal(t, "172.16.0.1,fd00:16::1,35.0.0.1", res.StringAttr[resource.NodeIPs])
+}
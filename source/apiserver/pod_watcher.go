@@ -8,13 +8,14 @@ import (
 
 	"github.com/CloudDetail/metadata/model/resource"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
 
 func init() {
-	addWatcher(resource.PodType, &PodWatcher{})
+	addWatcher(resource.PodType, func() IWatcher { return &PodWatcher{} })
 }
 
 type PodWatcher struct {
@@ -24,6 +25,8 @@ type PodWatcher struct {
 
 	handlers  []resource.ResHandler
 	namespace string
+
+	informer cache.SharedIndexInformer
 }
 
 func (w *PodWatcher) Init(
@@ -42,6 +45,7 @@ func (w *PodWatcher) Init(
 
 func (w *PodWatcher) Run() {
 	informer := w.factory.Core().V1().Pods().Informer()
+	w.informer = informer
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			if pod, ok := obj.(*corev1.Pod); ok {
@@ -60,7 +64,7 @@ func (w *PodWatcher) Run() {
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			if pod, ok := obj.(*corev1.Pod); ok {
+			if pod, ok := unwrapTombstone(obj).(*corev1.Pod); ok {
 				podRes := createResourceFromPod(pod)
 				for _, handler := range w.handlers {
 					handler.DeleteResource(podRes)
@@ -70,6 +74,14 @@ func (w *PodWatcher) Run() {
 	})
 }
 
+func (w *PodWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *PodWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
 func createResourceFromPod(pod *corev1.Pod) *resource.Resource {
 	name2port := make(map[string]string)
 	for _, c := range pod.Spec.Containers {
@@ -82,14 +94,16 @@ func createResourceFromPod(pod *corev1.Pod) *resource.Resource {
 		ResType:    resource.PodType,
 		ResVersion: resource.ResVersion(pod.ObjectMeta.ResourceVersion),
 		Name:       pod.Name,
-		Relations:  getOwnerRef(pod),
+		Relations:  append(getOwnerRef(pod), getContainerRelations(pod)...),
 		StringAttr: map[resource.AttrKey]string{
 			resource.NamespaceAttr:    pod.Namespace,
 			resource.ContainerIDsAttr: getContainerIDs(pod),
 			resource.PodIP:            pod.Status.PodIP,
+			resource.PodIPs:           getPodIPs(pod),
 			resource.PodPhase:         string(pod.Status.Phase),
 			resource.PodHostName:      pod.Spec.NodeName,
 			resource.PodHostIP:        pod.Status.HostIP,
+			resource.PodHostPorts:     getHostPorts(pod),
 		},
 		Int64Attr: map[resource.AttrKey]int64{
 			resource.PodHostNetwork: getIntForBoolAttr(pod.Spec.HostNetwork),
@@ -101,6 +115,36 @@ func createResourceFromPod(pod *corev1.Pod) *resource.Resource {
 	}
 }
 
+func getPodIPs(pod *corev1.Pod) string {
+	ips := make([]string, 0, len(pod.Status.PodIPs))
+	for _, podIP := range pod.Status.PodIPs {
+		ips = append(ips, podIP.IP)
+	}
+	return strings.Join(ips, ",")
+}
+
+// getHostPorts 占用节点端口的容器端口, hostNetwork时为全部容器端口
+func getHostPorts(pod *corev1.Pod) string {
+	var ports []string
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			hostPort := p.HostPort
+			if hostPort == 0 && pod.Spec.HostNetwork {
+				hostPort = p.ContainerPort
+			}
+			if hostPort == 0 {
+				continue
+			}
+			protocol := p.Protocol
+			if len(protocol) == 0 {
+				protocol = corev1.ProtocolTCP
+			}
+			ports = append(ports, strconv.Itoa(int(hostPort))+"/"+string(protocol))
+		}
+	}
+	return strings.Join(ports, ",")
+}
+
 func getIntForBoolAttr(val bool) int64 {
 	if val {
 		return 1
@@ -128,13 +172,7 @@ func getContainerIDs(pod *corev1.Pod) string {
 var containerdPrefix = regexp.MustCompile("://(.*)")
 
 func cutContainerId(containerIdStatus string) string {
-	var containerID string
-	containerIDs := containerdPrefix.FindStringSubmatch(containerIdStatus)
-	if len(containerIDs) == 0 {
-		containerID = containerIdStatus
-	} else {
-		containerID = containerIDs[1]
-	}
+	containerID := trimContainerRuntime(containerIdStatus)
 	// containerIdStatus, _ = strings.CutPrefix(containerIdStatus, "containerd://")
 	// containerIdStatus, _ = strings.CutPrefix(containerIdStatus, "docker://")
 	if len(containerID) > 12 {
@@ -143,9 +181,67 @@ func cutContainerId(containerIdStatus string) string {
 	return containerID
 }
 
+// trimContainerRuntime 去掉容器ID的运行时前缀, 返回完整的容器ID
+func trimContainerRuntime(containerIdStatus string) string {
+	containerIDs := containerdPrefix.FindStringSubmatch(containerIdStatus)
+	if len(containerIDs) == 0 {
+		return containerIdStatus
+	}
+	return containerIDs[1]
+}
+
+// getContainerRelations 每个已创建的容器(包括init和ephemeral容器)对应一条R_CONTAINER关系
+func getContainerRelations(pod *corev1.Pod) []resource.Relation {
+	var relations []resource.Relation
+	appendStatuses := func(containerType string, statuses []corev1.ContainerStatus) {
+		for _, status := range statuses {
+			if len(status.ContainerID) == 0 {
+				continue
+			}
+			relations = append(relations, createContainerRelation(containerType, &status))
+		}
+	}
+	appendStatuses("init", pod.Status.InitContainerStatuses)
+	appendStatuses("container", pod.Status.ContainerStatuses)
+	appendStatuses("ephemeral", pod.Status.EphemeralContainerStatuses)
+	return relations
+}
+
+func createContainerRelation(containerType string, status *corev1.ContainerStatus) resource.Relation {
+	var state, reason string
+	switch {
+	case status.State.Running != nil:
+		state = "running"
+	case status.State.Terminated != nil:
+		state = "terminated"
+		reason = status.State.Terminated.Reason
+	case status.State.Waiting != nil:
+		state = "waiting"
+		reason = status.State.Waiting.Reason
+	}
+	return resource.Relation{
+		ResUID: resource.ResUID(trimContainerRuntime(status.ContainerID)),
+		ReType: resource.R_CONTAINER,
+		StringAttr: map[resource.AttrKey]string{
+			resource.ContainerName:         status.Name,
+			resource.ContainerImage:        status.Image,
+			resource.ContainerImageID:      status.ImageID,
+			resource.ContainerType:         containerType,
+			resource.ContainerRestartCount: strconv.Itoa(int(status.RestartCount)),
+			resource.ContainerReady:        strconv.FormatBool(status.Ready),
+			resource.ContainerState:        state,
+			resource.ContainerStateReason:  reason,
+		},
+	}
+}
+
 func getOwnerRef(pod *corev1.Pod) []resource.Relation {
-	var ownerRef []resource.Relation = make([]resource.Relation, 0, len(pod.OwnerReferences))
-	for _, owner := range pod.OwnerReferences {
+	return getOwnerRelations(pod.OwnerReferences)
+}
+
+func getOwnerRelations(owners []metav1.OwnerReference) []resource.Relation {
+	var ownerRef []resource.Relation = make([]resource.Relation, 0, len(owners))
+	for _, owner := range owners {
 		var relation = resource.Relation{
 			ResUID: resource.ResUID(owner.UID),
 			ReType: resource.R_OWNER,
@@ -158,3 +254,18 @@ func getOwnerRef(pod *corev1.Pod) []resource.Relation {
 	}
 	return ownerRef
 }
+
+func getReplicas(replicas *int32) int64 {
+	if replicas == nil {
+		// 未设置时K8s默认为1
+		return 1
+	}
+	return int64(*replicas)
+}
+
+func getMatchLabels(selector *metav1.LabelSelector) map[string]string {
+	if selector == nil {
+		return nil
+	}
+	return selector.MatchLabels
+}
@@ -1,6 +1,12 @@
 package apiserver
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
 
 func Test_cutContainerId(t *testing.T) {
 	type args struct {
@@ -41,3 +47,52 @@ func Test_cutContainerId(t *testing.T) {
 		})
 	}
 }
+
+func TestGetContainerRelations(t *testing.T) {
+	pod := testPod("pod-1", "10.0.0.1")
+	pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:        "init-db",
+		ContainerID: "containerd://be17c1ed0a0b385a5d7735dc7bbd989662cbe820f6ec6ead7c3458cafb3309cc",
+		State:       corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}},
+	}}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:         "web",
+		ContainerID:  "containerd://286b025a9464cb948a3f388df8a6700895fab34ff01d4770d308c6ae00508c8d",
+		Image:        "web:v1",
+		RestartCount: 2,
+		Ready:        true,
+		State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}, {
+		// 尚未创建的容器没有ID
+		Name:  "sidecar",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+	}}
+
+	relations := getContainerRelations(pod)
+	assert.Len(t, relations, 2)
+	assert.Equal(t, resource.ResUID("be17c1ed0a0b385a5d7735dc7bbd989662cbe820f6ec6ead7c3458cafb3309cc"), relations[0].ResUID)
+	assert.Equal(t, "init", relations[0].StringAttr[resource.ContainerType])
+	assert.Equal(t, "terminated", relations[0].StringAttr[resource.ContainerState])
+	assert.Equal(t, "Completed", relations[0].StringAttr[resource.ContainerStateReason])
+	assert.Equal(t, resource.R_CONTAINER, relations[1].ReType)
+	assert.Equal(t, "web", relations[1].StringAttr[resource.ContainerName])
+	assert.Equal(t, "2", relations[1].StringAttr[resource.ContainerRestartCount])
+	assert.Equal(t, "true", relations[1].StringAttr[resource.ContainerReady])
+	assert.Equal(t, "running", relations[1].StringAttr[resource.ContainerState])
+}
+
+func TestGetHostPorts(t *testing.T) {
+	pod := &corev1.Pod{}
+	pod.Spec.Containers = []corev1.Container{{
+		Name: "web",
+		Ports: []corev1.ContainerPort{
+			{ContainerPort: 8080},
+			{ContainerPort: 8443, HostPort: 443},
+			{ContainerPort: 53, HostPort: 53, Protocol: corev1.ProtocolUDP},
+		},
+	}}
+	assert.Equal(t, "443/TCP,53/UDP", getHostPorts(pod))
+
+	pod.Spec.HostNetwork = true
+	assert.Equal(t, "8080/TCP,443/TCP,53/UDP", getHostPorts(pod))
+}
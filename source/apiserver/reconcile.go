@@ -0,0 +1,99 @@
+package apiserver
+
+import (
+	"log"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+const DefaultReconcileInterval = 5 * time.Minute
+
+// keepReconcile 定期对比各Resources.ResList和Informer缓存
+// 补发因Watch中断而丢失的Delete事件
+func (w *Watchers) keepReconcile() {
+	interval := w.ReconcileInterval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			for resType, watchers := range w.startedWatcher {
+				stores := make([]cache.Store, 0, len(watchers))
+				for _, watcher := range watchers {
+					stores = append(stores, watcher.Store())
+				}
+				w.reconcile(resType, stores...)
+			}
+		}
+	}
+}
+
+// reconcile 监控多个Namespace时stores为各Namespace的Informer缓存
+func (w *Watchers) reconcile(resType resource.ResType, stores ...cache.Store) {
+	if len(stores) == 0 {
+		return
+	}
+	for _, store := range stores {
+		if store == nil {
+			return
+		}
+	}
+	handlers := w.HandlerMap[resType]
+
+	// 先获取ResList快照再获取Informer缓存
+	// Informer总是先更新缓存再分发事件, 因此快照中存在而缓存中不存在的资源一定已经被删除
+	var cachedRes []*resource.Resource
+	for _, handler := range handlers {
+		if ref, ok := handler.(interface{ ResourcesRef() *resource.Resources }); ok {
+			resources := ref.ResourcesRef()
+			if resources.ResType == resType {
+				cachedRes = append(cachedRes, resources.Snapshot()...)
+			}
+		}
+		// EndpointSlice等由其他资源的handler缓存, 不在ResList中
+		if ref, ok := handler.(interface {
+			CachedResources(resource.ResType) []*resource.Resource
+		}); ok {
+			cachedRes = append(cachedRes, ref.CachedResources(resType)...)
+		}
+	}
+	if len(cachedRes) == 0 {
+		return
+	}
+
+	existed := make(map[resource.ResUID]struct{})
+	for _, store := range stores {
+		for _, obj := range store.List() {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				continue
+			}
+			existed[resource.ResUID(accessor.GetUID())] = struct{}{}
+		}
+	}
+
+	missed := make(map[resource.ResUID]*resource.Resource)
+	for _, res := range cachedRes {
+		if _, find := existed[res.ResUID]; !find {
+			missed[res.ResUID] = res
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	log.Printf("[%s] reconcile (%d): found %d resources missing in informer, send delete event", w.ClusterID, resType, len(missed))
+	for _, res := range missed {
+		for _, handler := range handlers {
+			handler.DeleteResource(res)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/export"
+	modelcache "github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func testPod(uid string, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID(uid),
+			Name:      uid,
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			PodIP: ip,
+			Phase: corev1.PodRunning,
+		},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	podList := modelcache.NewPodList(resource.PodType, nil).(*modelcache.PodList)
+	podList.SetExporter(export.NonExporter)
+
+	alive := testPod("alive", "10.0.0.1")
+	lost := testPod("lost", "10.0.0.2")
+	podList.AddResource(createResourceFromPod(alive))
+	podList.AddResource(createResourceFromPod(lost))
+
+	// lost 的删除事件在Watch中断期间丢失
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, store.Add(alive))
+
+	w := &Watchers{
+		HandlerMap: ResourceHandlersMap{resource.PodType: {podList}},
+	}
+	w.reconcile(resource.PodType, store)
+
+	_, find := podList.Index().IP2PodMap.Load("10.0.0.2")
+	assert.False(t, find)
+	_, find = podList.Index().IP2PodMap.Load("10.0.0.1")
+	assert.True(t, find)
+	assert.Len(t, podList.ResList, 1)
+}
+
+func testEndpointSlice(uid string, ip string) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID(uid),
+			Name:      uid,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "web"},
+		},
+		Endpoints: []discoveryv1.Endpoint{{Addresses: []string{ip}}},
+	}
+}
+
+func TestReconcileEndpointSlice(t *testing.T) {
+	serviceList := modelcache.NewServiceList(resource.ServiceType, nil).(*modelcache.ServiceList)
+	serviceList.SetExporter(export.NonExporter)
+	serviceList.EnableEndpointSliceMatch()
+
+	alive := testEndpointSlice("alive", "172.16.0.1")
+	lost := testEndpointSlice("lost", "172.16.0.2")
+	serviceList.AddResource(createResourceFromEndpointSlice(alive))
+	serviceList.AddResource(createResourceFromEndpointSlice(lost))
+	serviceList.AddResource(&resource.Resource{
+		ResUID:     "svc-uid",
+		ResType:    resource.ServiceType,
+		Name:       "web",
+		StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: "default"},
+		Int64Attr:  map[resource.AttrKey]int64{},
+		ExtraAttr:  map[resource.AttrKey]map[string]string{},
+	})
+
+	// lost 的删除事件在Watch中断期间丢失
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, store.Add(alive))
+
+	w := &Watchers{
+		HandlerMap: ResourceHandlersMap{resource.EndpointSliceType: {serviceList}},
+	}
+	w.reconcile(resource.EndpointSliceType, store)
+
+	serviceRef, find := serviceList.Index().ServiceMap.Load("default/web")
+	assert.True(t, find)
+	assert.Equal(t, []string{"172.16.0.1"}, serviceRef.(*modelcache.Service).EndPoints())
+	assert.Len(t, serviceList.CachedResources(resource.EndpointSliceType), 1)
+}
+
+func TestUnwrapTombstone(t *testing.T) {
+	pod := testPod("deleted", "10.0.0.3")
+	obj := unwrapTombstone(cache.DeletedFinalStateUnknown{Key: "default/deleted", Obj: pod})
+	assert.Equal(t, pod, obj)
+	assert.Equal(t, pod, unwrapTombstone(pod))
+}
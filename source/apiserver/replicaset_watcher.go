@@ -0,0 +1,102 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.ReplicaSetType, func() IWatcher { return &ReplicaSetWatcher{} })
+}
+
+type ReplicaSetWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *ReplicaSetWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.ReplicaSetType]
+}
+
+func (w *ReplicaSetWatcher) Run() {
+	informer := w.factory.Apps().V1().ReplicaSets().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if rs, ok := obj.(*appsv1.ReplicaSet); ok {
+				res := createResourceFromReplicaSet(rs)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if rs, ok := newObj.(*appsv1.ReplicaSet); ok {
+				res := createResourceFromReplicaSet(rs)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if rs, ok := unwrapTombstone(obj).(*appsv1.ReplicaSet); ok {
+				res := createResourceFromReplicaSet(rs)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *ReplicaSetWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *ReplicaSetWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromReplicaSet(rs *appsv1.ReplicaSet) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(rs.UID),
+		ResType:    resource.ReplicaSetType,
+		ResVersion: resource.ResVersion(rs.ResourceVersion),
+		Name:       rs.Name,
+		Relations:  getOwnerRelations(rs.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: rs.Namespace,
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.WorkloadReplicas:          getReplicas(rs.Spec.Replicas),
+			resource.WorkloadReadyReplicas:     int64(rs.Status.ReadyReplicas),
+			resource.WorkloadAvailableReplicas: int64(rs.Status.AvailableReplicas),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr:    rs.Labels,
+			resource.WorkloadSelectorsAttr: getMatchLabels(rs.Spec.Selector),
+		},
+	}
+}
@@ -3,6 +3,7 @@ package apiserver
 import (
 	"context"
 	"strconv"
+	"strings"
 
 	"github.com/CloudDetail/metadata/model/resource"
 	corev1 "k8s.io/api/core/v1"
@@ -12,7 +13,7 @@ import (
 )
 
 func init() {
-	addWatcher(resource.ServiceType, &ServiceWatcher{})
+	addWatcher(resource.ServiceType, func() IWatcher { return &ServiceWatcher{} })
 }
 
 type ServiceWatcher struct {
@@ -22,6 +23,8 @@ type ServiceWatcher struct {
 
 	handlers  []resource.ResHandler
 	namespace string
+
+	informer cache.SharedIndexInformer
 }
 
 func (w *ServiceWatcher) Init(
@@ -40,6 +43,7 @@ func (w *ServiceWatcher) Init(
 
 func (w *ServiceWatcher) Run() {
 	informer := w.factory.Core().V1().Services().Informer()
+	w.informer = informer
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -59,7 +63,7 @@ func (w *ServiceWatcher) Run() {
 			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			if service, ok := obj.(*corev1.Service); ok {
+			if service, ok := unwrapTombstone(obj).(*corev1.Service); ok {
 				serviceRes := w.createResourceFromService(service)
 				for _, handler := range w.handlers {
 					handler.DeleteResource(serviceRes)
@@ -69,10 +73,36 @@ func (w *ServiceWatcher) Run() {
 	})
 }
 
+func (w *ServiceWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *ServiceWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
 func (*ServiceWatcher) createResourceFromService(eService *corev1.Service) *resource.Resource {
 	svc2target := make(map[string]string)
+	port2name := make(map[string]string)
+	nodePorts := make(map[string]string)
+	protocols := make(map[string]string)
 	for _, port := range eService.Spec.Ports {
-		svc2target[strconv.Itoa(int(port.Port))] = port.TargetPort.String()
+		svcPort := strconv.Itoa(int(port.Port))
+		svc2target[svcPort] = port.TargetPort.String()
+		if len(port.Name) > 0 {
+			port2name[svcPort] = port.Name
+		}
+		if port.NodePort > 0 {
+			nodePorts[strconv.Itoa(int(port.NodePort))] = svcPort
+		}
+		if len(port.Protocol) > 0 {
+			// 同一端口可以同时使用TCP和UDP, 如DNS
+			if existed, find := protocols[svcPort]; find {
+				protocols[svcPort] = existed + "," + string(port.Protocol)
+			} else {
+				protocols[svcPort] = string(port.Protocol)
+			}
+		}
 	}
 
 	res := &resource.Resource{
@@ -82,14 +112,31 @@ func (*ServiceWatcher) createResourceFromService(eService *corev1.Service) *reso
 		Name:       eService.Name,
 		Relations:  []resource.Relation{},
 		StringAttr: map[resource.AttrKey]string{
-			resource.NamespaceAttr: eService.Namespace,
-			resource.ServiceIP:     eService.Spec.ClusterIP,
+			resource.NamespaceAttr:      eService.Namespace,
+			resource.ServiceIP:          eService.Spec.ClusterIP,
+			resource.ServiceIPs:         strings.Join(eService.Spec.ClusterIPs, ","),
+			resource.ServiceExternalIPs: getServiceExternalIPs(eService),
 		},
 		Int64Attr: map[resource.AttrKey]int64{},
 		ExtraAttr: map[resource.AttrKey]map[string]string{
 			resource.ServiceSelectorsAttr:     eService.Spec.Selector,
 			resource.ServicePorts2TargetPorts: svc2target,
+			resource.ServicePortNames:         port2name,
+			resource.ServiceLabelsAttr:        eService.Labels,
+			resource.ServiceNodePorts:         nodePorts,
+			resource.ServicePortProtocols:     protocols,
 		},
 	}
 	return res
 }
+
+// getServiceExternalIPs spec.externalIPs和LoadBalancer分配的IP
+func getServiceExternalIPs(eService *corev1.Service) string {
+	ips := append([]string{}, eService.Spec.ExternalIPs...)
+	for _, ingress := range eService.Status.LoadBalancer.Ingress {
+		if len(ingress.IP) > 0 {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return strings.Join(ips, ",")
+}
@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"context"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	addWatcher(resource.StatefulSetType, func() IWatcher { return &StatefulSetWatcher{} })
+}
+
+type StatefulSetWatcher struct {
+	ctx     context.Context
+	client  *kubernetes.Clientset
+	factory informers.SharedInformerFactory
+
+	handlers  []resource.ResHandler
+	namespace string
+
+	informer cache.SharedIndexInformer
+}
+
+func (w *StatefulSetWatcher) Init(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	factory informers.SharedInformerFactory,
+	namespace string,
+	handlersMap ResourceHandlersMap,
+) {
+	w.ctx = ctx
+	w.client = client
+	w.factory = factory
+	w.namespace = namespace
+	w.handlers = handlersMap[resource.StatefulSetType]
+}
+
+func (w *StatefulSetWatcher) Run() {
+	informer := w.factory.Apps().V1().StatefulSets().Informer()
+	w.informer = informer
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if sts, ok := obj.(*appsv1.StatefulSet); ok {
+				res := createResourceFromStatefulSet(sts)
+				for _, handler := range w.handlers {
+					handler.AddResource(res)
+				}
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			if sts, ok := newObj.(*appsv1.StatefulSet); ok {
+				res := createResourceFromStatefulSet(sts)
+				for _, handler := range w.handlers {
+					handler.UpdateResource(res)
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if sts, ok := unwrapTombstone(obj).(*appsv1.StatefulSet); ok {
+				res := createResourceFromStatefulSet(sts)
+				for _, handler := range w.handlers {
+					handler.DeleteResource(res)
+				}
+			}
+		},
+	})
+}
+
+func (w *StatefulSetWatcher) Store() cache.Store {
+	return w.informer.GetStore()
+}
+
+func (w *StatefulSetWatcher) Informer() cache.SharedIndexInformer {
+	return w.informer
+}
+
+func createResourceFromStatefulSet(sts *appsv1.StatefulSet) *resource.Resource {
+	return &resource.Resource{
+		ResUID:     resource.ResUID(sts.UID),
+		ResType:    resource.StatefulSetType,
+		ResVersion: resource.ResVersion(sts.ResourceVersion),
+		Name:       sts.Name,
+		Relations:  getOwnerRelations(sts.OwnerReferences),
+		StringAttr: map[resource.AttrKey]string{
+			resource.NamespaceAttr: sts.Namespace,
+		},
+		Int64Attr: map[resource.AttrKey]int64{
+			resource.WorkloadReplicas:      getReplicas(sts.Spec.Replicas),
+			resource.WorkloadReadyReplicas: int64(sts.Status.ReadyReplicas),
+		},
+		ExtraAttr: map[resource.AttrKey]map[string]string{
+			resource.WorkloadLabelsAttr:    sts.Labels,
+			resource.WorkloadSelectorsAttr: getMatchLabels(sts.Spec.Selector),
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package apiserver
+
+import (
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// WatchersStatus 用于管理接口展示K8s数据源的状态
+type WatchersStatus struct {
+	ClusterID string `json:"cluster_id"`
+	Synced    bool   `json:"synced"`
+	// 资源类型名 -> 资源数量
+	Resources map[string]int          `json:"resources"`
+	Exporters []export.ExporterStatus `json:"exporters"`
+}
+
+func (w *Watchers) Status() *WatchersStatus {
+	status := &WatchersStatus{
+		ClusterID: w.ClusterID,
+		Synced:    w.synced.Load(),
+		Resources: map[string]int{},
+		Exporters: export.StatusOf(w.ExportResource),
+	}
+	for resType, handlers := range w.HandlerMap {
+		for _, handler := range handlers {
+			// 同一类型可能注册了多个handler, 只统计保存该类型资源的handler
+			ref, ok := handler.(interface{ ResourcesRef() *resource.Resources })
+			if ok && ref.ResourcesRef().ResType == resType {
+				status.Resources[resType.Kind()] = ref.ResourcesRef().Len()
+				break
+			}
+		}
+	}
+	return status
+}
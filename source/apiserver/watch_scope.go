@@ -0,0 +1,182 @@
+package apiserver
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const informerResyncPeriod = 10 * time.Minute
+
+// clusterScopedTypes 集群级资源, 不受Watchers.Namespaces限制
+var clusterScopedTypes = map[resource.ResType]bool{
+	resource.NodeType:      true,
+	resource.NamespaceType: true,
+}
+
+// Selector 对一种资源的List/Watch请求附加的过滤条件, 格式与kubectl的-l/--field-selector相同
+type Selector struct {
+	LabelSelector string
+	FieldSelector string
+}
+
+func (s Selector) validate() error {
+	if _, err := labels.Parse(s.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", s.LabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(s.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field selector %q: %w", s.FieldSelector, err)
+	}
+	return nil
+}
+
+// watchScope Namespace和Selector相同的资源类型共用一个InformerFactory
+type watchScope struct {
+	namespace string
+	selector  Selector
+}
+
+func (s watchScope) options() []informers.SharedInformerOption {
+	var options []informers.SharedInformerOption
+	if s.namespace != metav1.NamespaceAll {
+		options = append(options, informers.WithNamespace(s.namespace))
+	}
+	if s.selector != (Selector{}) {
+		selector := s.selector
+		options = append(options, informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector.LabelSelector
+			opts.FieldSelector = selector.FieldSelector
+		}))
+	}
+	return options
+}
+
+func (w *Watchers) validateSelectors() error {
+	for resType, selector := range w.Selectors {
+		if err := selector.validate(); err != nil {
+			return fmt.Errorf("%s: %w", resType.Kind(), err)
+		}
+	}
+	return nil
+}
+
+// namespacesOf 资源类型需要监控的Namespace, NamespaceAll表示全部Namespace
+func (w *Watchers) namespacesOf(resType resource.ResType) []string {
+	if clusterScopedTypes[resType] || len(w.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return w.Namespaces
+}
+
+// startWatchers 为每个注册了handler的资源类型和Namespace启动一个IWatcher
+// 返回需要启动的InformerFactory
+func (w *Watchers) startWatchers(clientSet *kubernetes.Clientset, handlersMap ResourceHandlersMap) []*informerFactory {
+	factories := map[watchScope]*informerFactory{}
+	w.startedWatcher = map[resource.ResType][]IWatcher{}
+	for resType := range w.HandlerMap {
+		watcher, find := w.Watchers[resType]
+		if !find || w.isUpstreamType(resType) {
+			continue
+		}
+		for i, namespace := range w.namespacesOf(resType) {
+			if i > 0 {
+				// 每个Namespace使用独立的Informer
+				newWatcher, find := watcherFactories[resType]
+				if !find {
+					log.Printf("[%s] %s can only watch one namespace, ignore namespace %s", w.ClusterID, resType.Kind(), namespace)
+					break
+				}
+				watcher = newWatcher()
+			}
+			scope := watchScope{namespace: namespace, selector: w.Selectors[resType]}
+			factory, find := factories[scope]
+			if !find {
+				factory = &informerFactory{
+					factory:   informers.NewSharedInformerFactoryWithOptions(clientSet, informerResyncPeriod, scope.options()...),
+					informers: map[resource.ResType]cache.SharedIndexInformer{},
+				}
+				factories[scope] = factory
+			}
+			watcher.Init(w.ctx, clientSet, factory.factory, namespace, handlersMap)
+			watcher.Run()
+			factory.informers[resType] = watcher.Informer()
+			w.startedWatcher[resType] = append(w.startedWatcher[resType], watcher)
+		}
+	}
+
+	result := make([]*informerFactory, 0, len(factories))
+	for _, factory := range factories {
+		result = append(result, factory)
+	}
+	return result
+}
+
+// informerFactory client-go v0.22的SharedInformerFactory没有Shutdown, 无法等待Start启动的Informer退出
+// 因此不调用factory.Start, 由informerFactory启动各IWatcher的Informer
+type informerFactory struct {
+	factory   informers.SharedInformerFactory
+	informers map[resource.ResType]cache.SharedIndexInformer
+	wg        sync.WaitGroup
+}
+
+func (f *informerFactory) start(stopCh <-chan struct{}) {
+	for _, informer := range f.informers {
+		f.wg.Add(1)
+		go func(informer cache.SharedIndexInformer) {
+			defer f.wg.Done()
+			informer.Run(stopCh)
+		}(informer)
+	}
+}
+
+// waitForCacheSync 返回第一个未完成同步的资源类型
+func (f *informerFactory) waitForCacheSync(stopCh <-chan struct{}) (resource.ResType, bool) {
+	for resType, informer := range f.informers {
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			return resType, false
+		}
+	}
+	return 0, true
+}
+
+// Shutdown 等待start启动的Informer全部退出, 调用前需要关闭stopCh
+func (f *informerFactory) Shutdown() {
+	f.wg.Wait()
+}
+
+func (w *Watchers) isUpstreamType(resType resource.ResType) bool {
+	if w.Upstream == nil {
+		return false
+	}
+	for _, upstreamType := range w.Upstream.ResTypes() {
+		if upstreamType == resType {
+			return true
+		}
+	}
+	return false
+}
+
+// startUpstream 从上游获取的资源同样计入SourceEvents指标
+// 只获取本集群的资源, 上游需要使用相同的ClusterID
+func (w *Watchers) startUpstream() {
+	if w.Upstream == nil {
+		return
+	}
+	handlersMap := withEventCounters(w.HandlerMap)
+	forward := map[resource.ResType][]resource.ResHandler{}
+	for resType, handlers := range handlersMap {
+		if w.isUpstreamType(resType) {
+			forward[resType] = handlers
+		}
+	}
+	w.Upstream.WithClusterID(w.ClusterID).ForwardTo(forward).Start()
+}
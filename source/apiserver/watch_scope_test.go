@@ -0,0 +1,110 @@
+package apiserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/client"
+	"github.com/CloudDetail/metadata/export"
+	modelcache "github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNamespacesOf(t *testing.T) {
+	w := NewWatchers(APIConfig{}, "")
+	assert.Equal(t, []string{metav1.NamespaceAll}, w.namespacesOf(resource.PodType))
+
+	w.WithNamespaces("team-a", "team-b")
+	assert.Equal(t, []string{"team-a", "team-b"}, w.namespacesOf(resource.PodType))
+	assert.Equal(t, []string{metav1.NamespaceAll}, w.namespacesOf(resource.NodeType))
+	assert.Equal(t, []string{metav1.NamespaceAll}, w.namespacesOf(resource.NamespaceType))
+}
+
+func TestValidateSelectors(t *testing.T) {
+	w := NewWatchers(APIConfig{}, "").
+		WithSelector(resource.PodType, Selector{LabelSelector: "app in (web,api)", FieldSelector: "spec.nodeName=node-1"})
+	assert.NoError(t, w.validateSelectors())
+
+	w.WithSelector(resource.NodeType, Selector{FieldSelector: "metadata.name in (a)"})
+	assert.Error(t, w.validateSelectors())
+
+	w.WithSelector(resource.NodeType, Selector{LabelSelector: "app in ("})
+	assert.Error(t, w.validateSelectors())
+}
+
+func TestReconcileNamespaces(t *testing.T) {
+	podList := modelcache.NewPodList(resource.PodType, nil).(*modelcache.PodList)
+	podList.SetExporter(export.NonExporter)
+
+	teamA := testPod("team-a", "10.0.0.1")
+	teamB := testPod("team-b", "10.0.0.2")
+	teamB.Namespace = "team-b"
+	podList.AddResource(createResourceFromPod(teamA))
+	podList.AddResource(createResourceFromPod(teamB))
+
+	storeA := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, storeA.Add(teamA))
+	storeB := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	assert.NoError(t, storeB.Add(teamB))
+
+	w := &Watchers{
+		HandlerMap: ResourceHandlersMap{resource.PodType: {podList}},
+	}
+	// 资源分布在多个Namespace的Informer中, 不能误删
+	w.reconcile(resource.PodType, storeA, storeB)
+	assert.Len(t, podList.ResList, 2)
+
+	w.reconcile(resource.PodType, storeA)
+	assert.Len(t, podList.ResList, 1)
+}
+
+func TestStartWatchers(t *testing.T) {
+	clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:1"})
+	assert.NoError(t, err)
+
+	w := NewWatchers(APIConfig{}, "").
+		WithNamespaces("team-a", "team-b").
+		WithSelector(resource.PodType, Selector{FieldSelector: "spec.nodeName=node-1"}).
+		WithUpstream(client.NewClient("127.0.0.1:1", resource.ServiceType, resource.NodeType)).
+		WithHandler(resource.PodType, modelcache.NewPodList(resource.PodType, nil)).
+		WithHandler(resource.ServiceType, modelcache.NewServiceList(resource.ServiceType, nil)).
+		WithHandler(resource.NodeType, modelcache.NewNodeList(resource.NodeType, nil))
+	w.ctx = context.Background()
+
+	factories := w.startWatchers(clientSet, w.HandlerMap)
+	// Service和Node从上游获取, Pod在每个Namespace各启动一个Informer
+	assert.Len(t, factories, 2)
+	assert.Len(t, w.startedWatcher, 1)
+	assert.Len(t, w.startedWatcher[resource.PodType], 2)
+	assert.NotSame(t, w.startedWatcher[resource.PodType][0], w.startedWatcher[resource.PodType][1])
+}
+
+func TestStopWaitsForInformers(t *testing.T) {
+	clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:1"})
+	assert.NoError(t, err)
+
+	w := NewWatchers(APIConfig{}, "").
+		WithHandler(resource.PodType, modelcache.NewPodList(resource.PodType, nil))
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.factories = w.startWatchers(clientSet, w.HandlerMap)
+	for _, factory := range w.factories {
+		factory.start(w.ctx.Done())
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		w.stopWatching()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("informers are still running after stop")
+	}
+}
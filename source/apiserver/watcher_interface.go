@@ -5,6 +5,7 @@ import (
 
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
 type IWatcher interface {
@@ -16,4 +17,17 @@ type IWatcher interface {
 		handlersMap ResourceHandlersMap,
 	)
 	Run()
+
+	// Store 返回Informer的本地缓存, 用于定期对账
+	Store() cache.Store
+	// Informer Run之后返回注册到factory的Informer, 由Watchers启动并等待退出
+	Informer() cache.SharedIndexInformer
+}
+
+// unwrapTombstone 在Watch断开期间删除的对象会以DeletedFinalStateUnknown的形式传入DeleteFunc
+func unwrapTombstone(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
 }
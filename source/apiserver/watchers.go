@@ -2,22 +2,51 @@ package apiserver
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/CloudDetail/metadata/client"
 	"github.com/CloudDetail/metadata/export"
 	"github.com/CloudDetail/metadata/model/resource"
 	"github.com/CloudDetail/metadata/server"
-	"k8s.io/client-go/informers"
 )
 
+const DefaultCacheSyncTimeout = 5 * time.Minute
+
+// watcherFactories 每种资源的IWatcher构造函数, 由各IWatcher的init注册
+var watcherFactories = map[resource.ResType]func() IWatcher{}
+
+// K8sWatcher 进程级的Watchers, 只能监控一个集群
+//
+// Deprecated: use NewWatchers instead
 var K8sWatcher Watchers = Watchers{
 	Watchers:       map[resource.ResType]IWatcher{},
 	HandlerMap:     map[resource.ResType][]resource.ResHandler{},
 	ExportResource: export.NonExporter,
 
-	startedWatcher: []IWatcher{},
+	startedWatcher: map[resource.ResType][]IWatcher{},
+}
+
+// NewWatchers 创建独立的Watchers, 每个集群使用一个实例
+func NewWatchers(k8sConfig APIConfig, clusterID string) *Watchers {
+	w := &Watchers{
+		Watchers:       make(map[resource.ResType]IWatcher, len(watcherFactories)),
+		HandlerMap:     map[resource.ResType][]resource.ResHandler{},
+		ExportResource: export.NonExporter,
+		K8sConfig:      k8sConfig,
+		ClusterID:      clusterID,
+
+		startedWatcher: map[resource.ResType][]IWatcher{},
+	}
+	for resType, newWatcher := range watcherFactories {
+		w.Watchers[resType] = newWatcher()
+	}
+	return w
 }
 
 type ResourceHandlersMap map[resource.ResType][]resource.ResHandler
@@ -29,11 +58,30 @@ type Watchers struct {
 	Watchers   map[resource.ResType]IWatcher
 	HandlerMap ResourceHandlersMap
 
-	startedWatcher []IWatcher
+	// 每个Namespace启动一个IWatcher
+	startedWatcher map[resource.ResType][]IWatcher
 
 	K8sConfig APIConfig
 	ClusterID string
 
+	// 监控的Namespace, 为空时监控全部Namespace; Node, Namespace等集群级资源不受限制
+	Namespaces []string
+	// 按资源类型过滤List/Watch的结果
+	Selectors map[resource.ResType]Selector
+	// 从上游MetaSource获取的资源类型不启动Informer, 上游的事件直接交给本地的handler处理
+	Upstream *client.Client
+
+	// 定期对账的间隔, 默认DefaultReconcileInterval
+	ReconcileInterval time.Duration
+	// 等待Informer完成首次同步的时间, 默认DefaultCacheSyncTimeout
+	CacheSyncTimeout time.Duration
+	// 各监控范围的Informer, Stop时等待其退出
+	factories []*informerFactory
+	// Informer是否已完成首次同步
+	synced atomic.Bool
+	// 等待同步和定期对账的goroutine
+	wg sync.WaitGroup
+
 	HttpServer     *server.HTTPServer
 	ExportResource resource.Exporter
 }
@@ -65,15 +113,40 @@ func (w *Watchers) WithHandler(resType resource.ResType, handler resource.ResHan
 	return w
 }
 
+func (w *Watchers) WithNamespaces(namespaces ...string) *Watchers {
+	w.Namespaces = namespaces
+	return w
+}
+
+func (w *Watchers) WithSelector(resType resource.ResType, selector Selector) *Watchers {
+	if w.Selectors == nil {
+		w.Selectors = map[resource.ResType]Selector{}
+	}
+	w.Selectors[resType] = selector
+	return w
+}
+
+// WithUpstream upstream需要指定获取的资源类型
+func (w *Watchers) WithUpstream(upstream *client.Client) *Watchers {
+	w.Upstream = upstream
+	return w
+}
+
 func (w *Watchers) WithHttpServer(s *server.HTTPServer) *Watchers {
 	w.HttpServer = s
 	return w
 }
 
 func (w *Watchers) Run() error {
-	w.ctx = context.Background()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.synced.Store(false)
+	if err := w.validateSelectors(); err != nil {
+		w.cancel()
+		return err
+	}
 	clientSet, clusterIDFromAPIFingerprint, err := initClientSet(string(w.K8sConfig.AuthType), w.K8sConfig.AuthFilePath)
 	if err != nil {
+		w.cancel()
 		return err
 	}
 
@@ -84,33 +157,104 @@ func (w *Watchers) Run() error {
 		}
 	}
 
-	for resType, handlers := range w.HandlerMap {
+	for _, handlers := range w.HandlerMap {
 		for _, handler := range handlers {
 			handler.SetClusterID(w.ClusterID)
 			handler.SetExporter(w.ExportResource)
 		}
-		if watcher, find := w.Watchers[resType]; find {
-			w.startedWatcher = append(w.startedWatcher, watcher)
+	}
+
+	// 先启动HttpServer, 同步期间/healthz和/readyz即可访问, 监听失败时不再启动Informer
+	// 由ClusterWatchers统一管理HttpServer时为nil
+	if w.HttpServer != nil {
+		if err := w.HttpServer.StartHttpServer(); err != nil {
+			w.cancel()
+			return err
 		}
 	}
 
-	factory := informers.NewSharedInformerFactory(clientSet, 10*time.Minute)
-	for _, watcher := range w.startedWatcher {
-		watcher.Init(w.ctx, clientSet, factory, "", w.HandlerMap)
-		watcher.Run()
+	w.factories = w.startWatchers(clientSet, withEventCounters(w.HandlerMap))
+	for _, factory := range w.factories {
+		factory.start(w.ctx.Done())
+	}
+	w.startUpstream()
+	w.waitForCacheSync(w.factories)
+	return nil
+}
+
+// waitForCacheSync 超时后不再阻塞Run, 在后台继续等待; 同步完成后开始定期对账
+func (w *Watchers) waitForCacheSync(factories []*informerFactory) {
+	timeout := w.CacheSyncTimeout
+	if timeout <= 0 {
+		timeout = DefaultCacheSyncTimeout
+	}
+
+	done := make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(done)
+		for _, factory := range factories {
+			if resType, synced := factory.waitForCacheSync(w.ctx.Done()); !synced {
+				log.Printf("[%s] informer %s failed to sync", w.ClusterID, resType.Kind())
+				return
+			}
+		}
+		if w.Upstream != nil && !w.Upstream.WaitForSync(w.ctx) {
+			return
+		}
+		w.synced.Store(true)
+		log.Printf("[%s] informers are synced", w.ClusterID)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.keepReconcile()
+		}()
+	}()
+
+	select {
+	case <-done:
+	case <-w.ctx.Done():
+	case <-time.After(timeout):
+		log.Printf("[%s] informers are not synced after %s, keep waiting in background", w.ClusterID, timeout)
 	}
-	factory.Start(w.ctx.Done())
-	factory.WaitForCacheSync(w.ctx.Done())
+}
 
-	return w.HttpServer.StartHttpServer()
+// Ready Informer完成首次同步后就绪
+func (w *Watchers) Ready() error {
+	if !w.synced.Load() {
+		return errors.New("informers are not synced")
+	}
+	return nil
 }
 
+// Stop 停止Informer, 推送剩余的事件并关闭fetcher后停止HttpServer
+// 返回时Informer, 同步和定期对账的goroutine均已退出
 func (w *Watchers) Stop() error {
-	err := w.HttpServer.Stop()
-	w.ctx.Done()
+	w.stopWatching()
+	export.StopExporter(w.ExportResource)
+	var err error
+	if w.HttpServer != nil {
+		err = w.HttpServer.Stop()
+	}
 	return err
 }
 
-func addWatcher(resType resource.ResType, watcher IWatcher) {
-	K8sWatcher.Watchers[resType] = watcher
+// stopWatching 停止Informer和上游连接, 等待相关goroutine退出, 不停止Exporter
+func (w *Watchers) stopWatching() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	for _, factory := range w.factories {
+		factory.Shutdown()
+	}
+	if w.Upstream != nil {
+		w.Upstream.Stop()
+	}
+	w.wg.Wait()
+}
+
+func addWatcher(resType resource.ResType, newWatcher func() IWatcher) {
+	watcherFactories[resType] = newWatcher
+	K8sWatcher.Watchers[resType] = newWatcher()
 }
@@ -1,16 +1,26 @@
 package source
 
 import (
+	"crypto/tls"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/CloudDetail/metadata/client"
 	"github.com/CloudDetail/metadata/configs"
 	"github.com/CloudDetail/metadata/export"
 	"github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/codec"
 	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/rpc"
 	"github.com/CloudDetail/metadata/server"
 	"github.com/CloudDetail/metadata/source/apiserver"
 	"github.com/CloudDetail/metadata/source/metasource"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 type MetaSource interface {
@@ -29,114 +39,341 @@ const (
 	Fetch
 )
 
+// CreateMetaSourceFromConfig 配置无效(如证书无法加载)时返回的MetaSource在Run时返回该错误, 不启动任何服务
 func CreateMetaSourceFromConfig(config *configs.MetaSourceConfig) MetaSource {
 	var source MetaSource
-	if config.KubeSource != nil {
-		source = BuildKubeSource(config)
+	var err error
+	if config.KubeSource != nil && config.KubeSource.AllContexts {
+		source, err = BuildMultiClusterKubeSource(config)
+	} else if config.KubeSource != nil {
+		source, err = BuildKubeSource(config)
 	} else {
-		source = BuildMetaSource(config)
+		source, err = BuildMetaSource(config)
+	}
+	if err != nil {
+		return &invalidSource{err: err}
 	}
 	return source
 }
 
-func BuildKubeSource(config *configs.MetaSourceConfig) *apiserver.Watchers {
-	var httpServer *server.HTTPServer
-	if config.HttpServer != nil {
-		httpServer = server.NewHTTPServer(fmt.Sprintf(":%d", config.HttpServer.Port))
-	} else {
-		httpServer = server.NewHTTPServer("")
+// invalidSource 配置无效时代替MetaSource, 避免以不安全的方式启动
+type invalidSource struct {
+	err error
+}
+
+func (s *invalidSource) Run() error {
+	return s.err
+}
+
+func (s *invalidSource) Stop() error {
+	return nil
+}
+
+func (s *invalidSource) Handlers() map[string]http.HandlerFunc {
+	return nil
+}
+
+func BuildKubeSource(config *configs.MetaSourceConfig) (*apiserver.Watchers, error) {
+	httpServer, err := newHTTPServer(config.HttpServer)
+	if err != nil {
+		return nil, err
+	}
+	rpcServer := &rpc.Server{}
+	if err = setupGRPCServer(config, httpServer, rpcServer); err != nil {
+		return nil, err
 	}
 
-	apiserver.K8sWatcher.K8sConfig = apiserver.APIConfig{
+	exporters, cacheMap, err := setupKubeServers(config, httpServer, rpcServer, cache.NewSingleClusterCacheList())
+	if err != nil {
+		return nil, err
+	}
+	watchers := apiserver.NewWatchers(apiserver.APIConfig{
 		AuthType:     apiserver.AuthType(config.KubeSource.KubeAuthType),
 		AuthFilePath: config.KubeSource.KubeAuthConfig,
+	}, config.KubeSource.ClusterID)
+	if err = setupKubeWatchers(config, watchers, cacheMap); err != nil {
+		return nil, err
+	}
+
+	httpServer.WithHealthCheck(watchers.Ready)
+	if config.HttpServer != nil && config.HttpServer.EnableAdmin {
+		httpServer.RegisterHandler("/admin/status", server.StatusHandler(func() any {
+			return watchers.Status()
+		}))
 	}
 
+	return watchers.
+		WithHttpServer(httpServer).
+		WithExporters(exporters...), nil
+}
+
+// BuildMultiClusterKubeSource 监控kube_auth_config(文件或目录)中的每个context, ClusterID为context名称
+// 各集群共用HttpServer, Exporter和按集群区分的查询缓存
+func BuildMultiClusterKubeSource(config *configs.MetaSourceConfig) (*apiserver.ClusterWatchers, error) {
+	httpServer, err := newHTTPServer(config.HttpServer)
+	if err != nil {
+		return nil, err
+	}
+	rpcServer := &rpc.Server{}
+	if err = setupGRPCServer(config, httpServer, rpcServer); err != nil {
+		return nil, err
+	}
+
+	exporters, cacheMap, err := setupKubeServers(config, httpServer, rpcServer, cache.NewClusterCacheList())
+	if err != nil {
+		return nil, err
+	}
+	contexts, err := apiserver.LoadKubeContexts(config.KubeSource.KubeAuthConfig)
+	if err != nil {
+		log.Printf("failed to load kubeconfig contexts from %s: %v", config.KubeSource.KubeAuthConfig, err)
+	}
+	if config.KubeSource.NodeLocal != nil {
+		log.Printf("kube_source.node_local is not supported with all_contexts, ignored")
+	}
+	clusters := make([]*apiserver.Watchers, 0, len(contexts))
+	for _, kubeContext := range contexts {
+		watchers := apiserver.NewWatchers(kubeContext.Config, kubeContext.ClusterID)
+		if err = setupKubeWatchers(config, watchers, cacheMap); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, watchers)
+	}
+	clusterWatchers := apiserver.NewClusterWatchers(clusters...).
+		WithHttpServer(httpServer).
+		WithExporters(exporters...)
+
+	httpServer.WithHealthCheck(clusterWatchers.Ready)
+	if config.HttpServer != nil && config.HttpServer.EnableAdmin {
+		httpServer.RegisterHandler("/admin/status", server.StatusHandler(func() any {
+			return clusterWatchers.Status()
+		}))
+	}
+	return clusterWatchers, nil
+}
+
+// setupKubeServers 创建各集群共用的Exporter, 并注册/fetch, /query, /watch
+// 未配置querier时返回的CacheMap为nil
+func setupKubeServers(
+	config *configs.MetaSourceConfig,
+	httpServer *server.HTTPServer,
+	rpcServer *rpc.Server,
+	cacheMap cache.CacheMap,
+) ([]resource.Exporter, cache.CacheMap, error) {
 	exporters := []resource.Exporter{}
 	if config.Exporter != nil {
 		if len(config.Exporter.RemoteWriteAddr) > 0 {
-			httpExporter := export.NewHTTPExporter(config.Exporter.RemoteWriteAddr)
+			httpExporter, err := newHTTPExporter(config.Exporter)
+			if err != nil {
+				return nil, nil, err
+			}
 			exporters = append(exporters, httpExporter)
 		}
+		if len(config.Exporter.GRPCRemoteWriteAddr) > 0 {
+			grpcExporter, err := newGRPCExporter(config.Exporter)
+			if err != nil {
+				// 停止已经创建的HTTPExporter
+				(&export.Exporter{Exporters: exporters}).Stop()
+				return nil, nil, err
+			}
+			exporters = append(exporters, grpcExporter)
+		}
 		// Deprecated
 		if config.Exporter.FetchServerPort > 0 {
-			fetchServer := export.NewFetcherServer()
+			fetchServer := newFetcherServer(config.Exporter)
 			exporters = append(exporters, fetchServer)
+			rpcServer.Fetcher = fetchServer
 
 			httpServer.SetListenAddr(fmt.Sprintf(":%d", config.Exporter.FetchServerPort))
 			httpServer.RegisterHandler("/fetch", fetchServer.FetchWithWS)
 		} else if config.Exporter.EnableFetchServer {
-			fetchServer := export.NewFetcherServer()
+			fetchServer := newFetcherServer(config.Exporter)
 			exporters = append(exporters, fetchServer)
+			rpcServer.Fetcher = fetchServer
 
 			httpServer.RegisterHandler("/fetch", fetchServer.FetchWithWS)
 		}
 	}
 
-	podList := cache.NewPodList(resource.PodType, nil)
-	serviceList := cache.NewServiceList(resource.ServiceType, nil)
-	nodeList := cache.NewNodeList(resource.NodeType, nil)
+	if config.Querier == nil {
+		return exporters, nil, nil
+	}
+	cache.SetupCacheMap(cacheMap)
 
-	if config.Querier != nil {
-		cacheList := cache.NewSingleClusterCacheList()
-		cache.SetupCacheMap(cacheList)
+	// Deprecated
+	if config.Querier.QueryServerPort > 0 {
+		httpServer.SetListenAddr(fmt.Sprintf(":%d", config.Querier.QueryServerPort))
+		httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
+		httpServer.RegisterHandler(cache.RESTPrefix, cache.QueryInterface.QueryREST)
+	} else if config.Querier.EnableQueryServer {
+		httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
+		httpServer.RegisterHandler(cache.RESTPrefix, cache.QueryInterface.QueryREST)
+	}
 
-		// Deprecated
-		if config.Querier.QueryServerPort > 0 {
-			httpServer.SetListenAddr(fmt.Sprintf(":%d", config.Querier.QueryServerPort))
-			httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
-		} else if config.Querier.EnableQueryServer {
-			httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
+	if config.Querier.EnableWatchServer {
+		watchServer := export.NewWatchServer()
+		exporters = append(exporters, watchServer)
+		httpServer.RegisterHandler("/watch", watchServer.Watch)
+	}
+	return exporters, cacheMap, nil
+}
+
+// setupKubeWatchers 为一个集群创建资源缓存并注册到watchers, cacheMap不为nil时同时用于查询
+func setupKubeWatchers(config *configs.MetaSourceConfig, watchers *apiserver.Watchers, cacheMap cache.CacheMap) error {
+	retention := deletedRetention(config.Querier)
+	podList := cache.PodListWithRetention(retention)(resource.PodType, nil)
+	serviceList := cache.ServiceListWithRetention(retention)(resource.ServiceType, nil)
+	nodeList := cache.NodeListWithRetention(retention)(resource.NodeType, nil)
+
+	var optionalHandlers = map[resource.ResType]resource.ResHandler{}
+	if config.KubeSource.IsWorkloadNeeded {
+		for _, resType := range resource.WorkloadTypes {
+			optionalHandlers[resType] = cache.NewWorkloadList(resType, nil)
+		}
+	}
+
+	if config.KubeSource.IsNamespaceNeeded {
+		optionalHandlers[resource.NamespaceType] = cache.NewNamespaceList(resource.NamespaceType, nil)
+	}
+
+	if cacheMap != nil {
+		cacheMap.AddResHandler(watchers.ClusterID, resource.PodType, podList)
+		cacheMap.AddResHandler(watchers.ClusterID, resource.ServiceType, serviceList)
+		cacheMap.AddResHandler(watchers.ClusterID, resource.NodeType, nodeList)
+		for resType, handler := range optionalHandlers {
+			cacheMap.AddResHandler(watchers.ClusterID, resType, handler)
+		}
+	}
+
+	watchers.WithNamespaces(config.KubeSource.Namespaces...)
+	for kind, selector := range config.KubeSource.Selectors {
+		resType, find := resource.ParseResType(kind)
+		if !find {
+			log.Printf("unknown resource type %s in kube_source.selectors, ignored", kind)
+			continue
+		}
+		watchers.WithSelector(resType, apiserver.Selector{
+			LabelSelector: os.ExpandEnv(selector.LabelSelector),
+			FieldSelector: os.ExpandEnv(selector.FieldSelector),
+		})
+	}
+
+	// 多集群时各集群的上游不同, 不支持节点模式
+	if config.KubeSource.NodeLocal != nil && !config.KubeSource.AllContexts {
+		if err := setupNodeLocal(config.KubeSource.NodeLocal, watchers); err != nil {
+			return err
+		}
+	}
+
+	// 上游推送的Service已包含Endpoints, 不在本地匹配
+	if config.KubeSource.IsEndpointsNeeded && watchers.Upstream == nil {
+		if config.KubeSource.EndpointsSource == configs.EndpointsFromEndpointSlice {
+			// ServiceList同时处理Service和EndpointSlice资源
+			serviceList.(*cache.ServiceList).EnableEndpointSliceMatch()
+			watchers.WithHandler(resource.EndpointSliceType, serviceList)
+		} else {
+			// ServiceList同时处理Service和Pod资源,构造关联关系
+			serviceList.(*cache.ServiceList).EnablePodMatch()
+			watchers.WithHandler(resource.PodType, serviceList)
 		}
+	}
 
-		cacheList.AddResHandler("", resource.PodType, podList)
-		cacheList.AddResHandler("", resource.ServiceType, serviceList)
-		cacheList.AddResHandler("", resource.NodeType, nodeList)
+	for resType, handler := range optionalHandlers {
+		watchers.WithHandler(resType, handler)
 	}
 
-	if config.KubeSource.IsEndpointsNeeded {
-		// ServiceList同时处理Service和Pod资源,构造关联关系
-		serviceList.(*cache.ServiceList).EnablePodMatch()
-		apiserver.K8sWatcher.WithHandler(resource.PodType, serviceList)
+	if config.KubeSource.ReconcileInterval > 0 {
+		watchers.ReconcileInterval = time.Duration(config.KubeSource.ReconcileInterval) * time.Second
 	}
 
-	if len(config.KubeSource.ClusterID) > 0 {
-		apiserver.K8sWatcher.ClusterID = config.KubeSource.ClusterID
+	if config.KubeSource.CacheSyncTimeout > 0 {
+		watchers.CacheSyncTimeout = time.Duration(config.KubeSource.CacheSyncTimeout) * time.Second
 	}
 
-	return apiserver.K8sWatcher.
+	watchers.
 		WithHandler(resource.PodType, podList).
 		WithHandler(resource.ServiceType, serviceList).
-		WithHandler(resource.NodeType, nodeList).
-		WithHttpServer(httpServer).
-		WithExporters(exporters...)
+		WithHandler(resource.NodeType, nodeList)
+	return nil
 }
 
-func BuildMetaSource(config *configs.MetaSourceConfig) *metasource.MetaSource {
-	var httpServer *server.HTTPServer
-	if config.HttpServer != nil {
-		httpServer = server.NewHTTPServer(fmt.Sprintf(":%d", config.HttpServer.Port))
+// setupNodeLocal 只监控本节点上的Pod, 集群全部的Service和Node从上游MetaSource的/fetch获取
+func setupNodeLocal(cfg *configs.NodeLocalConfig, watchers *apiserver.Watchers) error {
+	nodeName := cfg.NodeName
+	if len(nodeName) == 0 {
+		nodeName = os.Getenv("NODE_NAME")
+	}
+	if len(nodeName) == 0 {
+		log.Printf("node_local is enabled but NODE_NAME is not set, watch pods on all nodes")
 	} else {
-		httpServer = server.NewHTTPServer("")
+		selector := watchers.Selectors[resource.PodType]
+		nodeSelector := "spec.nodeName=" + nodeName
+		if len(selector.FieldSelector) > 0 {
+			selector.FieldSelector += "," + nodeSelector
+		} else {
+			selector.FieldSelector = nodeSelector
+		}
+		watchers.WithSelector(resource.PodType, selector)
+	}
+
+	if len(cfg.UpstreamAddr) == 0 {
+		log.Printf("node_local.upstream_addr is not set, watch services and nodes from apiserver")
+		return nil
+	}
+	upstream := client.NewClient(cfg.UpstreamAddr, resource.ServiceType, resource.NodeType)
+	upstream.Codec = parseCodec(cfg.Encoding, cfg.Compression)
+	upstream.BearerToken = cfg.BearerToken
+	if cfg.TLS != nil {
+		tlsConfig, err := server.ClientTLSConfig(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("invalid node_local tls config: %w", err)
+		}
+		upstream.TLSConfig = tlsConfig
+	}
+	watchers.WithUpstream(upstream)
+	return nil
+}
+
+func BuildMetaSource(config *configs.MetaSourceConfig) (*metasource.MetaSource, error) {
+	httpServer, err := newHTTPServer(config.HttpServer)
+	if err != nil {
+		return nil, err
+	}
+	rpcServer := &rpc.Server{}
+	if err = setupGRPCServer(config, httpServer, rpcServer); err != nil {
+		return nil, err
 	}
 
 	exporters := []resource.Exporter{}
 	if config.Exporter != nil {
 		if len(config.Exporter.RemoteWriteAddr) > 0 {
-			httpExporter := export.NewHTTPExporter(config.Exporter.RemoteWriteAddr)
+			httpExporter, err := newHTTPExporter(config.Exporter)
+			if err != nil {
+				return nil, err
+			}
 			exporters = append(exporters, httpExporter)
 		}
+		if len(config.Exporter.GRPCRemoteWriteAddr) > 0 {
+			grpcExporter, err := newGRPCExporter(config.Exporter)
+			if err != nil {
+				// 停止已经创建的HTTPExporter
+				(&export.Exporter{Exporters: exporters}).Stop()
+				return nil, err
+			}
+			exporters = append(exporters, grpcExporter)
+		}
 
 		// Deprecated
 		if config.Exporter.FetchServerPort > 0 {
-			fetchServer := export.NewFetcherServer()
+			fetchServer := newFetcherServer(config.Exporter)
 			exporters = append(exporters, fetchServer)
+			rpcServer.Fetcher = fetchServer
 			httpServer.RegisterHandler("/fetch", fetchServer.FetchWithWS)
 
 			httpServer.SetListenAddr(fmt.Sprintf(":%d", config.Exporter.FetchServerPort))
 		} else if config.Exporter.EnableFetchServer {
-			fetchServer := export.NewFetcherServer()
+			fetchServer := newFetcherServer(config.Exporter)
 			exporters = append(exporters, fetchServer)
+			rpcServer.Fetcher = fetchServer
 			httpServer.RegisterHandler("/fetch", fetchServer.FetchWithWS)
 		}
 	}
@@ -154,17 +391,190 @@ func BuildMetaSource(config *configs.MetaSourceConfig) *metasource.MetaSource {
 		if config.Querier.QueryServerPort > 0 {
 			httpServer.SetListenAddr(fmt.Sprintf(":%d", config.Querier.QueryServerPort))
 			httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
+			httpServer.RegisterHandler(cache.RESTPrefix, cache.QueryInterface.QueryREST)
 		} else if config.Querier.EnableQueryServer {
 			httpServer.RegisterHandler("/query", cache.QueryInterface.QueryResource)
+			httpServer.RegisterHandler(cache.RESTPrefix, cache.QueryInterface.QueryREST)
+		}
+
+		if config.Querier.EnableWatchServer {
+			watchServer := export.NewWatchServer()
+			exporters = append(exporters, watchServer)
+			httpServer.RegisterHandler("/watch", watchServer.Watch)
 		}
 	}
 
-	return metasource.NewMetaSource().
+	retention := deletedRetention(config.Querier)
+	metaSource := metasource.NewMetaSource().
 		WithConfig(config).
-		WithHandlerTemp(resource.PodType, cache.NewPodList).
-		WithHandlerTemp(resource.ServiceType, cache.NewServiceList).
-		WithHandlerTemp(resource.NodeType, cache.NewNodeList).
+		WithHandlerTemp(resource.PodType, cache.PodListWithRetention(retention)).
+		WithHandlerTemp(resource.ServiceType, cache.ServiceListWithRetention(retention)).
+		WithHandlerTemp(resource.NodeType, cache.NodeListWithRetention(retention)).
+		WithHandlerTemp(resource.NamespaceType, cache.NewNamespaceList)
+	for _, resType := range resource.WorkloadTypes {
+		metaSource.WithHandlerTemp(resType, cache.NewWorkloadList)
+	}
+
+	if config.FetchSource != nil {
+		metaSource.WithFetchCodec(parseCodec(config.FetchSource.Encoding, config.FetchSource.Compression))
+		var tlsConfig *tls.Config
+		if config.FetchSource.TLS != nil {
+			var err error
+			if tlsConfig, err = server.ClientTLSConfig(config.FetchSource.TLS); err != nil {
+				return nil, fmt.Errorf("invalid fetch source tls config: %w", err)
+			}
+		}
+		metaSource.WithFetchAuth(tlsConfig, config.FetchSource.BearerToken)
+	}
+
+	if config.Snapshot != nil && len(config.Snapshot.Path) > 0 {
+		metaSource.WithSnapshot(config.Snapshot.Path, time.Duration(config.Snapshot.Interval)*time.Second)
+	}
+
+	metaSource.WithExpectedClusters(config.ExpectedClusterIDs...)
+	httpServer.WithHealthCheck(metaSource.Ready)
+	if config.HttpServer != nil && config.HttpServer.EnableAdmin {
+		httpServer.RegisterHandler("/admin/status", server.StatusHandler(func() any {
+			return metaSource.Status()
+		}))
+	}
+
+	if config.AcceptEventSource != nil &&
+		(config.AcceptEventSource.EnableAcceptServer || config.AcceptEventSource.AcceptEventPort > 0) {
+		rpcServer.Syncer = metaSource
+	}
+
+	return metaSource.
 		WithHttpServer(httpServer).
 		WithQuerier(cacheMap).
-		WithExporters(exporters...)
+		WithExporters(exporters...), nil
+}
+
+// deletedRetention 已删除资源在历史索引中的保留时长, 未配置querier时不保留
+func deletedRetention(config *configs.QuerierConfig) time.Duration {
+	if config == nil || config.DeletedRetention <= 0 {
+		return 0
+	}
+	return time.Duration(config.DeletedRetention) * time.Second
+}
+
+// newHTTPServer 配置的证书无效时返回错误, 避免以明文提供服务
+func newHTTPServer(config *configs.HTTPServerConfig) (*server.HTTPServer, error) {
+	if config == nil {
+		return server.NewHTTPServer(""), nil
+	}
+	httpServer := server.NewHTTPServer(fmt.Sprintf(":%d", config.Port))
+	if config.TLS != nil {
+		tlsConfig, err := server.ServerTLSConfig(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http server tls config: %w", err)
+		}
+		httpServer.WithTLSConfig(tlsConfig)
+	}
+	if config.Auth != nil {
+		httpServer.WithAuthenticator(server.NewStaticAuthenticator(config.Auth))
+	}
+	httpServer.WithDefaultPolicy(server.NewPolicy(config.Policy))
+	return httpServer.WithMetrics(), nil
+}
+
+func newHTTPExporter(config *configs.ExporterConfig) (*export.HTTPExporter, error) {
+	opts := export.HTTPExporterOptions{
+		Codec:       parseCodec(config.PushEncoding, config.PushCompression),
+		BearerToken: config.BearerToken,
+	}
+	if config.TLS != nil {
+		tlsConfig, err := server.ClientTLSConfig(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exporter tls config: %w", err)
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	if len(config.SpoolPath) > 0 {
+		spool, err := export.OpenSpool(config.SpoolPath, config.SpoolMaxBytes)
+		if err != nil {
+			log.Printf("failed to open spool %s, events will be dropped while remote is down: %v", config.SpoolPath, err)
+		} else {
+			opts.Spool = spool
+		}
+	}
+	return export.NewHTTPExporterWithOptions(config.RemoteWriteAddr, opts), nil
+}
+
+func newGRPCExporter(config *configs.ExporterConfig) (*export.HTTPExporter, error) {
+	opts := export.HTTPExporterOptions{}
+	if len(config.SpoolPath) > 0 {
+		// 与HTTP推送同时开启时使用不同的WAL文件
+		spool, err := export.OpenSpool(config.SpoolPath+".grpc", config.SpoolMaxBytes)
+		if err != nil {
+			log.Printf("failed to open spool %s.grpc, events will be dropped while remote is down: %v", config.SpoolPath, err)
+		} else {
+			opts.Spool = spool
+		}
+	}
+	var dialOpts []grpc.DialOption
+	if config.TLS != nil {
+		tlsConfig, err := server.ClientTLSConfig(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc exporter tls config: %w", err)
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if len(config.BearerToken) > 0 {
+		dialOpts = append(dialOpts, rpc.WithBearerToken(config.BearerToken))
+	}
+	exporter, err := export.NewGRPCExporter(config.GRPCRemoteWriteAddr, opts, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc exporter for %s: %w", config.GRPCRemoteWriteAddr, err)
+	}
+	return exporter, nil
+}
+
+// setupGRPCServer 配置了gRPC服务时, 随httpServer启动; 证书无效时返回错误
+// rpcServer的Fetcher和Syncer在处理请求时读取, 可以在注册后再设置
+func setupGRPCServer(config *configs.MetaSourceConfig, httpServer *server.HTTPServer, rpcServer *rpc.Server) error {
+	if config.GRPCServer == nil || config.GRPCServer.Port <= 0 {
+		return nil
+	}
+	var serverOpts []grpc.ServerOption
+	if config.GRPCServer.TLS != nil {
+		tlsConfig, err := server.ServerTLSConfig(config.GRPCServer.TLS)
+		if err != nil {
+			return fmt.Errorf("invalid grpc server tls config: %w", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if httpServer.Authenticator() != nil || httpServer.DefaultPolicy() != nil {
+		serverOpts = append(serverOpts, grpc.StreamInterceptor(
+			rpc.AuthStreamInterceptor(httpServer.Authenticator(), httpServer.DefaultPolicy())))
+	}
+	grpcServer := server.NewGRPCServer(fmt.Sprintf(":%d", config.GRPCServer.Port), serverOpts...)
+	rpcServer.Register(grpcServer.Server)
+	httpServer.WithGRPCServer(grpcServer)
+	return nil
+}
+
+// parseCodec 配置无效时使用不压缩的JSON
+func parseCodec(encoding string, compression string) codec.Codec {
+	var err error
+	c := codec.Default
+	if c.Encoding, err = codec.ParseEncoding(encoding); err != nil {
+		log.Printf("%v, use json instead", err)
+		c.Encoding = codec.JSON
+	}
+	if c.Compression, err = codec.ParseCompression(compression); err != nil {
+		log.Printf("%v, disable compression", err)
+		c.Compression = codec.NoCompression
+	}
+	return c
+}
+
+func newFetcherServer(cfg *configs.ExporterConfig) *export.FetcherServer {
+	fetchServer := export.NewFetcherServer()
+	if cfg.FetchEventLogSize != 0 {
+		fetchServer.WithEventLogSize(cfg.FetchEventLogSize)
+	}
+	return fetchServer
 }
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMetaSourceWithInvalidTLS(t *testing.T) {
+	invalidTLS := &configs.TLSConfig{CAFile: "not-exist-ca.crt"}
+
+	tests := []struct {
+		name   string
+		config *configs.MetaSourceConfig
+	}{
+		{"fetch source", &configs.MetaSourceConfig{
+			FetchSource: &configs.FetchSourceConfig{SourceAddr: "localhost:8080", TLS: invalidTLS},
+		}},
+		{"exporter", &configs.MetaSourceConfig{
+			AcceptEventSource: &configs.AcceptEventSourceConfig{EnableAcceptServer: true},
+			Exporter:          &configs.ExporterConfig{RemoteWriteAddr: "localhost:8080", TLS: invalidTLS},
+		}},
+		{"node local", &configs.MetaSourceConfig{
+			KubeSource: &configs.KubeSourceConfig{
+				NodeLocal: &configs.NodeLocalConfig{UpstreamAddr: "localhost:8080", TLS: invalidTLS},
+			},
+		}},
+		{"grpc exporter", &configs.MetaSourceConfig{
+			Exporter: &configs.ExporterConfig{GRPCRemoteWriteAddr: "localhost:8081", TLS: invalidTLS},
+		}},
+		{"http server", &configs.MetaSourceConfig{
+			HttpServer: &configs.HTTPServerConfig{Port: 8080, TLS: invalidTLS},
+		}},
+		{"kube http server", &configs.MetaSourceConfig{
+			KubeSource: &configs.KubeSourceConfig{},
+			HttpServer: &configs.HTTPServerConfig{Port: 8080, TLS: invalidTLS},
+		}},
+		{"grpc server", &configs.MetaSourceConfig{
+			GRPCServer: &configs.GRPCServerConfig{Port: 8081, TLS: invalidTLS},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 证书无法加载时不以明文连接远端
+			ms := CreateMetaSourceFromConfig(tt.config)
+			assert.ErrorContains(t, ms.Run(), "tls config")
+			assert.NoError(t, ms.Stop())
+		})
+	}
+}
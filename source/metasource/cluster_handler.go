@@ -1,6 +1,9 @@
 package metasource
 
 import (
+	"log"
+	"sync/atomic"
+
 	"github.com/CloudDetail/metadata/model/cache"
 	"github.com/CloudDetail/metadata/model/resource"
 )
@@ -8,11 +11,17 @@ import (
 type ClusterHandlerMap struct {
 	ClusterID string
 	exporter  resource.Exporter
+	// 已接收过Reset事件, 用于判断MetaSource是否就绪
+	resetReceived atomic.Bool
 
 	cache.HandlerMap
 }
 
 func (chm *ClusterHandlerMap) HandlerEvent(event *resource.ResourceEvent) {
+	if event.Malformed() {
+		log.Printf("[%s] skip malformed event", chm.ClusterID)
+		return
+	}
 	handler, find := chm.GetHandler(event.ResourceType)
 	if !find {
 		// create default handler, only used for query and transport to next meta source
@@ -30,5 +39,6 @@ func (chm *ClusterHandlerMap) HandlerEvent(event *resource.ResourceEvent) {
 		handler.DeleteResource(event.Res[0])
 	case resource.ResetOP:
 		handler.Reset(event.Res)
+		chm.resetReceived.Store(true)
 	}
 }
@@ -5,31 +5,32 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
+	"github.com/CloudDetail/metadata/client"
+	"github.com/CloudDetail/metadata/model/codec"
 	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
 
 	"github.com/gorilla/websocket"
 )
 
+// RunWithFetcher 通过/fetch从上游获取数据, 连接断开后30s重连, Stop后返回
 func (r *MetaSource) RunWithFetcher(address string, resTypes ...resource.ResType) error {
-	address = strings.TrimPrefix(address, "http://")
-	// 移除末尾的/
-	address = strings.TrimSuffix(address, "/")
-	pathIdx := strings.IndexByte(address, '/')
-	var u url.URL
-	if pathIdx < 0 {
-		u = url.URL{Scheme: "ws", Host: address, Path: "/fetch"}
-	} else {
-		u = url.URL{Scheme: "ws", Host: address[:pathIdx], Path: address[pathIdx:] + "/fetch"}
-	}
+	u := client.FetchURL(address)
 
 	for {
 		err := r.fetchFrom(u, resTypes...)
+		if r.ctx.Err() != nil {
+			return nil
+		}
 		if err != nil {
 			log.Printf("failed to fetch from source[%s], retry after 30s", address)
-			time.Sleep(30 * time.Second)
+			select {
+			case <-r.ctx.Done():
+				return nil
+			case <-time.After(30 * time.Second):
+			}
 		} else {
 			return nil
 		}
@@ -38,18 +39,36 @@ func (r *MetaSource) RunWithFetcher(address string, resTypes ...resource.ResType
 
 func (r *MetaSource) fetchFrom(u url.URL, resTypes ...resource.ResType) error {
 	var fetchHeader = http.Header{"X-Data-Flow": {"meta-fetch"}}
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), fetchHeader)
+	r.fetchCodec.SetAcceptHeaders(fetchHeader)
+	server.SetBearerToken(fetchHeader, r.fetchToken)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = r.fetchTLSConfig
+	conn, resp, err := dialer.DialContext(r.ctx, u.String(), fetchHeader)
 	if err != nil {
 		return err
 	}
+	fetchCodec, err := codec.FromContentHeaders(resp.Header)
+	if err != nil {
+		conn.Close()
+		return err
+	}
 	defer conn.Close()
-	r.stop = conn.Close
 
-	fetchRequest := resource.FetchRequest{
-		ResourceTypes: resTypes,
-	}
+	// Stop时通知上游并断开连接, 结束ReadMessage
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(time.Second))
+			conn.Close()
+		case <-stopped:
+		}
+	}()
 
-	data, err := json.Marshal(fetchRequest)
+	data, err := json.Marshal(r.fetchProgress.Request(resTypes))
 	if err != nil {
 		return err
 	}
@@ -67,26 +86,38 @@ func (r *MetaSource) fetchFrom(u url.URL, resTypes ...resource.ResType) error {
 		}
 
 		var syncReq resource.SyncRequest
-		err = json.Unmarshal(received, &syncReq)
+		err = fetchCodec.Unmarshal(received, &syncReq)
 		if err != nil {
 			return err
 		}
 
-		for _, event := range syncReq.Events {
-			handlerMap, find := r.ClusterMaps.Load(event.ClusterID)
-			if !find {
-				handlerMap = r.initClusterHandlerMap(event.ClusterID)
-				r.ClusterMaps.Store(event.ClusterID, handlerMap)
-			}
+		r.handleFetchedEvents(&syncReq)
+	}
+}
 
-			if !find && event.Operation != resource.ResetOP {
-				// 未初始化过的cluster,但不是reset事件,直接请求重新发送
-				log.Printf("[%s] accept meta event on uninitialized cluster, ask for reset", event.ClusterID)
-			} else if event.Operation == resource.ResetOP {
-				log.Printf("[%s] accept meta reset (%d) event", event.ClusterID, event.ResourceType)
-			}
+// handleFetchedEvents 处理从上游获取的事件, 供websocket和gRPC共同使用
+func (r *MetaSource) handleFetchedEvents(syncReq *resource.SyncRequest) {
+	if !r.fetchProgress.Accept(syncReq) {
+		return
+	}
+	for _, event := range syncReq.Events {
+		if event.Malformed() {
+			log.Printf("skip malformed fetched event")
+			continue
+		}
+		handlerMap, find := r.ClusterMaps.Load(event.ClusterID)
+		if !find {
+			handlerMap = r.initClusterHandlerMap(event.ClusterID)
+			r.ClusterMaps.Store(event.ClusterID, handlerMap)
+		}
 
-			handlerMap.(*ClusterHandlerMap).HandlerEvent(event)
+		if !find && event.Operation != resource.ResetOP {
+			// 未初始化过的cluster,但不是reset事件,直接请求重新发送
+			log.Printf("[%s] accept meta event on uninitialized cluster, ask for reset", event.ClusterID)
+		} else if event.Operation == resource.ResetOP {
+			log.Printf("[%s] accept meta reset (%d) event", event.ClusterID, event.ResourceType)
 		}
+
+		handlerMap.(*ClusterHandlerMap).HandlerEvent(event)
 	}
 }
@@ -0,0 +1,44 @@
+package metasource
+
+import (
+	"log"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// RunWithGRPCFetcher 通过gRPC Fetch流从上游获取数据, 连接断开后30s重连, Stop后返回
+func (r *MetaSource) RunWithGRPCFetcher(target string, resTypes ...resource.ResType) error {
+	var dialOpts []grpc.DialOption
+	if r.fetchTLSConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(r.fetchTLSConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if len(r.fetchToken) > 0 {
+		dialOpts = append(dialOpts, rpc.WithBearerToken(r.fetchToken))
+	}
+	conn, err := rpc.Dial(target, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		log.Printf("fetch from grpc source[%s], keep reading", target)
+		err := rpc.Fetch(r.ctx, conn, r.fetchProgress.Request(resTypes), r.handleFetchedEvents)
+		if r.ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("failed to fetch from grpc source[%s], retry after 30s, err: %v", target, err)
+		select {
+		case <-r.ctx.Done():
+			return nil
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metasource
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var checkPointAgeDesc = prometheus.NewDesc(
+	"metadata_meta_source_agent_checkpoint_age_seconds",
+	"Seconds since the last checkpoint accepted from each agent.",
+	[]string{"source", "agent"}, nil,
+)
+
+// checkPoints 进程内的全部MetaSource共用一个collector, 各实例的AgentIndex可能重复, 按source标签区分
+var checkPoints = &checkPointCollector{}
+
+// sourceCounter 为每个MetaSource分配source标签
+var sourceCounter atomic.Int64
+
+func init() {
+	metrics.Registry.MustRegister(checkPoints)
+}
+
+// checkPointCollector 在采集时根据AgentLastCheckPoint计算各Agent最近一次同步距今的时间
+type checkPointCollector struct {
+	// *MetaSource -> struct{}, 运行中的MetaSource
+	sources sync.Map
+}
+
+func (c *checkPointCollector) add(source *MetaSource) {
+	c.sources.Store(source, struct{}{})
+}
+
+func (c *checkPointCollector) remove(source *MetaSource) {
+	c.sources.Delete(source)
+}
+
+func (c *checkPointCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- checkPointAgeDesc
+}
+
+func (c *checkPointCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	c.sources.Range(func(key, _ any) bool {
+		source := key.(*MetaSource)
+		for _, agentIndex := range source.AgentLastCheckPoint.Keys() {
+			checkPoint, find := source.AgentLastCheckPoint.Peek(agentIndex)
+			if !find || checkPoint == nil || checkPoint.Timestamp == 0 {
+				continue
+			}
+			age := now.Sub(time.Unix(checkPoint.Timestamp, 0)).Seconds()
+			ch <- prometheus.MustNewConstMetric(checkPointAgeDesc, prometheus.GaugeValue, age,
+				source.metricsID, strconv.FormatInt(agentIndex, 10))
+		}
+		return true
+	})
+}
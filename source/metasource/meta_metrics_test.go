@@ -0,0 +1,30 @@
+package metasource
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPointAgeWithMultipleSources(t *testing.T) {
+	sources := []*MetaSource{NewMetaSource(), NewMetaSource()}
+	for _, source := range sources {
+		// 不同实例的AgentIndex相同
+		source.AgentLastCheckPoint.Add(1, &resource.CheckPoint{AgentIndex: 1, Timestamp: 100})
+		checkPoints.add(source)
+		defer checkPoints.remove(source)
+	}
+
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	var count int
+	for _, family := range families {
+		if family.GetName() == "metadata_meta_source_agent_checkpoint_age_seconds" {
+			count = len(family.GetMetric())
+		}
+	}
+	assert.Equal(t, 2, count)
+}
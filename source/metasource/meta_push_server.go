@@ -1,32 +1,52 @@
 package metasource
 
 import (
-	"encoding/json"
-	"io"
 	"log"
 	"net/http"
 
+	"github.com/CloudDetail/metadata/metrics"
+	"github.com/CloudDetail/metadata/model/codec"
 	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
 )
 
 func (r *MetaSource) HandlePushedEvent(w http.ResponseWriter, req *http.Request) {
 	var syncReq resource.SyncRequest
+	defer req.Body.Close()
 
-	body, err := io.ReadAll(req.Body)
+	reqCodec, err := codec.FromContentHeaders(req.Header)
 	if err != nil {
-		log.Printf("parse push event failed: failed to read request body: err: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		log.Printf("parse push event failed: unsupported content type: err: %v", err)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
 	}
-	defer req.Body.Close()
-
-	if err := json.Unmarshal(body, &syncReq); err != nil {
+	if err := reqCodec.Decode(req.Body, &syncReq); err != nil {
 		log.Printf("parse push event failed:  failed to unmarshal request body: err: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	resp := resource.SyncResponse{
+	credential := server.CredentialFromContext(req.Context())
+	if clusterID, denied := credential.DeniedCluster(syncReq.Events); denied {
+		log.Printf("reject push event from [%s]: cluster [%s] is not allowed", credential.Name, clusterID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	resp := r.HandleSyncRequest(&syncReq)
+	respCodec := codec.Negotiate(req.Header)
+	data, err := respCodec.Marshal(resp)
+	if err != nil {
+		log.Printf("sync with meta-agent failed: failed to marshal response body: err: %v", err)
+		return
+	}
+	respCodec.SetContentHeaders(w.Header())
+	w.Write(data)
+}
+
+// HandleSyncRequest 处理Agent推送的同步请求, 供/push和gRPC Sync流共同使用
+func (r *MetaSource) HandleSyncRequest(syncReq *resource.SyncRequest) *resource.SyncResponse {
+	resp := &resource.SyncResponse{
 		IsAccepted: true,
 	}
 
@@ -42,22 +62,26 @@ func (r *MetaSource) HandlePushedEvent(w http.ResponseWriter, req *http.Request)
 		if !find || checkPoint.EventIndex != syncReq.LastCheckPoint.EventIndex {
 			// 重新初始化
 			resp.IsInit = true
+			metrics.MetaSourceResyncs.WithLabelValues("sync_check").Inc()
 		}
+	} else if !syncReq.IsInitRequest() && !r.isSyncWithAgent(syncReq.LastCheckPoint) {
+		// 增量数据与已记录的同步进度不连续(例如从旧快照恢复后), 要求重新初始化
+		log.Printf("agent [%d] is not sync with meta source, ask for reset", syncReq.LastCheckPoint.AgentIndex)
+		resp.IsInit = true
+		metrics.MetaSourceResyncs.WithLabelValues("discontinuous").Inc()
 	} else {
-		resp.LastCheckPoint, resp.IsInit = r.handlerSyncRequest(&syncReq)
+		resp.LastCheckPoint, resp.IsInit = r.handlerSyncRequest(syncReq)
 		r.AgentLastCheckPoint.Add(syncReq.CheckPoint.AgentIndex, syncReq.CheckPoint)
 	}
-
-	jsonResp, err := json.Marshal(resp)
-	if err != nil {
-		log.Printf("sync with meta-agent failed: failed to marshal response body: err: %v", err)
-		return
-	}
-	w.Write(jsonResp)
+	return resp
 }
 
 func (r *MetaSource) handlerSyncRequest(syncReq *resource.SyncRequest) (cp *resource.CheckPoint, isInit bool) {
 	for _, event := range syncReq.Events {
+		if event.Malformed() {
+			log.Printf("skip malformed pushed event")
+			continue
+		}
 		handlerMap, find := r.ClusterMaps.Load(event.ClusterID)
 		if !find {
 			handlerMap = r.initClusterHandlerMap(event.ClusterID)
@@ -67,6 +91,7 @@ func (r *MetaSource) handlerSyncRequest(syncReq *resource.SyncRequest) (cp *reso
 		if !find && event.Operation != resource.ResetOP {
 			// 未初始化过的cluster,但不是reset事件,直接请求重新发送
 			log.Printf("[%s] accept meta event on uninitialized cluster, ask for reset", event.ClusterID)
+			metrics.MetaSourceResyncs.WithLabelValues("uninitialized_cluster").Inc()
 			return nil, true
 		} else if event.Operation == resource.ResetOP {
 			log.Printf("[%s] accept meta reset (%d) event", event.ClusterID, event.ResourceType)
@@ -77,3 +102,9 @@ func (r *MetaSource) handlerSyncRequest(syncReq *resource.SyncRequest) (cp *reso
 
 	return syncReq.CheckPoint, false
 }
+
+// isSyncWithAgent 检查Agent的上一个CheckPoint是否与记录的一致
+func (r *MetaSource) isSyncWithAgent(lastCheckPoint *resource.CheckPoint) bool {
+	checkPoint, find := r.AgentLastCheckPoint.Get(lastCheckPoint.AgentIndex)
+	return find && checkPoint.Equals(lastCheckPoint)
+}
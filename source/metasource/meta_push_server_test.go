@@ -0,0 +1,61 @@
+package metasource
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushDeniedCluster(t *testing.T) {
+	ms := testMetaSource()
+	credential := &server.Credential{Name: "agent", ClusterIDs: []string{"cluster-a"}}
+
+	push := func(clusterID string) int {
+		body, err := json.Marshal(&resource.SyncRequest{
+			Events: []*resource.ResourceEvent{{
+				ClusterID:    clusterID,
+				ResourceType: resource.PodType,
+				Operation:    resource.ResetOP,
+			}},
+			CheckPoint: &resource.CheckPoint{AgentIndex: 1, EventIndex: 1},
+		})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/push", bytes.NewReader(body))
+		req = req.WithContext(server.WithCredential(req.Context(), credential))
+		recorder := httptest.NewRecorder()
+		ms.HandlePushedEvent(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, push("cluster-b"))
+	_, find := ms.ClusterMaps.Load("cluster-b")
+	assert.False(t, find)
+
+	assert.Equal(t, http.StatusOK, push("cluster-a"))
+	_, find = ms.ClusterMaps.Load("cluster-a")
+	assert.True(t, find)
+}
+
+func TestPushMalformedEvents(t *testing.T) {
+	ms := testMetaSource()
+	// 不完整的事件被跳过, 不影响同一请求中的其他事件
+	body := []byte(`{"Events": [
+		null,
+		{"ClusterID": "cluster-a", "ResourceType": 1, "Operation": 3, "Res": []},
+		{"ClusterID": "cluster-a", "ResourceType": 1, "Operation": 0, "Res": []},
+		{"ClusterID": "cluster-a", "ResourceType": 1, "Operation": 2, "Res": [null]}
+	], "CheckPoint": {"AgentIndex": 1, "EventIndex": 1}}`)
+	req := httptest.NewRequest(http.MethodPost, "/push", bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	assert.NotPanics(t, func() { ms.HandlePushedEvent(recorder, req) })
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	_, find := ms.ClusterMaps.Load("cluster-a")
+	assert.True(t, find)
+}
@@ -2,14 +2,19 @@ package metasource
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/CloudDetail/metadata/configs"
 	"github.com/CloudDetail/metadata/export"
 	"github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/codec"
 	"github.com/CloudDetail/metadata/model/resource"
 	"github.com/CloudDetail/metadata/server"
 	lru "github.com/hashicorp/golang-lru/v2"
@@ -17,6 +22,7 @@ import (
 
 type MetaSource struct {
 	ctx                context.Context
+	cancel             context.CancelFunc
 	cfg                *configs.MetaSourceConfig
 	HandlerTemplateMap map[resource.ResType]resource.HandlerTemplate
 	// clusterId(string) -> *cache.ClusterHandlerMap
@@ -28,7 +34,25 @@ type MetaSource struct {
 
 	AgentLastCheckPoint *lru.Cache[int64, *resource.CheckPoint]
 	AgentCounter        atomic.Int64
-	stop                func() error
+	// 获取上游数据和定期保存快照的goroutine, Stop时等待退出
+	wg sync.WaitGroup
+
+	// 快照文件路径, 为空时不保存快照
+	snapshotPath     string
+	snapshotInterval time.Duration
+
+	// 期望上游推送的编码和压缩方式
+	fetchCodec codec.Codec
+	// 已处理的上游事件序号, 重连时用于续传
+	fetchProgress resource.FetchProgress
+	// 连接上游使用的TLS配置和Bearer Token
+	fetchTLSConfig *tls.Config
+	fetchToken     string
+
+	// 指标中的source标签, 区分同一进程中的多个实例
+	metricsID string
+	// 就绪前需要接收到Reset事件的集群, 为空时任意集群即可
+	expectedClusters []string
 }
 
 func (r *MetaSource) Handlers() map[string]http.HandlerFunc {
@@ -40,14 +64,17 @@ func (r *MetaSource) Handlers() map[string]http.HandlerFunc {
 
 func NewMetaSource() *MetaSource {
 	agentMap, _ := lru.New[int64, *resource.CheckPoint](1000)
-	return &MetaSource{
-		ctx:                 context.Background(),
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &MetaSource{
+		ctx:                 ctx,
+		cancel:              cancel,
 		HandlerTemplateMap:  map[resource.ResType]resource.HandlerTemplate{},
 		ClusterMaps:         sync.Map{},
 		Exporter:            export.NonExporter,
 		AgentLastCheckPoint: agentMap,
-		stop:                func() error { return nil },
 	}
+	s.metricsID = strconv.FormatInt(sourceCounter.Add(1), 10)
+	return s
 }
 
 func (s *MetaSource) WithConfig(cfg *configs.MetaSourceConfig) *MetaSource {
@@ -77,17 +104,64 @@ func (s *MetaSource) WithExporters(exporters ...resource.Exporter) *MetaSource {
 	return s
 }
 
+// WithFetchCodec 设置期望上游/fetch推送的编码和压缩方式, 上游不支持时回退为JSON
+func (s *MetaSource) WithFetchCodec(fetchCodec codec.Codec) *MetaSource {
+	s.fetchCodec = fetchCodec
+	return s
+}
+
+// WithFetchAuth 连接上游时使用的TLS配置和Bearer Token, 均可以为空
+func (s *MetaSource) WithFetchAuth(tlsConfig *tls.Config, token string) *MetaSource {
+	s.fetchTLSConfig = tlsConfig
+	s.fetchToken = token
+	return s
+}
+
+// WithExpectedClusters 设置就绪前需要完成初始化的集群
+func (s *MetaSource) WithExpectedClusters(clusterIDs ...string) *MetaSource {
+	s.expectedClusters = clusterIDs
+	return s
+}
+
 func (s *MetaSource) WithHttpServer(srv *server.HTTPServer) *MetaSource {
 	s.HttpServer = srv
 	return s
 }
 
+// Stop 断开上游, 关闭fetcher并停止HttpServer, 所有goroutine退出并保存快照后返回
 func (s *MetaSource) Stop() error {
-	s.HttpServer.Stop()
-	return s.stop()
+	s.cancel()
+	export.StopExporter(s.Exporter)
+	err := s.HttpServer.Stop()
+	s.wg.Wait()
+	if len(s.snapshotPath) > 0 {
+		if err := s.SaveSnapshot(s.snapshotPath); err != nil {
+			log.Printf("failed to save snapshot to %s: %v", s.snapshotPath, err)
+		}
+	}
+	checkPoints.remove(s)
+	return err
+}
+
+// goRun 启动由Stop等待退出的goroutine
+func (s *MetaSource) goRun(fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
 }
 
 func (s *MetaSource) Run() error {
+	checkPoints.add(s)
+	if len(s.snapshotPath) > 0 {
+		// 快照损坏时从空状态启动, 等待Agent重新推送
+		if err := s.LoadSnapshot(s.snapshotPath); err != nil {
+			log.Printf("failed to restore snapshot, start without it: %v", err)
+		}
+		s.goRun(s.keepSaveSnapshot)
+	}
+
 	if s.cfg.AcceptEventSource != nil {
 		// Deprecated
 		if s.cfg.AcceptEventSource.AcceptEventPort > 0 {
@@ -97,12 +171,34 @@ func (s *MetaSource) Run() error {
 			s.HttpServer.RegisterHandler("/push", s.HandlePushedEvent)
 		}
 	} else if s.cfg.FetchSource != nil {
-		go s.RunWithFetcher(s.cfg.FetchSource.SourceAddr)
+		if s.cfg.FetchSource.Transport == configs.TransportGRPC {
+			s.goRun(func() {
+				if err := s.RunWithGRPCFetcher(s.cfg.FetchSource.SourceAddr); err != nil {
+					log.Printf("failed to fetch from grpc source[%s]: %v", s.cfg.FetchSource.SourceAddr, err)
+				}
+			})
+		} else {
+			s.goRun(func() {
+				s.RunWithFetcher(s.cfg.FetchSource.SourceAddr)
+			})
+		}
 	} else {
+		s.stopRunning()
 		return fmt.Errorf("invalid meta source config")
 	}
 
-	return s.HttpServer.StartHttpServer()
+	if err := s.HttpServer.StartHttpServer(); err != nil {
+		s.stopRunning()
+		return err
+	}
+	return nil
+}
+
+// stopRunning Run失败时停止已经启动的goroutine
+func (s *MetaSource) stopRunning() {
+	s.cancel()
+	s.wg.Wait()
+	checkPoints.remove(s)
 }
 
 func (s *MetaSource) initClusterHandlerMap(
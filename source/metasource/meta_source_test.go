@@ -0,0 +1,39 @@
+package metasource
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CloudDetail/metadata/configs"
+	"github.com/CloudDetail/metadata/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.gz")
+	ms := testMetaSource().
+		WithConfig(&configs.MetaSourceConfig{
+			// 上游不可用, 获取数据的goroutine处于重连等待中
+			FetchSource: &configs.FetchSourceConfig{SourceAddr: "127.0.0.1:1"},
+		}).
+		WithHttpServer(server.NewHTTPServer("")).
+		WithSnapshot(path, time.Minute)
+	require.NoError(t, ms.Run())
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		assert.NoError(t, ms.Stop())
+		// 重复Stop不会panic
+		assert.NoError(t, ms.Stop())
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for stop")
+	}
+	assert.FileExists(t, path)
+}
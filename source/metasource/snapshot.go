@@ -0,0 +1,180 @@
+package metasource
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+const DefaultSnapshotInterval = 60 * time.Second
+
+// Snapshot MetaSource的持久化状态
+// 包含每个集群的全量资源和各Agent最后一次同步的CheckPoint
+type Snapshot struct {
+	// 保存快照的时间, unix毫秒
+	Timestamp    int64
+	AgentCounter int64
+
+	Clusters []*ClusterSnapshot
+	// 按最近使用时间升序, 恢复时按顺序写入LRU
+	CheckPoints []*resource.CheckPoint
+}
+
+type ClusterSnapshot struct {
+	ClusterID string
+	// 每种资源类型一个Reset事件
+	Events []*resource.ResourceEvent
+}
+
+func (s *MetaSource) WithSnapshot(path string, interval time.Duration) *MetaSource {
+	s.snapshotPath = path
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	s.snapshotInterval = interval
+	return s
+}
+
+// TakeSnapshot 生成当前状态的快照
+func (s *MetaSource) TakeSnapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Timestamp:    time.Now().UnixMilli(),
+		AgentCounter: s.AgentCounter.Load(),
+	}
+
+	// 先读取同步进度再读取资源, 期间接收的推送只会使资源比CheckPoint新
+	// 恢复后Agent的CheckPoint与快照不一致, 会重新初始化, 不会丢失事件
+	for _, agentIndex := range s.AgentLastCheckPoint.Keys() {
+		if checkPoint, find := s.AgentLastCheckPoint.Peek(agentIndex); find {
+			snapshot.CheckPoints = append(snapshot.CheckPoints, checkPoint)
+		}
+	}
+
+	s.ClusterMaps.Range(func(key, value any) bool {
+		handlerMap := value.(*ClusterHandlerMap)
+		cluster := &ClusterSnapshot{ClusterID: handlerMap.ClusterID}
+
+		handlerMap.RLock()
+		for resType, handler := range handlerMap.Handlers {
+			ref, ok := handler.(interface{ ResourcesRef() *resource.Resources })
+			if !ok {
+				continue
+			}
+			cluster.Events = append(cluster.Events, &resource.ResourceEvent{
+				ClusterID:    handlerMap.ClusterID,
+				Res:          ref.ResourcesRef().Snapshot(),
+				ResourceType: resType,
+				Operation:    resource.ResetOP,
+			})
+		}
+		handlerMap.RUnlock()
+
+		sort.Slice(cluster.Events, func(i, j int) bool {
+			return cluster.Events[i].ResourceType < cluster.Events[j].ResourceType
+		})
+		snapshot.Clusters = append(snapshot.Clusters, cluster)
+		return true
+	})
+	return snapshot
+}
+
+// RestoreSnapshot 使用快照恢复集群资源和Agent的同步进度
+// 恢复后Agent的同步检查与快照中的CheckPoint一致时继续增量同步, 否则要求Agent重新初始化
+func (s *MetaSource) RestoreSnapshot(snapshot *Snapshot) {
+	for _, cluster := range snapshot.Clusters {
+		handlerMap, find := s.ClusterMaps.Load(cluster.ClusterID)
+		if !find {
+			handlerMap = s.initClusterHandlerMap(cluster.ClusterID)
+			s.ClusterMaps.Store(cluster.ClusterID, handlerMap)
+		}
+		for _, event := range cluster.Events {
+			handlerMap.(*ClusterHandlerMap).HandlerEvent(event)
+		}
+	}
+
+	for _, checkPoint := range snapshot.CheckPoints {
+		s.AgentLastCheckPoint.Add(checkPoint.AgentIndex, checkPoint)
+	}
+
+	// 避免新Agent分配到与快照中已有Agent相同的编号
+	for {
+		counter := s.AgentCounter.Load()
+		if counter >= snapshot.AgentCounter || s.AgentCounter.CompareAndSwap(counter, snapshot.AgentCounter) {
+			break
+		}
+	}
+}
+
+// SaveSnapshot 将快照以gzip压缩的JSON写入path, 先写临时文件再重命名, 避免中途退出导致快照损坏
+func (s *MetaSource) SaveSnapshot(path string) error {
+	snapshot := s.TakeSnapshot()
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	gzipWriter := gzip.NewWriter(tmpFile)
+	if err = json.NewEncoder(gzipWriter).Encode(snapshot); err == nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// LoadSnapshot 从path读取快照并恢复, 快照不存在时直接返回
+func (s *MetaSource) LoadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	defer gzipReader.Close()
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(gzipReader).Decode(&snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	s.RestoreSnapshot(&snapshot)
+	log.Printf("restore snapshot from %s, taken at %s, clusters: %d, agents: %d",
+		path, time.UnixMilli(snapshot.Timestamp).Format(time.RFC3339), len(snapshot.Clusters), len(snapshot.CheckPoints))
+	return nil
+}
+
+func (s *MetaSource) keepSaveSnapshot() {
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SaveSnapshot(s.snapshotPath); err != nil {
+				log.Printf("failed to save snapshot to %s: %v", s.snapshotPath, err)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package metasource
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/cache"
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetaSource() *MetaSource {
+	return NewMetaSource().
+		WithHandlerTemp(resource.PodType, cache.NewPodList).
+		WithQuerier(cache.NewClusterCacheList())
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.gz")
+
+	src := testMetaSource()
+	initCP := &resource.CheckPoint{AgentIndex: src.AgentCounter.Add(1), Timestamp: 100, EventIndex: 1}
+	_, isInit := src.handlerSyncRequest(&resource.SyncRequest{
+		Events: []*resource.ResourceEvent{{
+			ClusterID:    "cluster-a",
+			ResourceType: resource.PodType,
+			Operation:    resource.ResetOP,
+			Res: []*resource.Resource{{
+				ResUID:     "uid-1",
+				ResType:    resource.PodType,
+				Name:       "pod-1",
+				StringAttr: map[resource.AttrKey]string{resource.NamespaceAttr: "default", resource.PodIP: "10.0.0.1"},
+			}},
+		}},
+		CheckPoint: initCP,
+	})
+	require.False(t, isInit)
+	src.AgentLastCheckPoint.Add(initCP.AgentIndex, initCP)
+	require.NoError(t, src.SaveSnapshot(path))
+
+	dst := testMetaSource()
+	require.NoError(t, dst.LoadSnapshot(path))
+
+	querier := &cache.Query{CacheMap: dst.QuerierCacheMap}
+	pod, find := querier.GetPodByIP("cluster-a", "10.0.0.1")
+	require.True(t, find)
+	assert.Equal(t, "pod-1", pod.Name)
+
+	// 新Agent不会复用快照中的编号
+	assert.Equal(t, initCP.AgentIndex+1, dst.AgentCounter.Add(1))
+
+	// CheckPoint一致时继续增量同步, 否则要求重新初始化
+	assert.True(t, dst.isSyncWithAgent(initCP))
+	assert.False(t, dst.isSyncWithAgent(&resource.CheckPoint{AgentIndex: initCP.AgentIndex, Timestamp: 100, EventIndex: 2}))
+	assert.False(t, dst.isSyncWithAgent(&resource.CheckPoint{AgentIndex: initCP.AgentIndex + 1}))
+}
+
+func TestLoadMissingSnapshot(t *testing.T) {
+	assert.NoError(t, testMetaSource().LoadSnapshot(filepath.Join(t.TempDir(), "missing.gz")))
+}
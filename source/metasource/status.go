@@ -0,0 +1,87 @@
+package metasource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CloudDetail/metadata/export"
+	"github.com/CloudDetail/metadata/model/resource"
+)
+
+// MetaSourceStatus 用于管理接口展示MetaSource的状态
+type MetaSourceStatus struct {
+	Agents    []AgentStatus           `json:"agents"`
+	Clusters  []ClusterStatus         `json:"clusters"`
+	Exporters []export.ExporterStatus `json:"exporters"`
+}
+
+type AgentStatus struct {
+	AgentIndex     int64                `json:"agent_index"`
+	LastCheckPoint *resource.CheckPoint `json:"last_check_point"`
+}
+
+type ClusterStatus struct {
+	ClusterID     string `json:"cluster_id"`
+	ResetReceived bool   `json:"reset_received"`
+	// 资源类型名 -> 资源数量
+	Resources map[string]int `json:"resources"`
+}
+
+func (s *MetaSource) Status() *MetaSourceStatus {
+	status := &MetaSourceStatus{
+		Agents:    []AgentStatus{},
+		Clusters:  []ClusterStatus{},
+		Exporters: export.StatusOf(s.Exporter),
+	}
+	for _, agentIndex := range s.AgentLastCheckPoint.Keys() {
+		if checkPoint, find := s.AgentLastCheckPoint.Peek(agentIndex); find {
+			status.Agents = append(status.Agents, AgentStatus{AgentIndex: agentIndex, LastCheckPoint: checkPoint})
+		}
+	}
+	sort.Slice(status.Agents, func(i, j int) bool {
+		return status.Agents[i].AgentIndex < status.Agents[j].AgentIndex
+	})
+
+	s.ClusterMaps.Range(func(_, value any) bool {
+		handlerMap := value.(*ClusterHandlerMap)
+		status.Clusters = append(status.Clusters, ClusterStatus{
+			ClusterID:     handlerMap.ClusterID,
+			ResetReceived: handlerMap.resetReceived.Load(),
+			Resources:     handlerMap.ResourceCounts(),
+		})
+		return true
+	})
+	sort.Slice(status.Clusters, func(i, j int) bool {
+		return status.Clusters[i].ClusterID < status.Clusters[j].ClusterID
+	})
+	return status
+}
+
+// Ready 配置了期望的集群时, 每个集群都接收过Reset事件后就绪; 否则任意集群接收过Reset事件后就绪
+// 从快照恢复的集群视为已接收过Reset事件
+func (s *MetaSource) Ready() error {
+	if len(s.expectedClusters) == 0 {
+		ready := false
+		s.ClusterMaps.Range(func(_, value any) bool {
+			ready = value.(*ClusterHandlerMap).resetReceived.Load()
+			return !ready
+		})
+		if !ready {
+			return fmt.Errorf("no reset received from any cluster")
+		}
+		return nil
+	}
+
+	var notReady []string
+	for _, clusterID := range s.expectedClusters {
+		handlerMap, find := s.ClusterMaps.Load(clusterID)
+		if !find || !handlerMap.(*ClusterHandlerMap).resetReceived.Load() {
+			notReady = append(notReady, clusterID)
+		}
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("no reset received from clusters: %s", strings.Join(notReady, ","))
+	}
+	return nil
+}
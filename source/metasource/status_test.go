@@ -0,0 +1,59 @@
+package metasource
+
+import (
+	"testing"
+
+	"github.com/CloudDetail/metadata/model/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyAndStatus(t *testing.T) {
+	ms := testMetaSource().WithExpectedClusters("cluster-a", "cluster-b")
+	assert.EqualError(t, ms.Ready(), "no reset received from clusters: cluster-a,cluster-b")
+
+	push := func(clusterID string, agentIndex int64) {
+		resp := ms.HandleSyncRequest(&resource.SyncRequest{
+			Events: []*resource.ResourceEvent{{
+				ClusterID:    clusterID,
+				ResourceType: resource.PodType,
+				Operation:    resource.ResetOP,
+				Res: []*resource.Resource{
+					{ResType: resource.PodType, ResUID: resource.ResUID(clusterID + "-pod"), Name: "pod"},
+				},
+			}},
+			CheckPoint: &resource.CheckPoint{AgentIndex: agentIndex, Timestamp: 100, EventIndex: 1},
+		})
+		assert.False(t, resp.IsInit)
+	}
+
+	push("cluster-a", 1)
+	assert.EqualError(t, ms.Ready(), "no reset received from clusters: cluster-b")
+	push("cluster-b", 2)
+	assert.NoError(t, ms.Ready())
+
+	status := ms.Status()
+	if assert.Len(t, status.Agents, 2) {
+		assert.Equal(t, int64(1), status.Agents[0].AgentIndex)
+		assert.Equal(t, 1, status.Agents[0].LastCheckPoint.EventIndex)
+	}
+	if assert.Len(t, status.Clusters, 2) {
+		assert.Equal(t, "cluster-a", status.Clusters[0].ClusterID)
+		assert.True(t, status.Clusters[0].ResetReceived)
+		assert.Equal(t, map[string]int{resource.PodType.Kind(): 1}, status.Clusters[0].Resources)
+	}
+}
+
+func TestReadyWithoutExpectedClusters(t *testing.T) {
+	ms := testMetaSource()
+	assert.Error(t, ms.Ready())
+
+	ms.HandleSyncRequest(&resource.SyncRequest{
+		Events: []*resource.ResourceEvent{{
+			ClusterID:    "cluster-a",
+			ResourceType: resource.PodType,
+			Operation:    resource.ResetOP,
+		}},
+		CheckPoint: &resource.CheckPoint{AgentIndex: 1, EventIndex: 1},
+	})
+	assert.NoError(t, ms.Ready())
+}